@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/gorilla/mux"
+)
+
+// requireAdmin only lets requests through that carry the admin token as a
+// bearer token. Admin routes are disabled when no admin token is configured.
+func (mon *githubMonitor) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(mon.adminToken) == 0 {
+			http.Error(w, "Admin routes are disabled", http.StatusNotFound)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), mon.adminToken) != 1 {
+			requestLog(r).Warnf("Rejected admin request from %s", r.RemoteAddr)
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleConfig returns the effective configuration, with secrets redacted
+func (mon *githubMonitor) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mon.config.redacted()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleResync re-runs card placement for every `{release}/{action}` label of
+// an issue as if the labels had just been applied, for when a board got out
+// of sync. Issues without release labels are only triaged with
+// `?triage=true`. The decisions taken are returned as a summary, which is
+// empty when the decision log is disabled.
+func (mon *githubMonitor) handleResync(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	owner, name := vars["owner"], vars["name"]
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil {
+		http.Error(w, "Invalid issue number", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	issue, _, err := mon.clients.forOwner(owner).Issues.Get(ctx, owner, name, number)
+	if err != nil {
+		requestLog(r).Errorf("Failed fetching issue #%v, %v", number, err)
+		http.Error(w, fmt.Sprintf("Could not fetch issue: %v", err), http.StatusBadGateway)
+		return
+	}
+	requestLog(r).Infof("Resyncing issue #%v of %s/%s", number, owner, name)
+	start := time.Now()
+	repo := &github.Repository{
+		Owner: &github.User{Login: github.String(owner)},
+		Name:  github.String(name),
+	}
+	mon.resyncIssue(issue, repo, r.URL.Query().Get("triage") == "true", r)
+	w.Header().Set("Content-Type", "application/json")
+	summary := mon.decisions.since(fmt.Sprintf("%s/%s", owner, name), number, start)
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// adminRequest is the body of the manual board operations
+type adminRequest struct {
+	// Repo is the repository of the issue, as owner/name
+	Repo  string `json:"repo"`
+	Issue int    `json:"issue"`
+	// Label is the `{release}/{action}` label to apply
+	Label string `json:"label"`
+	// Project and Column are where to move the card
+	Project string `json:"project"`
+	Column  string `json:"column"`
+}
+
+// readAdminRequest decodes the body of a manual board operation and fetches
+// its issue, writing the error response when either fails
+func (mon *githubMonitor) readAdminRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (*adminRequest, *github.Issue, *github.Repository, bool) {
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	parts := strings.SplitN(req.Repo, "/", 2)
+	if len(parts) != 2 || req.Issue <= 0 {
+		http.Error(w, "Invalid request, expected repo as owner/name and an issue number", http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	owner, name := parts[0], parts[1]
+	issue, _, err := mon.clients.forOwner(owner).Issues.Get(ctx, owner, name, req.Issue)
+	if err != nil {
+		requestLog(r).Errorf("Failed fetching issue #%v, %v", req.Issue, err)
+		http.Error(w, fmt.Sprintf("Could not fetch issue: %v", err), http.StatusBadGateway)
+		return nil, nil, nil, false
+	}
+	repo := &github.Repository{
+		Owner: &github.User{Login: github.String(owner)},
+		Name:  github.String(name),
+	}
+	return &req, issue, repo, true
+}
+
+// handleAdminLabel applies a `{release}/{action}` label to an issue and
+// places its card right away, without waiting for the webhook of the label,
+// for when events were missed or the project was just created. The
+// decisions taken are returned like for handleResync.
+func (mon *githubMonitor) handleAdminLabel(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	req, issue, repo, ok := mon.readAdminRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if _, _, err := splitLabel(req.Label); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid label %q: %v", req.Label, err), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	applied := false
+	for _, label := range issue.Labels {
+		if label.GetName() == req.Label {
+			applied = true
+		}
+	}
+	if !applied {
+		requestLog(r).Infof("Adding label '%v' to issue #%v of %s", req.Label, req.Issue, req.Repo)
+		client := mon.clients.forOwner(*repo.Owner.Login)
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, *repo.Owner.Login, *repo.Name, req.Issue, []string{req.Label}); err != nil {
+			requestLog(r).Errorf("%q", err)
+			http.Error(w, fmt.Sprintf("Could not add label: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+	mon.handleLabelEvent(&github.IssuesEvent{
+		Action: github.String("labeled"),
+		Issue:  issue,
+		Label:  &github.Label{Name: github.String(req.Label)},
+		Repo:   repo,
+	}, r)
+	w.Header().Set("Content-Type", "application/json")
+	summary := mon.decisions.since(req.Repo, req.Issue, start)
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAdminMove moves the card of an issue to a column of a project by
+// name, creating the card when the issue has none, regardless of labels
+func (mon *githubMonitor) handleAdminMove(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	req, issue, repo, ok := mon.readAdminRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if req.Project == "" || req.Column == "" {
+		http.Error(w, "Invalid request, expected a project and a column", http.StatusBadRequest)
+		return
+	}
+	e := &github.IssuesEvent{Action: github.String("move"), Issue: issue, Repo: repo}
+	projects, err := mon.listProjects(e, "all")
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		http.Error(w, fmt.Sprintf("Could not list projects: %v", err), http.StatusBadGateway)
+		return
+	}
+	var project *github.Project
+	for _, p := range projects {
+		if strings.EqualFold(p.GetName(), req.Project) {
+			project = p
+		}
+	}
+	if project == nil {
+		http.Error(w, fmt.Sprintf("No project named %s", req.Project), http.StatusNotFound)
+		return
+	}
+	client := mon.clients.forOwner(*repo.Owner.Login)
+	card, column, columns, err := findCard(ctx, client, project, e)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		http.Error(w, fmt.Sprintf("Could not find the card: %v", err), http.StatusBadGateway)
+		return
+	}
+	var target *github.ProjectColumn
+	for _, c := range columns {
+		if *c.Name == req.Column {
+			target = c
+		}
+	}
+	if target == nil {
+		http.Error(w, fmt.Sprintf("No column '%s' in %s", req.Column, *project.Name), http.StatusNotFound)
+		return
+	}
+	var result string
+	switch {
+	case card == nil:
+		requestLog(r).Infof("Creating card for issue #%v in project %v in column '%v'", req.Issue, *project.Name, *target.Name)
+		var created *github.ProjectCard
+		created, _, err = client.Projects.CreateProjectCard(ctx, *target.ID, &github.ProjectCardOptions{
+			ContentID:   *issue.ID,
+			ContentType: cardContentType(issue),
+		})
+		if err == nil {
+			err = positionNewCard(ctx, client, created, *target.ID, mon.config.cardPosition(req.Repo, *target.Name), r)
+		}
+		result = fmt.Sprintf("created in %v/%v", *project.Name, *target.Name)
+	case *column.ID == *target.ID:
+		result = fmt.Sprintf("skipped: already in %v/%v", *project.Name, *target.Name)
+	default:
+		requestLog(r).Infof("Moving issue #%v in project %v from '%v' to '%v'", req.Issue, *project.Name, *column.Name, *target.Name)
+		err = moveCard(ctx, client, *card.ID, *target.ID, mon.config.cardPosition(req.Repo, *target.Name), r)
+		result = fmt.Sprintf("moved from %v to %v in %v", *column.Name, *target.Name, *project.Name)
+	}
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		http.Error(w, fmt.Sprintf("Could not move the card: %v", err), http.StatusBadGateway)
+		return
+	}
+	mon.record(e, "move", result)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"result": result}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// eventTime returns when the subject of an event was last updated, false for
+// events carrying no timestamp
+func eventTime(event interface{}) (time.Time, bool) {
+	switch e := event.(type) {
+	case *github.IssuesEvent:
+		if e.Issue != nil && e.Issue.UpdatedAt != nil {
+			return *e.Issue.UpdatedAt, true
+		}
+	case *github.PullRequestEvent:
+		if e.PullRequest != nil && e.PullRequest.UpdatedAt != nil {
+			return *e.PullRequest.UpdatedAt, true
+		}
+	case *github.ProjectCardEvent:
+		if e.ProjectCard != nil && e.ProjectCard.UpdatedAt != nil {
+			return e.ProjectCard.UpdatedAt.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isStale reports whether an event is older than `maxEventAge`, events without
+// a timestamp are never stale
+func (c *config) isStale(event interface{}, now time.Time) (time.Duration, bool) {
+	if c.MaxEventAge <= 0 {
+		return 0, false
+	}
+	updated, ok := eventTime(event)
+	if !ok {
+		return 0, false
+	}
+	age := now.Sub(updated)
+	return age, age > c.MaxEventAge
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// allowsRepo reports whether the bot acts on a repository, as owner/name.
+// Every repository is allowed when AllowedRepos is empty.
+func (c *config) allowsRepo(repo string) bool {
+	if len(c.AllowedRepos) == 0 {
+		return true
+	}
+	repo = strings.ToLower(repo)
+	for _, pattern := range c.AllowedRepos {
+		if matched, _ := path.Match(strings.ToLower(pattern), repo); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validAllowedRepos checks that every allowed repository is an `owner/name`
+// or `owner/*` pattern
+func validAllowedRepos(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.Count(pattern, "/") != 1 {
+			return fmt.Errorf("Invalid allowed repo %q, expected owner/name or owner/*", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid allowed repo %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
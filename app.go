@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// appConfig authenticates as a GitHub App with installation tokens instead of
+// a personal access token
+type appConfig struct {
+	// ID is the app ID from the settings page of the app, app authentication
+	// is disabled when 0
+	ID int `yaml:"id" json:"id"`
+	// PrivateKeyFile is the path to a PEM private key of the app
+	PrivateKeyFile string `yaml:"privateKeyFile" json:"privateKeyFile"`
+}
+
+const (
+	// appPreview is the media type the app endpoints need
+	appPreview = "application/vnd.github.machine-man-preview+json"
+	// appJWTLifetime is how long app JWTs are valid, GitHub allows at most
+	// 10 minutes
+	appJWTLifetime = 9 * time.Minute
+)
+
+// githubApp mints installation tokens for the owners that installed the app
+type githubApp struct {
+	id     int
+	key    *rsa.PrivateKey
+	client *github.Client
+
+	mu sync.Mutex
+	// installations maps lower cased owners to their installation ID
+	installations map[string]int
+}
+
+// newGithubApp loads the private key of the app, nil when app authentication
+// is disabled
+func newGithubApp(cfg appConfig, urls githubURLs) (*githubApp, error) {
+	if cfg.ID == 0 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read private key of app %d: %v", cfg.ID, err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid private key of app %d: %v", cfg.ID, err)
+	}
+	app := &githubApp{
+		id:            cfg.ID,
+		key:           key,
+		installations: make(map[string]int),
+	}
+	app.client = github.NewClient(&http.Client{Transport: &appTransport{app: app, base: http.DefaultTransport}})
+	if err := urls.configure(app.client); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// parsePrivateKey decodes a PKCS #1 or PKCS #8 RSA private key in PEM
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// jwt returns a JSON web token authenticating as the app itself. It is issued
+// a minute in the past to allow for clock drift.
+func (a *githubApp) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": a.id,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appTransport authenticates requests as the app
+type appTransport struct {
+	app  *githubApp
+	base http.RoundTripper
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrippers must not modify the request they are given
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = make(http.Header)
+	for key, values := range req.Header {
+		authenticated.Header[key] = values
+	}
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(authenticated)
+}
+
+// installationID returns the ID of the installation of the app for owner
+func (a *githubApp) installationID(ctx context.Context, owner string) (int, error) {
+	key := strings.ToLower(owner)
+	a.mu.Lock()
+	id, ok := a.installations[key]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		installations, resp, err := a.client.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return 0, err
+		}
+		a.mu.Lock()
+		for _, installation := range installations {
+			if installation.Account != nil {
+				a.installations[strings.ToLower(installation.Account.GetLogin())] = installation.GetID()
+			}
+		}
+		id, ok = a.installations[key]
+		a.mu.Unlock()
+		if ok {
+			return id, nil
+		}
+		if resp.NextPage == 0 {
+			return 0, fmt.Errorf("App %d is not installed for %s", a.id, owner)
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// installationToken is the body of the access_tokens endpoint
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// installationTokenSource mints installation tokens for an owner
+type installationTokenSource struct {
+	ctx   context.Context
+	app   *githubApp
+	owner string
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	id, err := s.app.installationID(s.ctx, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.app.client.NewRequest("POST", fmt.Sprintf("app/installations/%d/access_tokens", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", appPreview)
+	var token installationToken
+	if _, err := s.app.client.Do(s.ctx, req, &token); err != nil {
+		return nil, fmt.Errorf("Could not create installation token for %s: %v", s.owner, err)
+	}
+	return &oauth2.Token{AccessToken: token.Token, Expiry: token.ExpiresAt}, nil
+}
+
+// tokenSource returns installation tokens for owner, minting a new one
+// shortly before the current one expires
+func (a *githubApp) tokenSource(ctx context.Context, owner string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &installationTokenSource{ctx: ctx, app: a, owner: owner})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// auditConfig enables an audit log line for every webhook delivery, including
+// rejected ones, for security monitoring
+type auditConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Path persists deliveries and the decisions taken for them as JSON
+	// lines, which GET /audit queries. Disabled when empty.
+	Path string `yaml:"path" json:"path"`
+	// MaxSizeMB is the size in megabytes the file at Path is rotated at,
+	// 100 by default. One rotated file is kept.
+	MaxSizeMB int `yaml:"maxSizeMB" json:"maxSizeMB"`
+	// TrustedProxies lists the addresses or CIDR ranges of proxies whose
+	// X-Forwarded-For header is trusted to find the source address
+	TrustedProxies []string `yaml:"trustedProxies" json:"trustedProxies"`
+}
+
+// maxSize returns the size in bytes the audit log is rotated at
+func (c auditConfig) maxSize() int64 {
+	if c.MaxSizeMB <= 0 {
+		return 100 << 20
+	}
+	return int64(c.MaxSizeMB) << 20
+}
+
+// trusts reports whether ip is one of the trusted proxies
+func (c auditConfig) trusts(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range c.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			_, network, err := net.ParseCIDR(proxy)
+			if err == nil && network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP returns the address a request came from. X-Forwarded-For is only
+// followed through trusted proxies, its first untrusted entry from the right
+// is the source.
+func (c auditConfig) sourceIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !c.trusts(ip) {
+		return ip
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !c.trusts(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// deliveryAudit collects the metadata of a webhook delivery while it is
+// handled
+type deliveryAudit struct {
+	body *countingReader
+	// signature is one of unchecked, valid, invalid or skipped
+	signature string
+	status    int
+	// repo, issue, sender and action are those of the event, once parsed
+	repo   string
+	issue  int
+	sender string
+	action string
+}
+
+// auditDelivery starts the audit of a webhook delivery, counting the bytes of
+// its payload as they are read
+func (mon *githubMonitor) auditDelivery(r *http.Request) *deliveryAudit {
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+	return &deliveryAudit{body: body, signature: "unchecked", status: http.StatusOK}
+}
+
+// logAudit emits the audit entry of a delivery when auditing is enabled, and
+// adds it to the audit log
+func (mon *githubMonitor) logAudit(audit *deliveryAudit, r *http.Request) {
+	mon.auditLog.add(auditRecord{
+		Time:     time.Now(),
+		Kind:     "delivery",
+		Delivery: github.DeliveryID(r),
+		Event:    github.WebHookType(r),
+		Repo:     audit.repo,
+		Issue:    audit.issue,
+		Sender:   audit.sender,
+		Action:   audit.action,
+		Outcome:  "signature " + audit.signature,
+		Status:   audit.status,
+	})
+	if !mon.config.Audit.Enabled {
+		return
+	}
+	requestLog(r).Infof(
+		"Audit source=%s event=%q delivery=%q bytes=%d signature=%s status=%d",
+		mon.config.Audit.sourceIP(r),
+		github.WebHookType(r),
+		r.Header.Get("X-GitHub-Delivery"),
+		audit.body.n,
+		audit.signature,
+		audit.status,
+	)
+}
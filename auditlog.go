@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// auditRecord is an entry of the audit log, a webhook delivery or a decision
+// the bot took, including the changes it made on GitHub
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	// Kind is delivery or decision
+	Kind     string `json:"kind"`
+	Delivery string `json:"delivery,omitempty"`
+	Event    string `json:"event,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+	Issue    int    `json:"issue,omitempty"`
+	Sender   string `json:"sender,omitempty"`
+	Action   string `json:"action,omitempty"`
+	Outcome  string `json:"outcome,omitempty"`
+	Status   int    `json:"status,omitempty"`
+}
+
+// auditLog appends audit records to a file as JSON lines so they survive
+// restarts, and reads them back for GET /audit. The file is rotated to
+// `{path}.1` once it reaches maxSize, replacing the previous rotated file.
+// Queries scan both files, there is no index since SQLite isn't vendored.
+type auditLog struct {
+	path    string
+	maxSize int64
+
+	// mu guards writes, queries read the files without it
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openAuditLog(path string, maxSize int64) (*auditLog, error) {
+	l := &auditLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the file for appending, l.mu must be held
+func (l *auditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the file to `{path}.1` and starts a new one, l.mu must be held
+func (l *auditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// add appends a record, it does nothing when the audit log is disabled
+func (l *auditLog) add(record auditRecord) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Could not encode audit record: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.file.Write(append(line, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		log.Errorf("Could not write audit record: %v", err)
+		return
+	}
+	if l.maxSize > 0 && l.size >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Errorf("Could not rotate the audit log: %v", err)
+		}
+	}
+}
+
+// auditFilter selects audit records, zero fields match every record
+type auditFilter struct {
+	repo  string
+	issue int
+	since time.Time
+	until time.Time
+}
+
+func (f auditFilter) matches(record auditRecord) bool {
+	if f.repo != "" && !strings.EqualFold(f.repo, record.Repo) {
+		return false
+	}
+	if f.issue != 0 && f.issue != record.Issue {
+		return false
+	}
+	if !f.since.IsZero() && record.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && record.Time.After(f.until) {
+		return false
+	}
+	return true
+}
+
+// query returns the records matching filter, oldest first. The files are
+// opened under the lock so a rotation can't come in between, and read
+// without it so webhooks being recorded don't wait on the scan.
+func (l *auditLog) query(filter auditFilter) ([]auditRecord, error) {
+	var files []*os.File
+	l.mu.Lock()
+	for _, path := range []string{l.path + ".1", l.path} {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			l.mu.Unlock()
+			closeAll(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	l.mu.Unlock()
+	defer closeAll(files)
+	records := []auditRecord{}
+	for _, file := range files {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var record auditRecord
+			// the last line can be half written
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+			if filter.matches(record) {
+				records = append(records, record)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func closeAll(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// parseAuditFilter reads the repo, issue, since and until query parameters,
+// times being RFC 3339
+func parseAuditFilter(r *http.Request) (auditFilter, error) {
+	query := r.URL.Query()
+	filter := auditFilter{repo: query.Get("repo")}
+	var err error
+	if issue := query.Get("issue"); issue != "" {
+		if filter.issue, err = strconv.Atoi(issue); err != nil {
+			return filter, fmt.Errorf("Invalid issue %q", issue)
+		}
+	}
+	if since := query.Get("since"); since != "" {
+		if filter.since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, fmt.Errorf("Invalid since %q, expected an RFC 3339 time", since)
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, fmt.Errorf("Invalid until %q, expected an RFC 3339 time", until)
+		}
+	}
+	return filter, nil
+}
+
+// handleAudit returns the audit records matching the query parameters, to
+// find out why the bot moved a card
+func (mon *githubMonitor) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if mon.auditLog == nil {
+		http.Error(w, "The audit log is disabled", http.StatusNotFound)
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, err := mon.auditLog.query(filter)
+	if err != nil {
+		requestLog(r).Errorf("Could not read the audit log, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// describe fills in the repository, issue, sender and action of the event of
+// a delivery
+func (a *deliveryAudit) describe(event interface{}) {
+	if repo := eventRepository(event); repo != nil {
+		a.repo = repoFullName(repo)
+	}
+	switch e := event.(type) {
+	case *github.IssuesEvent:
+		a.issue, a.sender, a.action = e.Issue.GetNumber(), e.Sender.GetLogin(), e.GetAction()
+	case *github.PullRequestEvent:
+		a.issue, a.sender, a.action = e.PullRequest.GetNumber(), e.Sender.GetLogin(), e.GetAction()
+	case *github.IssueCommentEvent:
+		a.issue, a.sender, a.action = e.Issue.GetNumber(), e.Sender.GetLogin(), e.GetAction()
+	case *github.ProjectCardEvent:
+		_, _, a.issue, _ = parseContentURL(e.ProjectCard.GetContentURL())
+		a.sender, a.action = e.Sender.GetLogin(), e.GetAction()
+	case *github.LabelEvent:
+		a.action = e.GetAction()
+	case *github.ReleaseEvent:
+		a.sender, a.action = e.Sender.GetLogin(), e.GetAction()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// authLimitConfig rejects sources with too many webhook signature failures,
+// which usually means someone is probing for the secret
+type authLimitConfig struct {
+	// MaxFailures is how many failures a source may have within Window
+	// before being rejected, unlimited when 0
+	MaxFailures int `yaml:"maxFailures" json:"maxFailures"`
+	// Window is how long failures are remembered, 1m by default
+	Window time.Duration `yaml:"window" json:"window"`
+}
+
+const defaultAuthFailureWindow = time.Minute
+
+func (c authLimitConfig) window() time.Duration {
+	if c.Window <= 0 {
+		return defaultAuthFailureWindow
+	}
+	return c.Window
+}
+
+// authFailures counts signature failures per source address in fixed windows
+type authFailures struct {
+	mu      sync.Mutex
+	sources map[string]*authFailureWindow
+}
+
+type authFailureWindow struct {
+	start time.Time
+	count int
+}
+
+// add records a failure from source
+func (f *authFailures) add(source string, window time.Duration, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sources == nil {
+		f.sources = make(map[string]*authFailureWindow)
+	}
+	for address, w := range f.sources {
+		if now.Sub(w.start) >= window {
+			delete(f.sources, address)
+		}
+	}
+	w, ok := f.sources[source]
+	if !ok {
+		w = &authFailureWindow{start: now}
+		f.sources[source] = w
+	}
+	w.count++
+}
+
+// exceeded reports whether source used up its max failures in the current
+// window, so its next deliveries are rejected until the window ends
+func (f *authFailures) exceeded(source string, max int, window time.Duration, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w, ok := f.sources[source]
+	if !ok || now.Sub(w.start) >= window {
+		return false
+	}
+	return w.count >= max
+}
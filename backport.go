@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// backportConfig opens backport pull requests for merged pull requests
+// labeled `{release}/{action}`
+type backportConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Action is the label action asking for a backport, `cherry-pick` by
+	// default
+	Action string `yaml:"action" json:"action"`
+	// DoneAction replaces Action once the backport is opened,
+	// `cherry-picked` by default
+	DoneAction string `yaml:"doneAction" json:"doneAction"`
+	// Branch is the template of the release branch backports are opened
+	// against, rendered like column names with the label prefix. The label
+	// prefix itself by default.
+	Branch string `yaml:"branch" json:"branch"`
+}
+
+// action returns the label action asking for a backport
+func (c backportConfig) action() string {
+	if c.Action == "" {
+		return "cherry-pick"
+	}
+	return c.Action
+}
+
+// doneAction returns the label action of backported pull requests
+func (c backportConfig) doneAction() string {
+	if c.DoneAction == "" {
+		return "cherry-picked"
+	}
+	return c.DoneAction
+}
+
+// backportsService cherry-picks commits and opens the backport pull requests
+type backportsService interface {
+	BranchExists(ctx context.Context, owner, repo, branch string) (bool, *github.Response, error)
+	CherryPick(ctx context.Context, owner, repo, base, branch, sha string) (*github.Response, error)
+	CreatePullRequest(ctx context.Context, owner, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error)
+	BranchPullRequest(ctx context.Context, owner, repo, branch string) (*github.PullRequest, *github.Response, error)
+	BranchOnBase(ctx context.Context, owner, repo, base, branch string) (bool, *github.Response, error)
+	DeleteBranch(ctx context.Context, owner, repo, branch string) (*github.Response, error)
+}
+
+// backportsClient cherry-picks with the Git data API, without a clone
+type backportsClient struct {
+	client *github.Client
+}
+
+// BranchExists reports whether a repository has a branch
+func (c *backportsClient) BranchExists(ctx context.Context, owner, repo, branch string) (bool, *github.Response, error) {
+	_, resp, err := c.client.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if isNotFound(err) {
+		return false, resp, nil
+	}
+	return err == nil, resp, err
+}
+
+// CherryPick creates branch from the head of base with the changes of commit
+// sha applied on top. The Git data API can't cherry-pick, so sha is merged
+// into a temporary commit of the base tree whose parent is the first parent
+// of sha, which brings in the changes of sha alone, and the merged tree is
+// then committed on top of base. The branch is deleted again when any step
+// fails, so it never points to anything but a finished cherry-pick.
+func (c *backportsClient) CherryPick(ctx context.Context, owner, repo, base, branch, sha string) (*github.Response, error) {
+	baseRef, resp, err := c.client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		return resp, err
+	}
+	head, resp, err := c.client.Git.GetCommit(ctx, owner, repo, baseRef.Object.GetSHA())
+	if err != nil {
+		return resp, err
+	}
+	commit, resp, err := c.client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return resp, err
+	}
+	if len(commit.Parents) == 0 {
+		return nil, fmt.Errorf("Commit %s has no parent to cherry-pick it from", sha)
+	}
+	sibling, resp, err := c.client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String("Temporary commit for a cherry-pick of " + sha),
+		Tree:    head.Tree,
+		Parents: []github.Commit{{SHA: commit.Parents[0].SHA}},
+	})
+	if err != nil {
+		return resp, err
+	}
+	ref := "refs/heads/" + branch
+	if _, resp, err := c.client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: sibling.SHA},
+	}); err != nil {
+		return resp, err
+	}
+	merged, resp, err := c.client.Repositories.Merge(ctx, owner, repo, &github.RepositoryMergeRequest{
+		Base: github.String(branch),
+		Head: github.String(sha),
+	})
+	if err == nil && merged.GetSHA() == "" {
+		err = fmt.Errorf("Commit %s has no changes to cherry-pick onto %s", sha, base)
+	}
+	if err != nil {
+		c.abandon(ctx, owner, repo, branch)
+		return resp, err
+	}
+	picked, resp, err := c.client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("%s\n\n(cherry picked from commit %s)", commit.GetMessage(), sha)),
+		Author:  commit.Author,
+		Tree:    merged.Commit.Tree,
+		Parents: []github.Commit{{SHA: head.SHA}},
+	})
+	if err != nil {
+		c.abandon(ctx, owner, repo, branch)
+		return resp, err
+	}
+	if _, resp, err = c.client.Git.UpdateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: picked.SHA},
+	}, true); err != nil {
+		c.abandon(ctx, owner, repo, branch)
+		return resp, err
+	}
+	return resp, nil
+}
+
+// abandon deletes the branch of a failed cherry-pick
+func (c *backportsClient) abandon(ctx context.Context, owner, repo, branch string) {
+	if _, err := c.DeleteBranch(ctx, owner, repo, branch); err != nil {
+		log.Errorf("Could not delete branch %s of a failed cherry-pick in %s/%s, %v", branch, owner, repo, err)
+	}
+}
+
+// DeleteBranch deletes a branch
+func (c *backportsClient) DeleteBranch(ctx context.Context, owner, repo, branch string) (*github.Response, error) {
+	return c.client.Git.DeleteRef(ctx, owner, repo, "heads/"+branch)
+}
+
+// BranchOnBase reports whether the head of branch is a single commit on top
+// of the current head of base, as left by a finished cherry-pick
+func (c *backportsClient) BranchOnBase(ctx context.Context, owner, repo, base, branch string) (bool, *github.Response, error) {
+	baseRef, resp, err := c.client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		return false, resp, err
+	}
+	branchRef, resp, err := c.client.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil {
+		return false, resp, err
+	}
+	head, resp, err := c.client.Git.GetCommit(ctx, owner, repo, branchRef.Object.GetSHA())
+	if err != nil {
+		return false, resp, err
+	}
+	return len(head.Parents) == 1 && head.Parents[0].GetSHA() == baseRef.Object.GetSHA(), resp, nil
+}
+
+// CreatePullRequest opens a pull request
+func (c *backportsClient) CreatePullRequest(ctx context.Context, owner, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+	return c.client.PullRequests.Create(ctx, owner, repo, pull)
+}
+
+// BranchPullRequest returns a pull request opened from a branch of the
+// repository, open or not, nil when there is none
+func (c *backportsClient) BranchPullRequest(ctx context.Context, owner, repo, branch string) (*github.PullRequest, *github.Response, error) {
+	pulls, resp, err := c.client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "all",
+		Head:  owner + ":" + branch,
+	})
+	if err != nil || len(pulls) == 0 {
+		return nil, resp, err
+	}
+	return pulls[0], resp, nil
+}
+
+// backportBranch returns the release branch of a label prefix
+func (c *config) backportBranch(prefix string) (string, error) {
+	if c.Backports.Branch == "" {
+		return prefix, nil
+	}
+	return renderColumnName(c.Backports.Branch, columnNameData{Prefix: prefix})
+}
+
+// backport cherry-picks the merge commit of a pull request onto the release
+// branch of a label prefix, opens the backport pull request and swaps the
+// `{release}/{action}` label for the done action. Backports whose branch
+// already has a pull request are left alone. A branch without one is what a
+// failed attempt left behind: it gets its pull request when it still sits on
+// the head of the release branch, otherwise the cherry-pick is redone.
+func (mon *githubMonitor) backport(e *github.IssuesEvent, pr *github.PullRequest, prefix string, r *http.Request) error {
+	base, err := mon.config.backportBranch(prefix)
+	if err != nil {
+		return err
+	}
+	owner, repo := *e.Repo.Owner.Login, *e.Repo.Name
+	branch := fmt.Sprintf("backport-%d-to-%s", pr.GetNumber(), base)
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(owner)
+	exists, _, err := client.Backports.BranchExists(ctx, owner, repo, branch)
+	if err != nil {
+		return err
+	}
+	if exists {
+		pull, _, err := client.Backports.BranchPullRequest(ctx, owner, repo, branch)
+		if err != nil {
+			return err
+		}
+		if pull != nil {
+			mon.record(e, "backport", fmt.Sprintf("skipped: #%v was already opened from %v", pull.GetNumber(), branch))
+			return nil
+		}
+		onBase, _, err := client.Backports.BranchOnBase(ctx, owner, repo, base, branch)
+		if err != nil {
+			return err
+		}
+		if onBase {
+			requestLog(r).Infof("Branch %v has no pull request yet, opening it", branch)
+		} else {
+			requestLog(r).Warnf("Branch %v is not a cherry-pick onto the head of %v, deleting it", branch, base)
+			if _, err := client.Backports.DeleteBranch(ctx, owner, repo, branch); err != nil {
+				return err
+			}
+			exists = false
+		}
+	}
+	if !exists {
+		requestLog(r).Infof("Cherry-picking %v of pull request #%v onto %v", pr.GetMergeCommitSHA(), pr.GetNumber(), base)
+		if _, err := client.Backports.CherryPick(ctx, owner, repo, base, branch, pr.GetMergeCommitSHA()); err != nil {
+			return err
+		}
+	}
+	backport, _, err := client.Backports.CreatePullRequest(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("[%s] %s", base, pr.GetTitle())),
+		Head:  github.String(branch),
+		Base:  github.String(base),
+		Body:  github.String(fmt.Sprintf("Backport of #%d to %s.", pr.GetNumber(), base)),
+	})
+	if err != nil {
+		return err
+	}
+	mon.record(e, "backport", fmt.Sprintf("opened #%v against %v", backport.GetNumber(), base))
+	// the pull request is merged, so closed, and the webhook of the done
+	// label skips it with skipClosedIssues: the card is moved here instead
+	mon.placeBackported(ctx, client, e, prefix, r)
+	done := fmt.Sprintf("%s/%s", prefix, mon.config.Backports.doneAction())
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), []string{done}); err != nil {
+		return err
+	}
+	label := fmt.Sprintf("%s/%s", prefix, mon.config.Backports.action())
+	if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), label); err != nil {
+		return err
+	}
+	mon.record(e, "backport", fmt.Sprintf("replaced label %v with %v", label, done))
+	return nil
+}
+
+// placeBackported moves the card of a backported pull request to the column
+// of the done action in the boards of a label prefix
+func (mon *githubMonitor) placeBackported(ctx context.Context, client *githubClient, e *github.IssuesEvent, prefix string, r *http.Request) {
+	done := mon.config.Backports.doneAction()
+	columnName, known, err := mon.config.columnName(repoFullName(e.Repo), prefix, done)
+	if err != nil {
+		requestLog(r).Errorf("Could not render the column of action '%v', %v", done, err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		return
+	}
+	if !known {
+		columnName = done
+	}
+	if mon.config.ProjectsV2.Enabled {
+		mon.handleProjectV2Label(ctx, client, e, prefix, columnName, r)
+		return
+	}
+	projects, err := mon.getProjects(prefix, e)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("skipped: %v", err))
+		return
+	}
+	placement := labelPlacement{
+		labelSuffix: done,
+		columnName:  columnName,
+		action:      mon.config.Actions[strings.ToLower(done)],
+	}
+	for _, project := range projects {
+		mon.placeCard(ctx, client, e, project, placement, r)
+	}
+}
+
+// backportLabeled opens the backport asked for by the label of a merged pull
+// request. This runs alongside handleLabelEvent, which counts the event in
+// the stats.
+func (mon *githubMonitor) backportLabeled(e *github.IssuesEvent, pr *github.PullRequest, r *http.Request) {
+	prefix, action, err := splitLabel(e.Label.GetName())
+	if err != nil || action != mon.config.Backports.action() {
+		return
+	}
+	if err := mon.backport(e, pr, prefix, r); err != nil {
+		requestLog(r).Errorf("Failed backporting pull request #%v to %v, %v", pr.GetNumber(), prefix, err)
+		mon.record(e, "backport", fmt.Sprintf("error: %v", err))
+	}
+}
+
+// Pull requests labeled for a backport before they were merged are
+// backported once merged.
+func (mon *githubMonitor) handlePullRequestMergedEvent(e *github.PullRequestEvent, payload []byte, r *http.Request) {
+	var extra pullRequestPayload
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		requestLog(r).Errorf("Failed to parse pull request, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	ie := issuesEventForPullRequest(e, extra.PullRequest.Labels)
+	backported := false
+	for _, label := range extra.PullRequest.Labels {
+		prefix, action, err := splitLabel(label.GetName())
+		if err != nil || action != mon.config.Backports.action() {
+			continue
+		}
+		if err := mon.backport(ie, e.PullRequest, prefix, r); err != nil {
+			requestLog(r).Errorf("Failed backporting pull request #%v to %v, %v", *e.PullRequest.Number, prefix, err)
+			mon.record(ie, "backport", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		backported = true
+	}
+	if backported {
+		mon.stats.processed.inc()
+	} else {
+		mon.stats.ignored.inc()
+	}
+}
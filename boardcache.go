@@ -0,0 +1,677 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// boardCacheConfig keeps the projects, columns and cards of boards in memory,
+// kept up to date by project, project_column and project_card webhooks, so
+// finding the card of an issue doesn't scan its board on every event
+type boardCacheConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Path persists the cache on shutdown and loads it back on startup, the
+	// cache starts empty when it is empty
+	Path string `yaml:"path" json:"path"`
+	// MaxAge is how old a persisted cache can be to be loaded, since the
+	// webhooks sent while the bot was down are missing from it. 10 minutes
+	// by default.
+	MaxAge time.Duration `yaml:"maxAge" json:"maxAge"`
+	// ListMaxAge is how long a cached list of projects, columns or cards is
+	// used before it is fetched again, in case a webhook was missed. 5
+	// minutes by default.
+	ListMaxAge time.Duration `yaml:"listMaxAge" json:"listMaxAge"`
+}
+
+func (c boardCacheConfig) maxAge() time.Duration {
+	if c.MaxAge <= 0 {
+		return 10 * time.Minute
+	}
+	return c.MaxAge
+}
+
+func (c boardCacheConfig) listMaxAge() time.Duration {
+	if c.ListMaxAge <= 0 {
+		return 5 * time.Minute
+	}
+	return c.ListMaxAge
+}
+
+// boardCache holds the boards the bot looked at. Lists are cached whole, the
+// first time they are fetched, and dropped whenever a webhook or a change
+// made by the bot can't be applied to them, or once they are older than
+// listMaxAge, so they are fetched again.
+type boardCache struct {
+	// listMaxAge is how long lists are used after they were fetched
+	listMaxAge time.Duration
+
+	mu sync.Mutex
+	// projects are the project lists of repositories and organizations, by
+	// projectListKey
+	projects map[string][]*github.Project
+	// columns are the columns of projects, by project ID
+	columns map[int][]*github.ProjectColumn
+	// cards are the cards of columns from top to bottom, by column ID
+	cards map[int][]*github.ProjectCard
+	// cardColumns maps the cached cards to their column
+	cardColumns map[int]int
+	// contentCards maps issue URLs to their cached cards
+	contentCards map[string]map[int]bool
+	// fetched is when the lists were fetched, by listKey
+	fetched map[string]time.Time
+}
+
+// listKey is the key of a cached list in fetched, like `cards 367`
+func listKey(kind string, id interface{}) string {
+	return fmt.Sprintf("%s %v", kind, id)
+}
+
+// fresh reports whether a list was fetched less than listMaxAge ago, c.mu
+// must be held
+func (c *boardCache) fresh(key string) bool {
+	return time.Since(c.fetched[key]) < c.listMaxAge
+}
+
+// boardCacheFile is the persisted boardCache
+type boardCacheFile struct {
+	SavedAt  time.Time                       `json:"savedAt"`
+	Projects map[string][]*github.Project    `json:"projects"`
+	Columns  map[int][]*github.ProjectColumn `json:"columns"`
+	Cards    map[int][]*github.ProjectCard   `json:"cards"`
+}
+
+func newBoardCache(listMaxAge time.Duration) *boardCache {
+	return &boardCache{
+		listMaxAge:   listMaxAge,
+		fetched:      make(map[string]time.Time),
+		projects:     make(map[string][]*github.Project),
+		columns:      make(map[int][]*github.ProjectColumn),
+		cards:        make(map[int][]*github.ProjectCard),
+		cardColumns:  make(map[int]int),
+		contentCards: make(map[string]map[int]bool),
+	}
+}
+
+// loadBoardCache returns the cache persisted at cfg.Path, or an empty cache
+// when there is none or it is older than cfg.MaxAge
+func loadBoardCache(cfg boardCacheConfig) (*boardCache, error) {
+	cache := newBoardCache(cfg.listMaxAge())
+	if cfg.Path == "" {
+		return cache, nil
+	}
+	data, err := ioutil.ReadFile(cfg.Path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file boardCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if age := time.Since(file.SavedAt); age > cfg.maxAge() {
+		log.Infof("Ignoring the board cache saved %v ago", age)
+		return cache, nil
+	}
+	for key, projects := range file.Projects {
+		cache.setProjectList(key, projects)
+	}
+	for projectID, columns := range file.Columns {
+		cache.setColumns(projectID, columns)
+	}
+	for columnID, cards := range file.Cards {
+		cache.setCards(columnID, cards)
+	}
+	// the lists are as old as the file
+	for key := range cache.fetched {
+		cache.fetched[key] = file.SavedAt
+	}
+	return cache, nil
+}
+
+// save writes the cache to a temporary file renamed over path
+func (c *boardCache) save(path string) error {
+	if c == nil || path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.Marshal(boardCacheFile{
+		SavedAt:  time.Now(),
+		Projects: c.projects,
+		Columns:  c.columns,
+		Cards:    c.cards,
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// projectListKey is the key of the projects of a repository, as owner/name,
+// or of an organization in a state
+func projectListKey(owner, state string) string {
+	return strings.ToLower(owner) + "|" + state
+}
+
+func (c *boardCache) projectList(key string) ([]*github.Project, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	projects, ok := c.projects[key]
+	if ok && !c.fresh(listKey("projects", key)) {
+		delete(c.projects, key)
+		return nil, false
+	}
+	return append([]*github.Project(nil), projects...), ok
+}
+
+func (c *boardCache) setProjectList(key string, projects []*github.Project) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.projects[key] = projects
+	c.fetched[listKey("projects", key)] = time.Now()
+}
+
+// forgetProjectLists drops the project lists of an owner and its repositories
+func (c *boardCache) forgetProjectLists(owner string) {
+	owner = strings.ToLower(owner)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.projects {
+		if strings.HasPrefix(key, owner+"/") || strings.HasPrefix(key, owner+"|") {
+			delete(c.projects, key)
+			delete(c.fetched, listKey("projects", key))
+		}
+	}
+}
+
+func (c *boardCache) projectColumns(projectID int) ([]*github.ProjectColumn, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	columns, ok := c.columns[projectID]
+	if ok && !c.fresh(listKey("columns", projectID)) {
+		delete(c.columns, projectID)
+		return nil, false
+	}
+	return append([]*github.ProjectColumn(nil), columns...), ok
+}
+
+func (c *boardCache) setColumns(projectID int, columns []*github.ProjectColumn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.columns[projectID] = columns
+	c.fetched[listKey("columns", projectID)] = time.Now()
+}
+
+// forgetColumns drops the columns of a project, and their cards with them
+// when the project is gone
+func (c *boardCache) forgetColumns(projectID int, withCards bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if withCards {
+		for _, column := range c.columns[projectID] {
+			c.forgetCards(*column.ID)
+		}
+	}
+	delete(c.columns, projectID)
+	delete(c.fetched, listKey("columns", projectID))
+}
+
+// addColumn appends a new column to the columns of its project when they are
+// cached, or updates its name when the column is already there
+func (c *boardCache) addColumn(projectID int, column *github.ProjectColumn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	columns, ok := c.columns[projectID]
+	if !ok {
+		return
+	}
+	for i, cached := range columns {
+		if *cached.ID == *column.ID {
+			columns[i] = column
+			return
+		}
+	}
+	c.columns[projectID] = append(columns, column)
+	if _, ok := c.cards[*column.ID]; !ok {
+		c.cards[*column.ID] = nil
+		c.fetched[listKey("cards", *column.ID)] = time.Now()
+	}
+}
+
+func (c *boardCache) columnCards(columnID int) ([]*github.ProjectCard, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cards, ok := c.cards[columnID]
+	if ok && !c.fresh(listKey("cards", columnID)) {
+		c.forgetCards(columnID)
+		return nil, false
+	}
+	return append([]*github.ProjectCard(nil), cards...), ok
+}
+
+// setCards caches the cards of a column, c.mu must not be held
+func (c *boardCache) setCards(columnID int, cards []*github.ProjectCard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forgetCards(columnID)
+	c.cards[columnID] = cards
+	c.fetched[listKey("cards", columnID)] = time.Now()
+	for _, card := range cards {
+		c.index(card, columnID)
+	}
+}
+
+// forgetCards drops the cards of a column, c.mu must be held
+func (c *boardCache) forgetCards(columnID int) {
+	for _, card := range c.cards[columnID] {
+		c.unindex(card)
+	}
+	delete(c.cards, columnID)
+	delete(c.fetched, listKey("cards", columnID))
+}
+
+func (c *boardCache) index(card *github.ProjectCard, columnID int) {
+	c.cardColumns[*card.ID] = columnID
+	if url := card.GetContentURL(); url != "" {
+		if c.contentCards[url] == nil {
+			c.contentCards[url] = make(map[int]bool)
+		}
+		c.contentCards[url][*card.ID] = true
+	}
+}
+
+func (c *boardCache) unindex(card *github.ProjectCard) {
+	delete(c.cardColumns, *card.ID)
+	if url := card.GetContentURL(); url != "" {
+		delete(c.contentCards[url], *card.ID)
+		if len(c.contentCards[url]) == 0 {
+			delete(c.contentCards, url)
+		}
+	}
+}
+
+// removeCard drops a card from its column, c.mu must be held. It returns the
+// cached card, nil when the card isn't cached.
+func (c *boardCache) removeCard(cardID int) *github.ProjectCard {
+	columnID, ok := c.cardColumns[cardID]
+	if !ok {
+		return nil
+	}
+	cards := c.cards[columnID]
+	for i, card := range cards {
+		if *card.ID == cardID {
+			c.cards[columnID] = append(cards[:i:i], cards[i+1:]...)
+			c.unindex(card)
+			return card
+		}
+	}
+	return nil
+}
+
+// placeCard puts a card in a column at a position of the REST API, top,
+// bottom or after:{card ID}, replacing the cached card with the same ID. The
+// column is dropped from the cache when the card can't be placed, like after
+// a card missing from it.
+func (c *boardCache) placeCard(card *github.ProjectCard, columnID int, position string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeCard(*card.ID)
+	cards, ok := c.cards[columnID]
+	if !ok {
+		return
+	}
+	at := -1
+	switch {
+	case position == "" || position == "top":
+		at = 0
+	case position == "bottom":
+		at = len(cards)
+	case strings.HasPrefix(position, "after:"):
+		afterID, _ := strconv.Atoi(strings.TrimPrefix(position, "after:"))
+		for i, cached := range cards {
+			if *cached.ID == afterID {
+				at = i + 1
+			}
+		}
+	}
+	if at < 0 {
+		c.forgetCards(columnID)
+		return
+	}
+	placed := append(cards[:at:at], card)
+	c.cards[columnID] = append(placed, cards[at:]...)
+	c.index(card, columnID)
+}
+
+// moveCard moves a cached card, the column is 0 for moves within the column.
+// The move updates the card on GitHub, so its UpdatedAt is set to now on a
+// copy, callers may still be reading the cached card.
+func (c *boardCache) moveCard(cardID, columnID int, position string) {
+	c.mu.Lock()
+	from, ok := c.cardColumns[cardID]
+	var card *github.ProjectCard
+	if ok {
+		card = c.removeCard(cardID)
+	}
+	if card != nil {
+		moved := *card
+		moved.UpdatedAt = &github.Timestamp{Time: time.Now()}
+		card = &moved
+	}
+	if columnID == 0 {
+		columnID = from
+	}
+	if card == nil {
+		// the card can't be placed without knowing what it is
+		c.forgetCards(columnID)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.placeCard(card, columnID, position)
+}
+
+// forgetColumnCards drops the cards of a column so they are fetched again
+func (c *boardCache) forgetColumnCards(columnID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forgetCards(columnID)
+}
+
+// forgetCardColumn drops the cards of the column of a cached card so they are
+// fetched again
+func (c *boardCache) forgetCardColumn(cardID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if columnID, ok := c.cardColumns[cardID]; ok {
+		c.forgetCards(columnID)
+	}
+}
+
+func (c *boardCache) deleteCard(cardID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeCard(cardID)
+}
+
+// issueCards returns the cards of an issue in columns, in their order, and
+// whether the cards of every column are cached
+func (c *boardCache) issueCards(columns []*github.ProjectColumn, issueURL string) ([]columnCard, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, column := range columns {
+		if _, ok := c.cards[*column.ID]; !ok || !c.fresh(listKey("cards", *column.ID)) {
+			return nil, false
+		}
+	}
+	var found []columnCard
+	for _, column := range columns {
+		for cardID := range c.contentCards[issueURL] {
+			if c.cardColumns[cardID] == *column.ID {
+				found = append(found, columnCard{
+					card:   &github.ProjectCard{ID: github.Int(cardID), ContentURL: github.String(issueURL)},
+					column: column,
+				})
+			}
+		}
+	}
+	return found, true
+}
+
+// apply updates the cache with a project, project_column or project_card
+// webhook. Webhooks of other events are ignored.
+func (c *boardCache) apply(event interface{}) {
+	if c == nil {
+		return
+	}
+	switch e := event.(type) {
+	case *github.ProjectEvent:
+		if e.Repo != nil && e.Repo.Owner != nil {
+			c.forgetProjectLists(e.Repo.Owner.GetLogin())
+		}
+		if org := e.Org.GetLogin(); org != "" {
+			c.forgetProjectLists(org)
+		}
+		if e.GetAction() == "deleted" && e.Project.GetID() != 0 {
+			c.forgetColumns(e.Project.GetID(), true)
+		}
+	case *github.ProjectColumnEvent:
+		column := e.ProjectColumn
+		if column.GetID() == 0 {
+			return
+		}
+		// project_url looks like https://api.github.com/projects/1002604
+		projectURL := column.GetProjectURL()
+		projectID, err := strconv.Atoi(projectURL[strings.LastIndex(projectURL, "/")+1:])
+		if err != nil {
+			return
+		}
+		switch e.GetAction() {
+		case "created", "edited":
+			c.addColumn(projectID, column)
+		default:
+			if e.GetAction() == "deleted" {
+				c.mu.Lock()
+				c.forgetCards(*column.ID)
+				c.mu.Unlock()
+			}
+			c.forgetColumns(projectID, false)
+		}
+	case *github.ProjectCardEvent:
+		card := e.ProjectCard
+		if card.GetID() == 0 {
+			return
+		}
+		switch e.GetAction() {
+		case "deleted":
+			c.deleteCard(*card.ID)
+		default:
+			position := "top"
+			if e.GetAfterID() != 0 {
+				position = "after:" + strconv.Itoa(e.GetAfterID())
+			}
+			c.placeCard(card, cardColumnID(card), position)
+		}
+	}
+}
+
+// cachedProjects reads columns and cards from the board cache, and updates it
+// with the changes made by the bot without waiting for their webhooks
+type cachedProjects struct {
+	projectsService
+	cache *boardCache
+}
+
+func (p cachedProjects) ListProjectColumns(ctx context.Context, projectID int, opt *github.ListOptions) ([]*github.ProjectColumn, *github.Response, error) {
+	if opt != nil && opt.Page > 1 {
+		return p.projectsService.ListProjectColumns(ctx, projectID, opt)
+	}
+	if columns, ok := p.cache.projectColumns(projectID); ok {
+		return columns, nil, nil
+	}
+	var columns []*github.ProjectColumn
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := p.projectsService.ListProjectColumns(ctx, projectID, &opt)
+		columns = append(columns, page...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	p.cache.setColumns(projectID, columns)
+	return append([]*github.ProjectColumn(nil), columns...), nil, nil
+}
+
+func (p cachedProjects) ListProjectCards(ctx context.Context, columnID int, opt *github.ListOptions) ([]*github.ProjectCard, *github.Response, error) {
+	if opt != nil && opt.Page > 1 {
+		return p.projectsService.ListProjectCards(ctx, columnID, opt)
+	}
+	if cards, ok := p.cache.columnCards(columnID); ok {
+		return cards, nil, nil
+	}
+	var cards []*github.ProjectCard
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := p.projectsService.ListProjectCards(ctx, columnID, &opt)
+		cards = append(cards, page...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	p.cache.setCards(columnID, cards)
+	return append([]*github.ProjectCard(nil), cards...), nil, nil
+}
+
+func (p cachedProjects) CreateProjectColumn(ctx context.Context, projectID int, opt *github.ProjectColumnOptions) (*github.ProjectColumn, *github.Response, error) {
+	column, resp, err := p.projectsService.CreateProjectColumn(ctx, projectID, opt)
+	if err == nil {
+		p.cache.addColumn(projectID, column)
+	}
+	return column, resp, err
+}
+
+// CreateProjectCard caches the new card at the top of its column, where
+// GitHub adds it
+func (p cachedProjects) CreateProjectCard(ctx context.Context, columnID int, opt *github.ProjectCardOptions) (*github.ProjectCard, *github.Response, error) {
+	card, resp, err := p.projectsService.CreateProjectCard(ctx, columnID, opt)
+	switch {
+	case err != nil:
+		p.cache.forgetColumnCards(columnID)
+	case card.GetID() != 0:
+		p.cache.placeCard(card, columnID, "top")
+	}
+	return card, resp, err
+}
+
+func (p cachedProjects) DeleteProjectCard(ctx context.Context, cardID int) (*github.Response, error) {
+	resp, err := p.projectsService.DeleteProjectCard(ctx, cardID)
+	if err == nil || isNotFound(err) {
+		p.cache.deleteCard(cardID)
+	} else {
+		p.cache.forgetCardColumn(cardID)
+	}
+	return resp, err
+}
+
+func (p cachedProjects) MoveProjectCard(ctx context.Context, cardID int, opt *github.ProjectCardMoveOptions) (*github.Response, error) {
+	resp, err := p.projectsService.MoveProjectCard(ctx, cardID, opt)
+	if err == nil {
+		p.cache.moveCard(cardID, opt.ColumnID, opt.Position)
+	} else {
+		// the cached card or column is likely stale, like a card deleted
+		// without the bot seeing its webhook
+		p.cache.forgetCardColumn(cardID)
+		p.cache.forgetColumnCards(opt.ColumnID)
+	}
+	return resp, err
+}
+
+// cachedRepositories reads the projects of repositories from the board cache
+type cachedRepositories struct {
+	repositoriesService
+	cache *boardCache
+}
+
+func (s cachedRepositories) ListProjects(ctx context.Context, owner, repo string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error) {
+	if opt != nil && opt.Page > 1 {
+		return s.repositoriesService.ListProjects(ctx, owner, repo, opt)
+	}
+	state := ""
+	if opt != nil {
+		state = opt.State
+	}
+	key := projectListKey(owner+"/"+repo, state)
+	if projects, ok := s.cache.projectList(key); ok {
+		return projects, nil, nil
+	}
+	var projects []*github.Project
+	err := paginate(func(listOpt github.ListOptions) (*github.Response, error) {
+		page, resp, err := s.repositoriesService.ListProjects(ctx, owner, repo, &github.ProjectListOptions{State: state, ListOptions: listOpt})
+		projects = append(projects, page...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.cache.setProjectList(key, projects)
+	return append([]*github.Project(nil), projects...), nil, nil
+}
+
+func (s cachedRepositories) CreateProject(ctx context.Context, owner, repo string, opt *github.ProjectOptions) (*github.Project, *github.Response, error) {
+	project, resp, err := s.repositoriesService.CreateProject(ctx, owner, repo, opt)
+	if err == nil {
+		s.cache.forgetProjectLists(owner)
+	}
+	return project, resp, err
+}
+
+// cachedOrganizations reads the projects of organizations from the board
+// cache
+type cachedOrganizations struct {
+	organizationsService
+	cache *boardCache
+}
+
+func (s cachedOrganizations) ListProjects(ctx context.Context, org string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error) {
+	if opt != nil && opt.Page > 1 {
+		return s.organizationsService.ListProjects(ctx, org, opt)
+	}
+	state := ""
+	if opt != nil {
+		state = opt.State
+	}
+	key := projectListKey(org, state)
+	if projects, ok := s.cache.projectList(key); ok {
+		return projects, nil, nil
+	}
+	var projects []*github.Project
+	err := paginate(func(listOpt github.ListOptions) (*github.Response, error) {
+		page, resp, err := s.organizationsService.ListProjects(ctx, org, &github.ProjectListOptions{State: state, ListOptions: listOpt})
+		projects = append(projects, page...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.cache.setProjectList(key, projects)
+	return append([]*github.Project(nil), projects...), nil, nil
+}
+
+// cachedBoards returns a copy of client reading boards through cache
+func cachedBoards(client *githubClient, cache *boardCache) *githubClient {
+	cached := *client
+	cached.Projects = cachedProjects{client.Projects, cache}
+	cached.Repositories = cachedRepositories{client.Repositories, cache}
+	cached.Orgs = cachedOrganizations{client.Orgs, cache}
+	cached.Boards = cache
+	return &cached
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// boardTemplateConfig is the standard layout of new release boards
+type boardTemplateConfig struct {
+	// Label creates a board named after the title of the issues it is
+	// applied to, like `release/new`. Disabled when empty.
+	Label string `yaml:"label" json:"label"`
+	// Columns are the columns of new boards, in order, `Triage`,
+	// `Cherry Pick`, `Cherry Picked` and `Done` by default
+	Columns []string `yaml:"columns" json:"columns"`
+	// Body is the description of new boards, a template rendered with the
+	// board name as .Name, for example `release-bot: {{.Name}}` when
+	// matching projects by body
+	Body string `yaml:"body" json:"body"`
+}
+
+// columns returns the columns of new boards
+func (c boardTemplateConfig) columns() []string {
+	if len(c.Columns) == 0 {
+		return []string{"Triage", "Cherry Pick", "Cherry Picked", "Done"}
+	}
+	return c.Columns
+}
+
+// body renders the description of a new board
+func (c boardTemplateConfig) body(name string) (string, error) {
+	tmpl, err := template.New("body").Parse(c.Body)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, struct{ Name string }{name}); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// createBoard creates a project named name in a repository with the columns
+// of the board template. Existing projects of that name are returned as is.
+func (mon *githubMonitor) createBoard(ctx context.Context, owner, repo, name string) (*github.Project, bool, error) {
+	client := mon.clients.forOwner(owner)
+	projects, err := listRepoProjects(ctx, client, owner, repo, "all")
+	if err != nil {
+		return nil, false, err
+	}
+	for _, project := range projects {
+		if project.GetName() == name {
+			return project, false, nil
+		}
+	}
+	body, err := mon.config.Boards.body(name)
+	if err != nil {
+		return nil, false, err
+	}
+	log.Infof("Creating project %s in %s/%s", name, owner, repo)
+	project, _, err := client.Repositories.CreateProject(ctx, owner, repo, &github.ProjectOptions{
+		Name: name,
+		Body: body,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, column := range mon.config.Boards.columns() {
+		if _, _, err := client.Projects.CreateProjectColumn(ctx, project.GetID(), &github.ProjectColumnOptions{Name: column}); err != nil {
+			return nil, false, fmt.Errorf("Could not create column %s of project %s: %v", column, name, err)
+		}
+	}
+	return project, true, nil
+}
+
+// When an issue gets the label of the board template, a board named after
+// the issue title, like `17.09.0-rc1`, is created in its repository.
+func (mon *githubMonitor) handleNewBoardLabel(e *github.IssuesEvent, r *http.Request) {
+	name := strings.TrimSpace(e.Issue.GetTitle())
+	if name == "" {
+		mon.record(e, "board", "skipped: issue has no title")
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	_, created, err := mon.createBoard(ctx, *e.Repo.Owner.Login, *e.Repo.Name, name)
+	if err != nil {
+		requestLog(r).Errorf("Failed creating project %s, %v", name, err)
+		mon.record(e, "board", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	if !created {
+		mon.record(e, "board", fmt.Sprintf("skipped: project %s already exists", name))
+		mon.stats.ignored.inc()
+		return
+	}
+	mon.record(e, "board", fmt.Sprintf("created project %s", name))
+	mon.stats.processed.inc()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// projectCardsService finds the cards of an issue without scanning boards
+type projectCardsService interface {
+	ListIssueCards(ctx context.Context, owner, repo string, number int) ([]issueCard, *github.Response, error)
+}
+
+// issueCard is a classic project card of an issue as the GraphQL API returns
+// it, with the database IDs the REST API uses
+type issueCard struct {
+	ID      int `json:"databaseId"`
+	Project struct {
+		ID int `json:"databaseId"`
+	} `json:"project"`
+	// Column is nil for cards not placed in a column yet
+	Column *struct {
+		ID int `json:"databaseId"`
+	} `json:"column"`
+}
+
+const issueCardsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue { projectCards(first: 100, after: $cursor, archivedStates: [NOT_ARCHIVED]) { ...cards } }
+      ... on PullRequest { projectCards(first: 100, after: $cursor, archivedStates: [NOT_ARCHIVED]) { ...cards } }
+    }
+  }
+}
+fragment cards on ProjectCardConnection {
+  nodes { databaseId project { databaseId } column { databaseId } }
+  pageInfo { hasNextPage endCursor }
+}`
+
+// ListIssueCards returns every card of an issue or pull request across
+// projects in as many round trips as there are pages of 100 cards
+func (c *graphqlClient) ListIssueCards(ctx context.Context, owner, repo string, number int) ([]issueCard, *github.Response, error) {
+	variables := map[string]interface{}{"owner": owner, "name": repo, "number": number, "cursor": nil}
+	var cards []issueCard
+	for {
+		var data struct {
+			Repository struct {
+				IssueOrPullRequest struct {
+					ProjectCards struct {
+						Nodes    []issueCard `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"projectCards"`
+				} `json:"issueOrPullRequest"`
+			} `json:"repository"`
+		}
+		resp, err := c.query(ctx, issueCardsQuery, variables, &data)
+		if err != nil {
+			return nil, resp, err
+		}
+		connection := data.Repository.IssueOrPullRequest.ProjectCards
+		cards = append(cards, connection.Nodes...)
+		if !connection.PageInfo.HasNextPage {
+			return cards, resp, nil
+		}
+		variables["cursor"] = connection.PageInfo.EndCursor
+	}
+}
+
+// columnCard is a card of an issue and the column holding it
+type columnCard struct {
+	card   *github.ProjectCard
+	column *github.ProjectColumn
+}
+
+// issueCards returns the cards of the issue of an event in a project, in the
+// order of columns. The cards are looked up with a single GraphQL query, and
+// by scanning every column of the project when the query fails, like on
+// GitHub Enterprise Server versions without it. With the board cache, the
+// cards come from the cache, scanned once to fill it.
+func issueCards(ctx context.Context, client *githubClient, project *github.Project, columns []*github.ProjectColumn, e *github.IssuesEvent) ([]columnCard, error) {
+	if cards, ok := client.Boards.issueCards(columns, *e.Issue.URL); ok {
+		return cards, nil
+	}
+	if client.Boards != nil {
+		return scanIssueCards(ctx, client, columns, *e.Issue.URL)
+	}
+	cards, _, err := client.Cards.ListIssueCards(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number)
+	if err != nil {
+		log.Warnf("Could not look up the cards of issue #%v, scanning project %v instead: %v", *e.Issue.Number, *project.Name, err)
+		return scanIssueCards(ctx, client, columns, *e.Issue.URL)
+	}
+	var found []columnCard
+	for _, column := range columns {
+		for _, card := range cards {
+			if card.Project.ID != *project.ID || card.Column == nil || card.Column.ID != *column.ID {
+				continue
+			}
+			found = append(found, columnCard{
+				card:   &github.ProjectCard{ID: github.Int(card.ID), ContentURL: e.Issue.URL},
+				column: column,
+			})
+		}
+	}
+	return found, nil
+}
+
+// scanIssueCards returns the cards of an issue in columns by listing every
+// card of every column
+func scanIssueCards(ctx context.Context, client *githubClient, columns []*github.ProjectColumn, issueURL string) ([]columnCard, error) {
+	ctx, span := startChild(ctx, "scan board")
+	defer span.finish()
+	span.setAttribute("board.columns", len(columns))
+	var found []columnCard
+	scanned := 0
+	for _, column := range columns {
+		cards, err := listCards(ctx, client, *column.ID)
+		if err != nil {
+			span.setError(err)
+			return nil, err
+		}
+		scanned += len(cards)
+		span.setAttribute("board.cards", scanned)
+		for _, card := range cards {
+			if card.ContentURL != nil && *card.ContentURL == issueURL {
+				found = append(found, columnCard{card: card, column: column})
+			}
+		}
+	}
+	return found, nil
+}
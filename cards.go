@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// contentURLPattern matches the API URL of the issue or pull request of a card
+var contentURLPattern = regexp.MustCompile(`/repos/([^/]+)/([^/]+)/(?:issues|pulls)/(\d+)$`)
+
+// errNoteCard is returned for note cards, which have no issue
+var errNoteCard = errors.New("Card is a note")
+
+// parseContentURL returns the owner, repo and number a card's content URL
+// points to
+func parseContentURL(contentURL string) (string, string, int, error) {
+	if contentURL == "" {
+		return "", "", 0, errNoteCard
+	}
+	match := contentURLPattern.FindStringSubmatch(contentURL)
+	if match == nil {
+		return "", "", 0, fmt.Errorf("Content URL %s is not an issue or pull request", contentURL)
+	}
+	number, err := strconv.Atoi(match[3])
+	if err != nil {
+		return "", "", 0, err
+	}
+	return match[1], match[2], number, nil
+}
+
+// issueFromCard fetches the issue of a card. Pull requests are fetched as
+// issues too, which they are to the GitHub API. Note cards return errNoteCard.
+func (mon *githubMonitor) issueFromCard(ctx context.Context, card *github.ProjectCard) (*github.Issue, error) {
+	owner, repo, number, err := parseContentURL(card.GetContentURL())
+	if err != nil {
+		return nil, err
+	}
+	issue, _, err := mon.clients.forOwner(owner).Issues.Get(ctx, owner, repo, number)
+	return issue, err
+}
+
+// releaseCandidatePattern matches the release candidate suffix of project
+// names, labels are named after the release without it
+var releaseCandidatePattern = regexp.MustCompile("-rc.*$")
+
+// projectLabelPrefix returns the label prefix of a project, the reverse of
+// projectMatches
+func projectLabelPrefix(project *github.Project, matchBy string) string {
+	if matchBy == matchByBody {
+		if marker := projectMarker.FindStringSubmatch(project.GetBody()); marker != nil {
+			return marker[1]
+		}
+		return ""
+	}
+	return releaseCandidatePattern.ReplaceAllString(*project.Name, "")
+}
+
+// When a card lands in a column, either by being created, moved or converted
+// from a note, the linked issue should carry the `{projectPrefix}/{action}`
+// label of that column so labels and boards stay in sync. Cards landing in a
+// terminal column also close their issue.
+func (mon *githubMonitor) handleProjectCardEvent(e *github.ProjectCardEvent, r *http.Request) {
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	event := fmt.Sprintf("project_card.%s", e.GetAction())
+	card := e.ProjectCard
+	owner, repo, number, err := parseContentURL(card.GetContentURL())
+	if err == errNoteCard {
+		requestLog(r).Debugf("Ignoring note card %v", card.GetID())
+		mon.stats.ignored.inc()
+		return
+	}
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.stats.ignored.inc()
+		return
+	}
+	repoName := fmt.Sprintf("%s/%s", owner, repo)
+	client := mon.clients.forOwner(owner)
+	column, _, err := client.Projects.GetProjectColumn(ctx, cardColumnID(card))
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	issue, err := mon.issueFromCard(ctx, card)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	if mon.config.isTerminalColumn(*column.Name) {
+		reason := fmt.Sprintf("terminal column '%v'", *column.Name)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "close", closeIssue(ctx, client, owner, repo, issue, reason, r))
+	}
+	// project_url looks like https://api.github.com/projects/1002604
+	projectURL := column.GetProjectURL()
+	projectID, err := strconv.Atoi(projectURL[strings.LastIndex(projectURL, "/")+1:])
+	if err != nil {
+		requestLog(r).Errorf("Could not parse project URL %s, %v", projectURL, err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	project, _, err := client.Projects.GetProject(ctx, projectID)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	projectPrefix := projectLabelPrefix(project, mon.config.MatchBy)
+	if projectPrefix == "" {
+		requestLog(r).Debugf("Project %v has no label prefix", *project.Name)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("skipped: project %v has no label prefix", *project.Name))
+		mon.stats.ignored.inc()
+		return
+	}
+	action, ok := mon.config.columnAction(repoName, *column.Name, projectPrefix)
+	if !ok {
+		requestLog(r).Debugf("Column '%v' does not map to a label", *column.Name)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("skipped: column '%v' has no label", *column.Name))
+		mon.stats.ignored.inc()
+		return
+	}
+	label := fmt.Sprintf("%s/%s", projectPrefix, action)
+	// Skipping labels already applied keeps our own card moves from looping
+	for _, existing := range issue.Labels {
+		if existing.GetName() == label {
+			requestLog(r).Debugf("Issue #%v already has label '%v'", number, label)
+			mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("skipped: already labeled '%v'", label))
+			mon.stats.ignored.inc()
+			return
+		}
+	}
+	requestLog(r).Infof("Adding label '%v' to issue #%v for column '%v'", label, number, *column.Name)
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, number, []string{label}); err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	mon.recordFor(event, e.Sender.GetLogin(), repoName, number, "label", fmt.Sprintf("added label '%v'", label))
+	mon.stats.processed.inc()
+}
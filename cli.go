@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// version is the version of the binary, set at build time with
+// -ldflags "-X main.version=..."
+var version = "dev"
+
+// command is a subcommand of the release-bot binary
+type command struct {
+	name string
+	// args describes the arguments following the flags
+	args        string
+	description string
+	run         func(c command, args []string)
+}
+
+// commands are the subcommands, serve runs when the first argument is a flag
+// or there is none so deployments predating subcommands keep working. They are
+// dispatched with the flag package, cobra isn't vendored.
+var commands = []command{
+	{"serve", "", "Handle GitHub webhooks", runServe},
+	{"sync", "owner/repo", "Place the cards of every open issue of a repository", runSync},
+	{"labels", "owner/repo release", "Create the {release}/{action} labels of every action in a repository", runLabels},
+	{"create-board", "owner/repo name", "Create a project from the board template", runCreateBoard},
+	{"export", "owner/repo name", "Print the cards of a project as JSON", runExport},
+	{"version", "", "Print the version of release-bot", runVersion},
+}
+
+func runCommand(args []string) {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+	for _, command := range commands {
+		if command.name == name {
+			command.run(command, args)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: release-bot <command> [flags] [args]\n\nCommands:")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", command.name, command.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun release-bot <command> -h for the flags of a command.")
+}
+
+// newFlagSet returns the flags of a command, printing its arguments in its
+// usage
+func newFlagSet(c command) *flag.FlagSet {
+	flags := flag.NewFlagSet(c.name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: release-bot %s [flags] %s\n\n%s.\n\nFlags:\n", c.name, c.args, c.description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// commonFlags are the flags of every command talking to GitHub, loading the
+// config and the GitHub token the same way
+type commonFlags struct {
+	debug           *bool
+	logLevel        *string
+	logFormat       *string
+	githubBaseURL   *string
+	githubUploadURL *string
+	configPath      *string
+	githubTokenFile *string
+	dryRun          *bool
+}
+
+func addCommonFlags(flags *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		debug:           flags.Bool("debug", false, "Toggle debug mode, shortcut for -log-level=debug"),
+		logLevel:        flags.String("log-level", "info", "Log level, one of trace, debug, info, warn or error"),
+		logFormat:       flags.String("log-format", "text", "Log format, text or json"),
+		githubBaseURL:   flags.String("github-base-url", "", "Base URL of the GitHub Enterprise Server API, like https://github.example.com/api/v3/, github.com when empty"),
+		githubUploadURL: flags.String("github-upload-url", "", "Upload URL of the GitHub Enterprise Server API, the host of -github-base-url when empty"),
+		configPath:      flags.String("config", "", "Path to a YAML config file, or a directory of YAML and JSON config files"),
+		githubTokenFile: flags.String("github-token-file", os.Getenv(githubTokenFileEnvVariable), "Path to a file containing the GitHub token"),
+		dryRun:          flags.Bool("dry-run", os.Getenv(dryRunEnvVariable) != "", "Log the labels, cards and comments the bot would change instead of changing them"),
+	}
+}
+
+// newMonitor sets up logging, loads the config and returns the monitor the
+// commands act through
+func newMonitor(ctx context.Context, common *commonFlags) *githubMonitor {
+	level, err := parseLogLevel(*common.logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level %q, expected one of trace, debug, info, warn or error", *common.logLevel)
+	}
+	if *common.debug || os.Getenv(debugModeEnvVariable) != "" {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
+	if err := setLogFormat(*common.logFormat); err != nil {
+		log.Fatal(err)
+	}
+	log.Debugf("Log level set to %s", level)
+	githubToken, err := readSecret(*common.githubTokenFile, githubTokenEnvVariable)
+	if err != nil {
+		log.Fatalf("Could not read GitHub token: %v", err)
+	}
+	cfg, err := loadConfig(*common.configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if allowed := os.Getenv(allowedReposEnvVariable); allowed != "" {
+		for _, repo := range strings.Split(allowed, ",") {
+			cfg.AllowedRepos = append(cfg.AllowedRepos, strings.TrimSpace(repo))
+		}
+		if err := validAllowedRepos(cfg.AllowedRepos); err != nil {
+			log.Fatalf("%v in %s", err, allowedReposEnvVariable)
+		}
+	}
+	urls := githubURLs{baseURL: *common.githubBaseURL, uploadURL: *common.githubUploadURL}
+	if err := urls.configure(github.NewClient(nil)); err != nil {
+		log.Fatalf("Invalid GitHub Enterprise Server URL: %v", err)
+	}
+	app, err := newGithubApp(cfg.App, urls)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metrics := newMetrics()
+	tracer := newTracer(cfg.Tracing)
+	if tracer != nil {
+		go tracer.flushEvery(tracingFlushInterval)
+	}
+	monitor := &githubMonitor{
+		ctx:        ctx,
+		clients:    newGithubClients(ctx, githubToken, cfg.ownerTokens, app, urls, cfg.RateLimit, tracer, metrics),
+		githubURLs: urls,
+		config:     cfg,
+		decisions:  newDecisionLog(defaultDebugEvents),
+		tracer:     tracer,
+		metrics:    metrics,
+		secretSources: secretSources{
+			githubTokenFile: *common.githubTokenFile,
+		},
+	}
+	if *common.dryRun {
+		log.Warn("Dry run: changes to GitHub are logged, not made")
+		monitor.clients.dryRun = true
+	}
+	if cfg.BoardCache.Enabled {
+		monitor.boards, err = loadBoardCache(cfg.BoardCache)
+		if err != nil {
+			log.Fatalf("Could not load board cache %s: %v", cfg.BoardCache.Path, err)
+		}
+		monitor.clients.boards = monitor.boards
+	}
+	return monitor
+}
+
+// defaultDebugEvents is the number of recent decisions kept for /debug/events
+const defaultDebugEvents = 100
+
+// parseRepoArgs parses the owner/repo first argument of a command followed
+// by extra arguments, exiting with the usage of the command when they are
+// missing
+func parseRepoArgs(flags *flag.FlagSet, extra int) (string, string, []string) {
+	if flags.NArg() != 1+extra {
+		flags.Usage()
+		os.Exit(2)
+	}
+	parts := strings.SplitN(flags.Arg(0), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Fatalf("Invalid repository %q, expected owner/name", flags.Arg(0))
+	}
+	return parts[0], parts[1], flags.Args()[1:]
+}
+
+func runSync(c command, args []string) {
+	flags := newFlagSet(c)
+	common := addCommonFlags(flags)
+	triage := flags.Bool("triage", false, "Also triage the issues without release labels")
+	flags.Parse(args)
+	owner, repo, _ := parseRepoArgs(flags, 0)
+	ctx := context.Background()
+	monitor := newMonitor(ctx, common)
+	if err := monitor.syncRepository(ctx, owner+"/"+repo, *triage); err != nil {
+		log.Fatalf("Could not sync %s/%s: %v", owner, repo, err)
+	}
+	monitor.tracer.flush()
+}
+
+func runLabels(c command, args []string) {
+	flags := newFlagSet(c)
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	owner, repo, rest := parseRepoArgs(flags, 1)
+	ctx := context.Background()
+	monitor := newMonitor(ctx, common)
+	created, err := monitor.createReleaseLabels(ctx, owner, repo, rest[0])
+	if err != nil {
+		log.Fatalf("Could not create the labels of %s in %s/%s: %v", rest[0], owner, repo, err)
+	}
+	if len(created) == 0 {
+		log.Infof("Every label of %s already exists in %s/%s", rest[0], owner, repo)
+	}
+}
+
+func runCreateBoard(c command, args []string) {
+	flags := newFlagSet(c)
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	owner, repo, rest := parseRepoArgs(flags, 1)
+	ctx := context.Background()
+	monitor := newMonitor(ctx, common)
+	project, created, err := monitor.createBoard(ctx, owner, repo, rest[0])
+	if err != nil {
+		log.Fatalf("Could not create project %s in %s/%s: %v", rest[0], owner, repo, err)
+	}
+	if !created {
+		log.Infof("Project %s already exists in %s/%s", project.GetName(), owner, repo)
+	}
+}
+
+func runExport(c command, args []string) {
+	flags := newFlagSet(c)
+	common := addCommonFlags(flags)
+	flags.Parse(args)
+	owner, repo, rest := parseRepoArgs(flags, 1)
+	ctx := context.Background()
+	monitor := newMonitor(ctx, common)
+	if err := monitor.exportBoard(ctx, owner+"/"+repo, rest[0], os.Stdout); err != nil {
+		log.Fatalf("Could not export project %s of %s/%s: %v", rest[0], owner, repo, err)
+	}
+}
+
+func runVersion(c command, args []string) {
+	flags := newFlagSet(c)
+	flags.Parse(args)
+	fmt.Printf("release-bot %s (%s)\n", version, runtime.Version())
+}
+
+// listenAddr returns the address to listen on for a bind host and a port, all
+// interfaces when host is empty
+func listenAddr(host, port string) (string, error) {
+	addr := net.JoinHostPort(host, port)
+	if _, err := net.ResolveTCPAddr("tcp", addr); err != nil {
+		return "", fmt.Errorf("Invalid bind address %q: %v", addr, err)
+	}
+	return addr, nil
+}
+
+// newServer returns the webhook server. The read timeout covers the headers
+// and the body, so slow clients can't hold connections open.
+func newServer(addr string, handler http.Handler, readTimeout, writeTimeout, idleTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+func runServe(c command, args []string) {
+	flags := newFlagSet(c)
+	common := addCommonFlags(flags)
+	port := flags.String("port", "8080", "Port to bind release-bot to")
+	bind := flags.String("bind", os.Getenv(bindAddrEnvVariable), "Host or IP to bind release-bot to, all interfaces when empty")
+	tlsCert := flags.String("tls-cert", "", "PEM certificate file to serve HTTPS with, needs -tls-key")
+	tlsKey := flags.String("tls-key", "", "PEM private key file of -tls-cert")
+	redirectPort := flags.String("http-redirect-port", "", "Port redirecting HTTP requests to HTTPS when serving TLS, disabled when empty")
+	webhookSecretFile := flags.String("webhook-secret-file", os.Getenv(webhookSecretFileEnvVariable), "Path to a file containing the webhook secrets, separated by commas or newlines")
+	adminTokenFile := flags.String("admin-token-file", os.Getenv(adminTokenFileEnvVariable), "Path to a file containing the admin API token")
+	insecureSkipSignature := flags.Bool("insecure-skip-signature", false, "Accept webhooks without validating their signature, NEVER use this outside of local development")
+	statsInterval := flags.Duration("stats-interval", 0, "Interval to log event stats at, disabled when 0")
+	debugEvents := flags.Int("debug-events", defaultDebugEvents, "Number of recent decisions to keep for /debug/events")
+	// Handlers ack webhooks before doing any GitHub calls, so the write
+	// timeout only has to cover reading the payload and writing the status
+	readTimeout := flags.Duration("read-timeout", 10*time.Second, "Maximum duration for reading a request, including the body")
+	writeTimeout := flags.Duration("write-timeout", 10*time.Second, "Maximum duration before timing out writes of a response")
+	idleTimeout := flags.Duration("idle-timeout", 60*time.Second, "Maximum time to wait for the next request on a keep-alive connection")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for the events being handled on SIGTERM or SIGINT")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *debugEvents < 0 {
+		log.Fatalf("Invalid -debug-events %d, expected 0 or more", *debugEvents)
+	}
+	ctx := context.Background()
+	monitor := newMonitor(ctx, common)
+	cfg := monitor.config
+	webhookSecret, err := readSecret(*webhookSecretFile, webhookSecretEnvVariable)
+	if err != nil {
+		log.Fatalf("Could not read webhook secret: %v", err)
+	}
+	adminToken, err := readSecret(*adminTokenFile, adminTokenEnvVariable)
+	if err != nil {
+		log.Fatalf("Could not read admin token: %v", err)
+	}
+	monitor.secrets = parseWebhookSecrets(webhookSecret)
+	monitor.secretSources.webhookSecretFile = *webhookSecretFile
+	monitor.adminToken = []byte(adminToken)
+	monitor.skipSignature = *insecureSkipSignature
+	monitor.decisions = newDecisionLog(*debugEvents)
+	if monitor.skipSignature {
+		log.Warn("INSECURE: -insecure-skip-signature is set, webhook signatures will NOT be validated, never use this outside of local development")
+	}
+	monitor.workers = newIssueWorkers(cfg.workers(), cfg.queueDepth())
+	if cfg.Audit.Path != "" {
+		monitor.auditLog, err = openAuditLog(cfg.Audit.Path, cfg.Audit.maxSize())
+		if err != nil {
+			log.Fatalf("Could not open audit log %s: %v", cfg.Audit.Path, err)
+		}
+	}
+	if cfg.RetryQueue.Path != "" {
+		monitor.retries, err = loadRetryQueue(cfg.RetryQueue, &monitor.stats.retryQueue)
+		if err != nil {
+			log.Fatalf("Could not load retry queue %s: %v", cfg.RetryQueue.Path, err)
+		}
+		go monitor.retryEvery(cfg.RetryQueue.interval())
+	}
+	monitor.summaries = newActionSummaries(cfg.SummaryComment.window(), monitor.postSummary)
+	if cfg.StaleCards.Schedule != "" {
+		// the schedule is checked when the config is loaded
+		schedule, _ := parseCronSchedule(cfg.StaleCards.Schedule)
+		go monitor.checkStaleCardsOn(schedule)
+	}
+	go monitor.checkTokenScopes()
+	if *statsInterval > 0 {
+		go monitor.stats.logEvery(*statsInterval)
+	}
+	router := newRouter(monitor)
+	addr, err := listenAddr(*bind, *port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := newServer(addr, router, *readTimeout, *writeTimeout, *idleTimeout)
+	servers := []*http.Server{server}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+	if *tlsCert != "" {
+		server.TLSConfig, err = loadTLSConfig(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Could not load TLS certificate: %v", err)
+		}
+		if *redirectPort != "" {
+			redirect := newRedirectServer(net.JoinHostPort(*bind, *redirectPort), *port)
+			log.Infof("Redirecting HTTP on %s to HTTPS", redirect.Addr)
+			servers = append(servers, redirect)
+		}
+		log.Infof("Starting release-bot %s on %s over HTTPS", version, addr)
+	} else if *redirectPort != "" {
+		log.Fatal("-http-redirect-port needs -tls-cert and -tls-key")
+	} else {
+		log.Infof("Starting release-bot %s on %s", version, addr)
+	}
+	monitor.serveUntilSignal(*shutdownTimeout, servers...)
+}
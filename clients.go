@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+)
+
+// issuesService is the part of github.IssuesService used by the bot
+type issuesService interface {
+	ListLabels(ctx context.Context, owner string, repo string, opt *github.ListOptions) ([]*github.Label, *github.Response, error)
+	ListLabelsByIssue(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.Label, *github.Response, error)
+	AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error)
+	Get(ctx context.Context, owner string, repo string, number int) (*github.Issue, *github.Response, error)
+	ListByRepo(ctx context.Context, owner string, repo string, opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error)
+	Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error)
+	Create(ctx context.Context, owner string, repo string, issue *github.IssueRequest) (*github.Issue, *github.Response, error)
+	CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	RemoveLabelForIssue(ctx context.Context, owner string, repo string, number int, label string) (*github.Response, error)
+	CreateLabel(ctx context.Context, owner string, repo string, label *github.Label) (*github.Label, *github.Response, error)
+}
+
+// projectsService is the part of github.ProjectsService used by the bot
+type projectsService interface {
+	GetProject(ctx context.Context, id int) (*github.Project, *github.Response, error)
+	ListProjectColumns(ctx context.Context, projectID int, opt *github.ListOptions) ([]*github.ProjectColumn, *github.Response, error)
+	GetProjectColumn(ctx context.Context, id int) (*github.ProjectColumn, *github.Response, error)
+	CreateProjectColumn(ctx context.Context, projectID int, opt *github.ProjectColumnOptions) (*github.ProjectColumn, *github.Response, error)
+	GetProjectCard(ctx context.Context, cardID int) (*github.ProjectCard, *github.Response, error)
+	ListProjectCards(ctx context.Context, columnID int, opt *github.ListOptions) ([]*github.ProjectCard, *github.Response, error)
+	CreateProjectCard(ctx context.Context, columnID int, opt *github.ProjectCardOptions) (*github.ProjectCard, *github.Response, error)
+	DeleteProjectCard(ctx context.Context, cardID int) (*github.Response, error)
+	MoveProjectCard(ctx context.Context, cardID int, opt *github.ProjectCardMoveOptions) (*github.Response, error)
+}
+
+// repositoriesService is the part of github.RepositoriesService used by the bot
+type repositoriesService interface {
+	ListProjects(ctx context.Context, owner, repo string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error)
+	IsCollaborator(ctx context.Context, owner, repo, user string) (bool, *github.Response, error)
+	CreateProject(ctx context.Context, owner, repo string, opt *github.ProjectOptions) (*github.Project, *github.Response, error)
+	GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+}
+
+// organizationsService is the part of github.OrganizationsService used by
+// the bot
+type organizationsService interface {
+	ListProjects(ctx context.Context, org string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error)
+}
+
+// usersService is the part of github.UsersService used by the bot
+type usersService interface {
+	Get(ctx context.Context, user string) (*github.User, *github.Response, error)
+}
+
+// searchService is the part of github.SearchService used by the bot
+type searchService interface {
+	Issues(ctx context.Context, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error)
+}
+
+// reviewRequestsService requests pull request reviews from teams
+type reviewRequestsService interface {
+	ListRequestedTeams(ctx context.Context, owner, repo string, number int) ([]string, *github.Response, error)
+	RequestTeamReviewers(ctx context.Context, owner, repo string, number int, teams []string) (*github.Response, error)
+}
+
+// projectsV2Service moves items of Projects (V2) through the GraphQL API
+type projectsV2Service interface {
+	ListProjectsV2(ctx context.Context, owner, prefix string) ([]projectV2, *github.Response, error)
+	IssueNodeID(ctx context.Context, owner, repo string, number int) (string, *github.Response, error)
+	AddProjectV2Item(ctx context.Context, projectID, contentID string) (string, *github.Response, error)
+	ProjectV2Field(ctx context.Context, projectID, name string) (*projectV2Field, *github.Response, error)
+	SetProjectV2Field(ctx context.Context, projectID, itemID, fieldID, optionID string) (*github.Response, error)
+}
+
+// reactionsService is the part of github.ReactionsService used by the bot
+type reactionsService interface {
+	CreateIssueReaction(ctx context.Context, owner, repo string, number int, content string) (*github.Reaction, *github.Response, error)
+}
+
+// rateLimitsService reads the rate limits of the token, it is implemented by
+// github.Client itself
+type rateLimitsService interface {
+	RateLimits(ctx context.Context) (*github.RateLimits, *github.Response, error)
+}
+
+// githubClient holds the GitHub API services used by the bot. They are
+// interfaces so an in-memory implementation can stand in for the GitHub API.
+type githubClient struct {
+	Issues        issuesService
+	Projects      projectsService
+	Repositories  repositoriesService
+	Orgs          organizationsService
+	Users         usersService
+	Search        searchService
+	Reviews       reviewRequestsService
+	Backports     backportsService
+	ProjectsV2    projectsV2Service
+	Cards         projectCardsService
+	Reactions     reactionsService
+	ProjectStates projectStatesService
+	Limits        rateLimitsService
+	// Boards is the board cache Projects, Repositories and Orgs read
+	// through, nil when boards aren't cached
+	Boards *boardCache
+}
+
+func newGithubClient(client *github.Client) *githubClient {
+	return &githubClient{
+		Issues:        client.Issues,
+		Projects:      client.Projects,
+		Repositories:  client.Repositories,
+		Orgs:          client.Organizations,
+		Users:         client.Users,
+		Search:        client.Search,
+		Reviews:       &reviewRequestsClient{client: client},
+		Backports:     &backportsClient{client: client},
+		ProjectsV2:    &graphqlClient{client: client},
+		Cards:         &graphqlClient{client: client},
+		Reactions:     client.Reactions,
+		ProjectStates: &projectStatesClient{client: client},
+		Limits:        client,
+	}
+}
+
+// githubClients builds and caches a GitHub client per repository owner so
+// deployments spanning several orgs can use a different token for each, and
+// so calls can be throttled per owner.
+type githubClients struct {
+	ctx context.Context
+	// newClient builds the client for a token source
+	newClient func(ts oauth2.TokenSource) *githubClient
+
+	mu sync.Mutex
+	// token is used for owners without a token of their own
+	token string
+	// tokens maps lower cased owners to their token
+	tokens map[string]string
+	// app, when set, replaces token with installation tokens
+	app     *githubApp
+	clients map[string]*githubClient
+	// dryRun logs mutating calls instead of making them
+	dryRun bool
+	// boards, when set, caches the boards read by every client
+	boards *boardCache
+}
+
+func newGithubClients(ctx context.Context, token string, tokens map[string]string, app *githubApp, urls githubURLs, limit rateLimitConfig, tracer *tracer, metrics *metrics) *githubClients {
+	clients := &githubClients{
+		ctx: ctx,
+		newClient: func(ts oauth2.TokenSource) *githubClient {
+			httpClient := oauth2.NewClient(ctx, ts)
+			if tracer != nil {
+				httpClient.Transport = &tracedTransport{tracer: tracer, base: httpClient.Transport}
+			}
+			if metrics != nil {
+				httpClient.Transport = &metricsTransport{metrics: metrics, base: httpClient.Transport}
+			}
+			httpClient.Transport = &rateLimitTransport{config: limit, metrics: metrics, base: httpClient.Transport}
+			if limit.PerSecond > 0 {
+				httpClient.Transport = &throttledTransport{
+					limiter: rate.NewLimiter(rate.Limit(limit.PerSecond), limit.burst()),
+					base:    httpClient.Transport,
+				}
+			}
+			client := github.NewClient(httpClient)
+			// the URLs are checked when the flags are parsed
+			urls.configure(client)
+			return newGithubClient(client)
+		},
+	}
+	clients.setTokens(token, tokens, app)
+	return clients
+}
+
+// setTokens replaces the tokens clients are built with. Clients already handed
+// out keep working with the previous tokens until their callers are done.
+func (c *githubClients) setTokens(token string, tokens map[string]string, app *githubApp) {
+	ownerTokens := make(map[string]string)
+	for owner, ownerToken := range tokens {
+		ownerTokens[strings.ToLower(owner)] = ownerToken
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.tokens = ownerTokens
+	c.app = app
+	c.clients = make(map[string]*githubClient)
+}
+
+// staticToken returns a token source always returning token
+func staticToken(token string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
+
+// forOwner returns the client to use for repositories of owner. Tokens of the
+// owner come first, then installation tokens of the app, then the global token.
+func (c *githubClients) forOwner(owner string) *githubClient {
+	key := strings.ToLower(owner)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[key]; ok {
+		return client
+	}
+	var ts oauth2.TokenSource
+	if token, ok := c.tokens[key]; ok {
+		ts = staticToken(token)
+	} else if c.app != nil {
+		ts = c.app.tokenSource(c.ctx, owner)
+	} else {
+		ts = staticToken(c.token)
+	}
+	client := c.newClient(ts)
+	if c.boards != nil {
+		client = cachedBoards(client, c.boards)
+	}
+	if c.dryRun {
+		client = dryRun(client)
+	}
+	c.clients[key] = client
+	return client
+}
+
+// throttledTransport waits for its rate limiter before every request so we
+// stay a good API citizen and don't trip GitHub's abuse detection
+type throttledTransport struct {
+	limiter *rate.Limiter
+	base    http.RoundTripper
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// When an issue is closed its cards on the open boards of the repository move
+// to the `closedColumn`, and back to triage when the issue is reopened.
+// Reopened issues whose card was moved out of the closed column since are
+// left alone.
+func (mon *githubMonitor) handleIssueStateEvent(e *github.IssuesEvent, r *http.Request) {
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	repo := repoFullName(e.Repo)
+	projects, err := mon.listOpenProjects(e)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	moved := false
+	for _, project := range projects {
+		card, column, columns, err := findCard(ctx, client, project, e)
+		if err != nil {
+			requestLog(r).Errorf("%q", err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		if card == nil {
+			continue
+		}
+		target := mon.config.ClosedColumn
+		if *e.Action == "reopened" {
+			if *column.Name != mon.config.ClosedColumn {
+				continue
+			}
+			prefix := projectLabelPrefix(project, mon.config.MatchBy)
+			target, _, err = mon.config.columnName(repo, prefix, "triage")
+			if err != nil {
+				requestLog(r).Errorf("Could not render the triage column, %v", err)
+				mon.record(e, "move", fmt.Sprintf("error: %v", err))
+				mon.stats.droppedError.inc()
+				return
+			}
+		}
+		if *column.Name == target {
+			continue
+		}
+		var targetID int
+		for _, c := range columns {
+			if *c.Name == target {
+				targetID = *c.ID
+			}
+		}
+		if targetID == 0 {
+			mon.record(e, "move", fmt.Sprintf("skipped: no column '%v' in %v", target, *project.Name))
+			continue
+		}
+		requestLog(r).Infof("Moving %v issue #%v to '%v' in project %v", *e.Action, *e.Issue.Number, target, *project.Name)
+		if err := moveCard(ctx, client, *card.ID, targetID, mon.config.cardPosition(repo, target), r); err != nil {
+			requestLog(r).Errorf("Failed moving card %v:\n%v", *card.ID, err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		mon.record(e, "move", fmt.Sprintf("moved from %v to %v in %v", *column.Name, target, *project.Name))
+		moved = true
+	}
+	if moved {
+		mon.stats.processed.inc()
+	} else {
+		mon.stats.ignored.inc()
+	}
+}
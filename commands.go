@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// slashCommand is a `/command args...` line of an issue comment
+type slashCommand struct {
+	name string
+	args []string
+}
+
+// parseSlashCommands returns the commands of a comment, one per line starting
+// with a slash
+func parseSlashCommands(body string) []slashCommand {
+	var commands []slashCommand
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") || len(fields[0]) == 1 {
+			continue
+		}
+		commands = append(commands, slashCommand{
+			name: strings.ToLower(strings.TrimPrefix(fields[0], "/")),
+			args: fields[1:],
+		})
+	}
+	return commands
+}
+
+// labels returns the labels a command adds and the label prefix it removes,
+// or an error for commands that aren't known or are missing arguments
+func (c slashCommand) labels(triageSuffix string) (add string, removePrefix string, err error) {
+	switch {
+	case c.name == "triage" && len(c.args) == 1:
+		return fmt.Sprintf("%s/%s", c.args[0], triageSuffix), "", nil
+	case c.name == "move" && len(c.args) == 2:
+		return fmt.Sprintf("%s/%s", c.args[0], c.args[1]), "", nil
+	case c.name == "remove" && len(c.args) == 1:
+		return "", c.args[0] + "/", nil
+	}
+	return "", "", fmt.Errorf("Unknown command /%s %s", c.name, strings.Join(c.args, " "))
+}
+
+// triageSuffix is the label action /triage applies
+func (c *config) triageSuffix() string {
+	if len(c.TriageSuffixes) > 0 {
+		return c.TriageSuffixes[0]
+	}
+	return "triage"
+}
+
+// Collaborators drive the board from issue comments with `/triage {release}`,
+// `/move {release} {action}` and `/remove {release}`. Commands add or remove
+// the `{release}/{action}` labels, the card moves follow from the label
+// events like for labels added by hand.
+func (mon *githubMonitor) handleIssueCommentEvent(e *github.IssueCommentEvent, r *http.Request) {
+	commands := parseSlashCommands(e.Comment.GetBody())
+	if len(commands) == 0 {
+		mon.stats.ignored.inc()
+		return
+	}
+	ie := &github.IssuesEvent{Action: e.Action, Issue: e.Issue, Repo: e.Repo, Sender: e.Sender}
+	owner, repo := *e.Repo.Owner.Login, *e.Repo.Name
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(owner)
+	author := e.Comment.User.GetLogin()
+	collaborator, _, err := client.Repositories.IsCollaborator(ctx, owner, repo, author)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(ie, "command", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	if !collaborator {
+		requestLog(r).Infof("Ignoring commands of %s, not a collaborator", author)
+		mon.record(ie, "command", fmt.Sprintf("skipped: %s is not a collaborator", author))
+		mon.stats.ignored.inc()
+		return
+	}
+	labels, err := listLabels(ctx, client, owner, repo)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(ie, "command", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	known := make(map[string]bool)
+	for _, label := range labels {
+		known[label.GetName()] = true
+	}
+	for _, command := range commands {
+		add, removePrefix, err := command.labels(mon.config.triageSuffix())
+		if err != nil {
+			requestLog(r).Debugf("%v", err)
+			mon.record(ie, "command", fmt.Sprintf("skipped: %v", err))
+			continue
+		}
+		if add != "" {
+			if !known[add] {
+				mon.record(ie, "command", fmt.Sprintf("skipped: no label '%v'", add))
+				continue
+			}
+			requestLog(r).Infof("Adding label '%v' to issue #%v for %s", add, *e.Issue.Number, author)
+			if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, *e.Issue.Number, []string{add}); err != nil {
+				requestLog(r).Errorf("%q", err)
+				mon.record(ie, "command", fmt.Sprintf("error: %v", err))
+				mon.dropError(r)
+				return
+			}
+			mon.record(ie, "command", fmt.Sprintf("added label %v", add))
+			continue
+		}
+		for _, label := range e.Issue.Labels {
+			if !strings.HasPrefix(label.GetName(), removePrefix) {
+				continue
+			}
+			requestLog(r).Infof("Removing label '%v' from issue #%v for %s", label.GetName(), *e.Issue.Number, author)
+			if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, *e.Issue.Number, label.GetName()); err != nil {
+				requestLog(r).Errorf("%q", err)
+				mon.record(ie, "command", fmt.Sprintf("error: %v", err))
+				mon.dropError(r)
+				return
+			}
+			mon.record(ie, "command", fmt.Sprintf("removed label %v", label.GetName()))
+		}
+	}
+	mon.stats.processed.inc()
+}
@@ -0,0 +1,824 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config holds the optional settings loaded from the file, or directory of
+// files, passed with -config.
+type config struct {
+	// Actions holds per-action behavior keyed by label suffix, for example
+	// `wontfix` for the label `17.03.1-ee/wontfix`.
+	Actions map[string]actionConfig `yaml:"actions" json:"actions"`
+	// MatchBy selects how label prefixes are matched to projects, either by
+	// project name prefix (`name`, the default) or by a `release-bot: {prefix}`
+	// marker line in the project body (`body`)
+	MatchBy string `yaml:"matchBy" json:"matchBy"`
+	// MultiProject selects what happens when a label prefix matches several
+	// open projects, act on the `first` one (the default), on `all` of them,
+	// or on the `latest` one by the semantic version in their name, like
+	// 17.06.1-rc2 over 17.06.1-rc1
+	MultiProject string `yaml:"multiProject" json:"multiProject"`
+	// IncludeClosedProjects also looks for a matching project among closed
+	// ones when no open project matches
+	IncludeClosedProjects bool `yaml:"includeClosedProjects" json:"includeClosedProjects"`
+	// OrgProjects also looks for matching projects among the projects of the
+	// organization owning the repository, after the repository's own
+	OrgProjects bool `yaml:"orgProjects" json:"orgProjects"`
+	// DeleteDuplicateCards deletes extra cards when an issue is found in more
+	// than one column of a project. The first card found is always kept.
+	DeleteDuplicateCards bool `yaml:"deleteDuplicateCards" json:"deleteDuplicateCards"`
+	// CreateMissingColumns creates the destination column of a label when
+	// the project doesn't have it yet
+	CreateMissingColumns bool `yaml:"createMissingColumns" json:"createMissingColumns"`
+	// MaxEventAge ignores webhooks whose issue, pull request or card was last
+	// updated longer ago than this, for example `24h`
+	MaxEventAge time.Duration `yaml:"maxEventAge" json:"maxEventAge"`
+	// Workers is how many events are handled at once, 16 by default. The
+	// events of an issue are handled one at a time in the order they came in.
+	Workers int `yaml:"workers" json:"workers"`
+	// QueueDepth is how many events wait for each worker, 64 by default.
+	// Webhooks arriving while the queue of their event is full go to the
+	// retry queue, or are answered 503 and lost when it is disabled.
+	QueueDepth int `yaml:"queueDepth" json:"queueDepth"`
+	// DeliveryTTL is how long webhook delivery IDs are remembered to skip the
+	// deliveries GitHub sends again, 1 hour by default
+	DeliveryTTL time.Duration `yaml:"deliveryTTL" json:"deliveryTTL"`
+	// MoveThrottle skips moving a card to the column it was already moved to
+	// within this window, for example `1m`, to stop cards bouncing between
+	// the bot and other automations
+	MoveThrottle time.Duration `yaml:"moveThrottle" json:"moveThrottle"`
+	// IgnoreActors lists accounts, usually other automations, whose events
+	// are ignored to avoid feedback loops
+	IgnoreActors []string `yaml:"ignoreActors" json:"ignoreActors"`
+	// Columns maps label actions to the column they move cards to, adding to
+	// or replacing the default ones. Names are Go templates given the label
+	// `{{.Prefix}}` and `{{.Suffix}}`, for example `Cherry Pick {{.Prefix}}`.
+	Columns map[string]string `yaml:"columns" json:"columns"`
+	// CardPosition is where moved and new cards go in their column, `top`
+	// (the default) or `bottom`
+	CardPosition string `yaml:"cardPosition" json:"cardPosition"`
+	// ColumnPositions maps column names to where cards go in them, replacing
+	// CardPosition, as `top` or `bottom`. Cherry pick columns kept in
+	// chronological order use `bottom`.
+	ColumnPositions map[string]string `yaml:"columnPositions" json:"columnPositions"`
+	// AllowedRepos lists the repositories the bot acts on, as `owner/name` or
+	// `owner/*` patterns. Events of other repositories are rejected. Every
+	// repository is allowed when empty.
+	AllowedRepos []string `yaml:"allowedRepos" json:"allowedRepos"`
+	// Repos overrides the column names and card position per repository,
+	// keyed by `owner/name`
+	Repos map[string]repoConfig `yaml:"repos" json:"repos"`
+	// ProjectsV2 handles labels with Projects (V2) instead of classic projects
+	ProjectsV2 projectsV2Config `yaml:"projectsV2" json:"projectsV2"`
+	// Unlabeled reverses the move of a `{release}/{action}` label when it is
+	// removed, `triage` moves the card back to triage and `remove` deletes it.
+	// Removed labels are ignored when empty.
+	Unlabeled string `yaml:"unlabeled" json:"unlabeled"`
+	// RepoFiles reads settings like those of Repos from a file in each
+	// repository, they override the ones of Repos
+	RepoFiles repoFilesConfig `yaml:"repoFiles" json:"repoFiles"`
+	// ColumnOrder lists columns in board order, when set cards are only ever
+	// moved forward between the listed columns
+	ColumnOrder []string `yaml:"columnOrder" json:"columnOrder"`
+	// Pipeline lists columns in order for the `advance` label action, which
+	// moves a card to the column following its current one
+	Pipeline []string `yaml:"pipeline" json:"pipeline"`
+	// TerminalColumns close the issue of any card placed in them, for
+	// example `Done`
+	TerminalColumns []string `yaml:"terminalColumns" json:"terminalColumns"`
+	// WIPLimits maps column names to the most cards they should hold
+	WIPLimits map[string]wipLimitConfig `yaml:"wipLimits" json:"wipLimits"`
+	// StrictColumns ignores label actions outside of the default column map
+	// and AllowedColumns instead of using them as literal column names
+	StrictColumns bool `yaml:"strictColumns" json:"strictColumns"`
+	// AllowedColumns lists the extra actions that move cards to the column of
+	// the same name when StrictColumns is set
+	AllowedColumns []string `yaml:"allowedColumns" json:"allowedColumns"`
+	// Tokens maps repository owners to the GitHub token to use for their
+	// repositories, owners without a token use the global one
+	Tokens map[string]tokenConfig `yaml:"tokens" json:"tokens"`
+	// App authenticates as a GitHub App, owners without a token of their own
+	// use its installation tokens instead of the global token
+	App appConfig `yaml:"app" json:"app"`
+	// RateLimit throttles GitHub API calls per repository owner
+	RateLimit rateLimitConfig `yaml:"rateLimit" json:"rateLimit"`
+	// TriageSuffixes are the label actions applied to newly opened issues for
+	// every matching open project, `triage` by default
+	TriageSuffixes []string `yaml:"triageSuffixes" json:"triageSuffixes"`
+	// AutoTriage applies the triage labels of open projects to newly opened
+	// issues, on by default
+	AutoTriage bool `yaml:"autoTriage" json:"autoTriage"`
+	// TriagePullRequests also triages newly opened pull requests
+	TriagePullRequests bool `yaml:"triagePullRequests" json:"triagePullRequests"`
+	// SkipDraftPullRequests waits for draft pull requests to be ready for
+	// review before triaging them, on by default
+	SkipDraftPullRequests bool `yaml:"skipDraftPullRequests" json:"skipDraftPullRequests"`
+	// InheritLabels lists the label actions, like `cherry-pick`, whose
+	// `{release}/{action}` labels pull requests inherit from the issues they
+	// close
+	InheritLabels []string `yaml:"inheritLabels" json:"inheritLabels"`
+	// ReleaseBranches is a regular expression matching release branches, like
+	// `^(\d+\.\d+)\.x$`. Pull requests opened against a matching branch get
+	// the triage label of the release, the first group of the expression or
+	// else the branch name. Disabled when empty.
+	ReleaseBranches string `yaml:"releaseBranches" json:"releaseBranches"`
+	// ReviewTeams maps label prefixes to the slug of the team reviewing pull
+	// requests of that release
+	ReviewTeams map[string]string `yaml:"reviewTeams" json:"reviewTeams"`
+	// RequireTriageColumn only applies the triage label of a project to opened
+	// issues when the project has the triage column
+	RequireTriageColumn bool `yaml:"requireTriageColumn" json:"requireTriageColumn"`
+	// SkipClosedIssues leaves the cards of closed issues alone when they get
+	// labeled, on by default
+	SkipClosedIssues bool `yaml:"skipClosedIssues" json:"skipClosedIssues"`
+	// OpenColumn is a column to also create a card in, for newly opened issues
+	// matching an open project
+	OpenColumn string `yaml:"openColumn" json:"openColumn"`
+	// SlashCommands lets collaborators add and remove release labels with
+	// `/triage`, `/move` and `/remove` issue comments. The token user must not
+	// be in IgnoreActors for the labels it adds to move cards.
+	SlashCommands bool `yaml:"slashCommands" json:"slashCommands"`
+	// ClosedColumn is the column, like `Done`, the cards of closed issues move
+	// to on open boards. Reopened issues move back to triage. Disabled when
+	// empty.
+	ClosedColumn string `yaml:"closedColumn" json:"closedColumn"`
+	// AcceptFormPayloads accepts webhooks sent as form encoded payloads in
+	// addition to JSON
+	AcceptFormPayloads bool `yaml:"acceptFormPayloads" json:"acceptFormPayloads"`
+	// RequireLabel restricts the bot to issues carrying this label
+	RequireLabel string `yaml:"requireLabel" json:"requireLabel"`
+	// FlatLabels maps repositories, as `owner/name`, to the name of a default
+	// project that labels without a release prefix act on
+	FlatLabels map[string]string `yaml:"flatLabels" json:"flatLabels"`
+	// SummaryComment posts one comment per issue listing the actions taken,
+	// or reacts to the issue, in every repository unless turned off in Repos
+	SummaryComment summaryConfig `yaml:"summaryComment" json:"summaryComment"`
+	// Slack posts to a release channel when cards land in some columns
+	Slack slackConfig `yaml:"slack" json:"slack"`
+	// Boards is the template of new release boards
+	Boards boardTemplateConfig `yaml:"boards" json:"boards"`
+	// Backports opens backport pull requests for merged pull requests labeled
+	// for a cherry-pick
+	Backports backportConfig `yaml:"backports" json:"backports"`
+	// RetryQueue persists failed events to retry them later
+	RetryQueue retryQueueConfig `yaml:"retryQueue" json:"retryQueue"`
+	// Milestones moves the cards of milestoned issues to the board of their
+	// release
+	Milestones milestoneConfig `yaml:"milestones" json:"milestones"`
+	// Mirror mirrors applied labels to a central tracking repository
+	Mirror mirrorConfig `yaml:"mirror" json:"mirror"`
+	// Tracing exports OpenTelemetry spans of every event
+	Tracing tracingConfig `yaml:"tracing" json:"tracing"`
+	// AuthLimit rejects sources with repeated signature failures
+	AuthLimit authLimitConfig `yaml:"authLimit" json:"authLimit"`
+	// Audit logs the metadata of every webhook delivery
+	Audit auditConfig `yaml:"audit" json:"audit"`
+	// BoardCache caches boards, updated by project webhooks
+	BoardCache boardCacheConfig `yaml:"boardCache" json:"boardCache"`
+	// Releases closes out the boards of published releases
+	Releases releasesConfig `yaml:"releases" json:"releases"`
+	// StaleCards reminds release captains of cards sitting too long in a
+	// column, on a schedule
+	StaleCards staleCardsConfig `yaml:"staleCards" json:"staleCards"`
+	// LabelRules add labels like area/networking to opened and edited
+	// issues whose title or body match them
+	LabelRules []labelRule `yaml:"labelRules" json:"labelRules"`
+
+	// ownerTokens holds the resolved value of Tokens
+	ownerTokens map[string]string
+	// releaseBranches is the compiled ReleaseBranches
+	releaseBranches *regexp.Regexp
+	// repoFiles caches the settings files of repositories when RepoFiles is
+	// enabled
+	repoFiles *repoFiles
+}
+
+// rateLimitConfig is a token bucket rate, calls are not throttled when
+// PerSecond is 0, and how calls hitting the GitHub rate limit are retried
+type rateLimitConfig struct {
+	PerSecond float64 `yaml:"perSecond" json:"perSecond"`
+	Burst     int     `yaml:"burst" json:"burst"`
+	// MaxWait is the longest wait for the rate limit to reset before
+	// retrying a call, calls needing longer fail. 15 minutes by default.
+	MaxWait time.Duration `yaml:"maxWait" json:"maxWait"`
+	// Retries is how many times a call hitting the rate limit is retried, 3
+	// by default
+	Retries int `yaml:"retries" json:"retries"`
+}
+
+// burst returns the configured burst, at least 1 so calls can proceed at all
+func (c rateLimitConfig) burst() int {
+	if c.Burst < 1 {
+		return 1
+	}
+	return c.Burst
+}
+
+// redactedSecret replaces secret values when the config is displayed
+const redactedSecret = "REDACTED"
+
+// tokenConfig is a GitHub token given either inline or as a file to read it from
+type tokenConfig struct {
+	Token string `yaml:"token" json:"token"`
+	File  string `yaml:"file" json:"file"`
+}
+
+const (
+	matchByName = "name"
+	matchByBody = "body"
+
+	multiProjectFirst  = "first"
+	multiProjectAll    = "all"
+	multiProjectLatest = "latest"
+)
+
+// redacted returns a copy of the config that is safe to display, with inline
+// secrets replaced
+func (c *config) redacted() *config {
+	redacted := *c
+	redacted.Tokens = make(map[string]tokenConfig)
+	for owner, token := range c.Tokens {
+		if token.Token != "" {
+			token.Token = redactedSecret
+		}
+		redacted.Tokens[owner] = token
+	}
+	// incoming webhook URLs are as good as a token
+	if redacted.Slack.WebhookURL != "" {
+		redacted.Slack.WebhookURL = redactedSecret
+	}
+	if redacted.Slack.Token != "" {
+		redacted.Slack.Token = redactedSecret
+	}
+	// OTLP headers usually carry the API key of the collector
+	redacted.Tracing.Headers = make(map[string]string)
+	for name := range c.Tracing.Headers {
+		redacted.Tracing.Headers[name] = redactedSecret
+	}
+	return &redacted
+}
+
+// ignoresActor reports whether events sent by login should be ignored
+func (c *config) ignoresActor(login string) bool {
+	for _, actor := range c.IgnoreActors {
+		if strings.EqualFold(actor, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultProject returns the project flat labels act on in a repository
+func (c *config) defaultProject(owner, repo string) (string, bool) {
+	for name, project := range c.FlatLabels {
+		if strings.EqualFold(name, owner+"/"+repo) {
+			return project, true
+		}
+	}
+	return "", false
+}
+
+// columnNameData is what column name templates are rendered with
+type columnNameData struct {
+	Prefix string
+	Suffix string
+}
+
+// repoConfig overrides settings for a single repository, in `repos` or in
+// the settings file of the repository
+type repoConfig struct {
+	// Disabled ignores every event of the repository
+	Disabled bool `yaml:"disabled" json:"disabled"`
+	// AutoTriage replaces the global AutoTriage when set
+	AutoTriage *bool `yaml:"autoTriage" json:"autoTriage"`
+	// TriageLabelPattern is a regular expression picking the labels applied
+	// to opened issues instead of the `{release}/{triageSuffix}` labels
+	TriageLabelPattern string `yaml:"triageLabelPattern" json:"triageLabelPattern"`
+	// Columns adds to or replaces the column names of the global Columns
+	Columns map[string]string `yaml:"columns" json:"columns"`
+	// CardPosition replaces the global CardPosition
+	CardPosition string `yaml:"cardPosition" json:"cardPosition"`
+	// ColumnPositions adds to or replaces the positions of the global
+	// ColumnPositions
+	ColumnPositions map[string]string `yaml:"columnPositions" json:"columnPositions"`
+	// SummaryComment turns summary comments on or off for the repository
+	SummaryComment *bool `yaml:"summaryComment" json:"summaryComment"`
+}
+
+// merge returns the settings of c overridden by the ones set in override
+func (c repoConfig) merge(override repoConfig) repoConfig {
+	merged := c
+	merged.Disabled = c.Disabled || override.Disabled
+	if override.AutoTriage != nil {
+		merged.AutoTriage = override.AutoTriage
+	}
+	if override.TriageLabelPattern != "" {
+		merged.TriageLabelPattern = override.TriageLabelPattern
+	}
+	if override.CardPosition != "" {
+		merged.CardPosition = override.CardPosition
+	}
+	if override.SummaryComment != nil {
+		merged.SummaryComment = override.SummaryComment
+	}
+	merged.Columns = make(map[string]string)
+	for action, name := range c.Columns {
+		merged.Columns[action] = name
+	}
+	for action, name := range override.Columns {
+		merged.Columns[action] = name
+	}
+	merged.ColumnPositions = make(map[string]string)
+	for column, position := range c.ColumnPositions {
+		merged.ColumnPositions[column] = position
+	}
+	for column, position := range override.ColumnPositions {
+		merged.ColumnPositions[column] = position
+	}
+	return merged
+}
+
+const (
+	cardPositionTop    = "top"
+	cardPositionBottom = "bottom"
+)
+
+// repo returns the overrides of a repository, as owner/name
+func (c *config) repo(repo string) repoConfig {
+	var settings repoConfig
+	for name, overrides := range c.Repos {
+		if strings.EqualFold(name, repo) {
+			settings = overrides
+		}
+	}
+	if file, ok := c.repoFiles.get(repo); ok {
+		settings = settings.merge(file)
+	}
+	return settings
+}
+
+// autoTriage reports whether opened issues of a repository are triaged
+func (c *config) autoTriage(repo string) bool {
+	if autoTriage := c.repo(repo).AutoTriage; autoTriage != nil {
+		return *autoTriage
+	}
+	return c.AutoTriage
+}
+
+// isTriageLabel reports whether a `{release}/{action}` label of a repository
+// is applied to newly opened issues
+func (c *config) isTriageLabel(repo, label, suffix string) bool {
+	if pattern := c.repo(repo).TriageLabelPattern; pattern != "" {
+		matched, err := regexp.MatchString(pattern, label)
+		return err == nil && matched
+	}
+	return c.isTriageSuffix(suffix)
+}
+
+// cardPosition returns where cards go in a column of a repository
+func (c *config) cardPosition(repo, column string) string {
+	settings := c.repo(repo)
+	for _, positions := range []map[string]string{settings.ColumnPositions, c.ColumnPositions} {
+		for name, position := range positions {
+			if strings.EqualFold(name, column) {
+				return position
+			}
+		}
+	}
+	if position := settings.CardPosition; position != "" {
+		return position
+	}
+	if c.CardPosition != "" {
+		return c.CardPosition
+	}
+	return cardPositionTop
+}
+
+// columnTemplates returns the column name template of every known action in a
+// repository
+func (c *config) columnTemplates(repo string) map[string]string {
+	templates := make(map[string]string)
+	for action, name := range columnNames {
+		templates[action] = name
+	}
+	for action, name := range c.Columns {
+		templates[strings.ToLower(action)] = name
+	}
+	for action, name := range c.repo(repo).Columns {
+		templates[strings.ToLower(action)] = name
+	}
+	return templates
+}
+
+// columnName returns the column the action of a label moves cards to in a
+// repository, false when the action is not known
+func (c *config) columnName(repo, prefix, suffix string) (string, bool, error) {
+	name, ok := c.columnTemplates(repo)[strings.ToLower(suffix)]
+	if !ok {
+		return "", false, nil
+	}
+	rendered, err := renderColumnName(name, columnNameData{Prefix: prefix, Suffix: suffix})
+	return rendered, true, err
+}
+
+// columnAction returns the label action mapping to a column of a project with
+// the given label prefix, the reverse of columnName
+func (c *config) columnAction(repo, columnName, prefix string) (string, bool) {
+	for action, name := range c.columnTemplates(repo) {
+		rendered, err := renderColumnName(name, columnNameData{Prefix: prefix, Suffix: action})
+		if err == nil && rendered == columnName {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+func renderColumnName(name string, data columnNameData) (string, error) {
+	tmpl, err := template.New("column").Parse(name)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// isTriageSuffix reports whether labels with this action are applied to newly
+// opened issues
+func (c *config) isTriageSuffix(suffix string) bool {
+	suffixes := c.TriageSuffixes
+	if len(suffixes) == 0 {
+		suffixes = []string{"triage"}
+	}
+	for _, triage := range suffixes {
+		if strings.EqualFold(triage, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewTeam returns the team reviewing pull requests of a release
+func (c *config) reviewTeam(projectPrefix string) string {
+	for prefix, team := range c.ReviewTeams {
+		if strings.EqualFold(prefix, projectPrefix) {
+			return team
+		}
+	}
+	return ""
+}
+
+// triagesPullRequests reports whether opened pull requests are triaged
+func (c *config) triagesPullRequests() bool {
+	return c.TriagePullRequests && c.AutoTriage
+}
+
+// inheritsLabel reports whether pull requests inherit a label from the issues
+// they close
+func (c *config) inheritsLabel(label string) bool {
+	_, action, err := splitLabel(label)
+	if err != nil {
+		return false
+	}
+	for _, inherited := range c.InheritLabels {
+		if strings.EqualFold(inherited, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelineIndex returns the position of column in Pipeline, -1 if missing
+func (c *config) pipelineIndex(column string) int {
+	for i, name := range c.Pipeline {
+		if name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// isTerminalColumn reports whether cards placed in column close their issue
+func (c *config) isTerminalColumn(column string) bool {
+	for _, terminal := range c.TerminalColumns {
+		if terminal == column {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsColumn reports whether an action outside of the default column map is
+// allowed to move cards when StrictColumns is set
+func (c *config) allowsColumn(action string) bool {
+	for _, allowed := range c.AllowedColumns {
+		if strings.EqualFold(allowed, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// movesBackward reports whether moving a card from one column to another goes
+// backwards in ColumnOrder. Columns missing from ColumnOrder are never
+// considered backward moves.
+func (c *config) movesBackward(from, to string) bool {
+	fromIndex, toIndex := -1, -1
+	for i, column := range c.ColumnOrder {
+		if column == from {
+			fromIndex = i
+		}
+		if column == to {
+			toIndex = i
+		}
+	}
+	if fromIndex == -1 || toIndex == -1 {
+		return false
+	}
+	return toIndex < fromIndex
+}
+
+// actionConfig describes what happens when a `{release}/{action}` label is
+// applied, in addition to the card move.
+type actionConfig struct {
+	// Close closes the issue when the label is applied
+	Close bool `yaml:"close" json:"close"`
+	// CloseOnly closes the issue without moving its card
+	CloseOnly bool `yaml:"closeOnly" json:"closeOnly"`
+	// AllowedFrom restricts moves to cards currently in one of these columns
+	AllowedFrom []string `yaml:"allowedFrom" json:"allowedFrom"`
+	// CreateIfMissing creates a card for issues without one, true when unset
+	CreateIfMissing *bool `yaml:"createIfMissing" json:"createIfMissing"`
+}
+
+// createsIfMissing reports whether the action creates cards for issues that
+// don't have one yet, or only moves existing cards
+func (a actionConfig) createsIfMissing() bool {
+	return a.CreateIfMissing == nil || *a.CreateIfMissing
+}
+
+// allowsMoveFrom reports whether a card may be moved out of column for this
+// action. Every column is allowed when AllowedFrom is empty.
+func (a actionConfig) allowsMoveFrom(column string) bool {
+	if len(a.AllowedFrom) == 0 {
+		return true
+	}
+	for _, allowed := range a.AllowedFrom {
+		if allowed == column {
+			return true
+		}
+	}
+	return false
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{
+		MatchBy:               matchByName,
+		MultiProject:          multiProjectFirst,
+		AutoTriage:            true,
+		SkipClosedIssues:      true,
+		SkipDraftPullRequests: true,
+	}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("Could not parse config %s: %v", path, err)
+	}
+	switch cfg.MatchBy {
+	case "":
+		cfg.MatchBy = matchByName
+	case matchByName, matchByBody:
+	default:
+		return nil, fmt.Errorf("Invalid matchBy %q in config %s, expected %q or %q", cfg.MatchBy, path, matchByName, matchByBody)
+	}
+	switch cfg.MultiProject {
+	case "":
+		cfg.MultiProject = multiProjectFirst
+	case multiProjectFirst, multiProjectAll, multiProjectLatest:
+	default:
+		return nil, fmt.Errorf("Invalid multiProject %q in config %s, expected %q, %q or %q", cfg.MultiProject, path, multiProjectFirst, multiProjectAll, multiProjectLatest)
+	}
+	switch cfg.Unlabeled {
+	case "", unlabeledTriage, unlabeledRemove:
+	default:
+		return nil, fmt.Errorf("Invalid unlabeled %q in config %s, expected %q or %q", cfg.Unlabeled, path, unlabeledTriage, unlabeledRemove)
+	}
+	for _, proxy := range cfg.Audit.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q in config %s", proxy, path)
+		}
+	}
+	if cfg.Mirror.Repo != "" {
+		if owner, _ := cfg.Mirror.repo(); owner == "" {
+			return nil, fmt.Errorf("Invalid mirror repo %q in config %s, expected owner/name", cfg.Mirror.Repo, path)
+		}
+	}
+	for action, name := range cfg.Columns {
+		if _, err := renderColumnName(name, columnNameData{}); err != nil {
+			return nil, fmt.Errorf("Invalid column for %s in config %s: %v", action, path, err)
+		}
+	}
+	if cfg.ReleaseBranches != "" {
+		cfg.releaseBranches, err = regexp.Compile(cfg.ReleaseBranches)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid releaseBranches in config %s: %v", path, err)
+		}
+	}
+	if _, err := cfg.Boards.body(""); err != nil {
+		return nil, fmt.Errorf("Invalid boards body in config %s: %v", path, err)
+	}
+	if _, err := renderColumnName(cfg.Backports.Branch, columnNameData{}); err != nil {
+		return nil, fmt.Errorf("Invalid backports branch in config %s: %v", path, err)
+	}
+	if cfg.Actions, err = lowerActions(cfg.Actions); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := validAllowedRepos(cfg.AllowedRepos); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := cfg.SummaryComment.validate(); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := validCardPosition(cfg.CardPosition); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := validColumnPositions(cfg.ColumnPositions); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := cfg.Releases.validate(); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	if err := cfg.StaleCards.validate(); err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	for i := range cfg.LabelRules {
+		if err := cfg.LabelRules[i].validate(); err != nil {
+			return nil, fmt.Errorf("%v in config %s", err, path)
+		}
+	}
+	for repo, overrides := range cfg.Repos {
+		if err := overrides.validate(); err != nil {
+			return nil, fmt.Errorf("%v for %s in config %s", err, repo, path)
+		}
+	}
+	if cfg.RepoFiles.Enabled {
+		cfg.repoFiles = newRepoFiles()
+	}
+	cfg.ownerTokens, err = cfg.resolveTokens()
+	if err != nil {
+		return nil, fmt.Errorf("%v in config %s", err, path)
+	}
+	return cfg, nil
+}
+
+// lowerActions lower-cases the keys of Actions, label suffixes are looked up
+// ignoring case
+func lowerActions(actions map[string]actionConfig) (map[string]actionConfig, error) {
+	lowered := make(map[string]actionConfig, len(actions))
+	for suffix, action := range actions {
+		key := strings.ToLower(suffix)
+		if _, ok := lowered[key]; ok {
+			return nil, fmt.Errorf("Action %s is set more than once", key)
+		}
+		lowered[key] = action
+	}
+	return lowered, nil
+}
+
+func validCardPosition(position string) error {
+	switch position {
+	case "", cardPositionTop, cardPositionBottom:
+		return nil
+	}
+	return fmt.Errorf("Invalid cardPosition %q, expected %q or %q", position, cardPositionTop, cardPositionBottom)
+}
+
+// validColumnPositions checks the positions of ColumnPositions
+func validColumnPositions(positions map[string]string) error {
+	for column, position := range positions {
+		if err := validCardPosition(position); err != nil {
+			return fmt.Errorf("%v for column %s", err, column)
+		}
+	}
+	return nil
+}
+
+// resolveTokens returns the value of Tokens, reading the ones given as files
+func (c *config) resolveTokens() (map[string]string, error) {
+	tokens := make(map[string]string)
+	for owner, token := range c.Tokens {
+		if token.File == "" {
+			tokens[owner] = token.Token
+			continue
+		}
+		value, err := readSecretFile(token.File)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read token for %s: %v", owner, err)
+		}
+		tokens[owner] = value
+	}
+	return tokens, nil
+}
+
+// readConfig reads the config at path. When path is a directory every *.yaml,
+// *.yml and *.json file in it is merged in lexical order, for example one file
+// per repository. Setting the same key in more than one file is an error.
+func readConfig(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read config %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read config %s: %v", path, err)
+		}
+		return data, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read config directory %s: %v", path, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	merged := make(map[interface{}]interface{})
+	sources := make(map[string]string)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read config %s: %v", file, err)
+		}
+		// JSON is valid YAML so both parse the same way
+		values := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("Could not parse config %s: %v", file, err)
+		}
+		if err := mergeConfig(merged, values, "", file, sources); err != nil {
+			return nil, err
+		}
+	}
+	return yaml.Marshal(merged)
+}
+
+// mergeConfig merges the values read from file into dst, recursing into
+// nested maps. sources records which file set each key so conflicts can name
+// both files.
+func mergeConfig(dst, src map[interface{}]interface{}, prefix, file string, sources map[string]string) error {
+	for key, value := range src {
+		name := fmt.Sprintf("%s%v", prefix, key)
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			recordSources(value, name, file, sources)
+			continue
+		}
+		existingMap, existingIsMap := existing.(map[interface{}]interface{})
+		valueMap, valueIsMap := value.(map[interface{}]interface{})
+		if !existingIsMap || !valueIsMap {
+			return fmt.Errorf("Config key %s is set in both %s and %s", name, sources[name], file)
+		}
+		if err := mergeConfig(existingMap, valueMap, name+".", file, sources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSources records file as the source of a key and of every key nested
+// in its value
+func recordSources(value interface{}, name, file string, sources map[string]string) {
+	sources[name] = file
+	if nested, ok := value.(map[interface{}]interface{}); ok {
+		for key, value := range nested {
+			recordSources(value, fmt.Sprintf("%s.%v", name, key), file, sources)
+		}
+	}
+}
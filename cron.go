@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week. Fields are `*`, numbers, ranges like `1-5`,
+// steps like `*/15` or `0-30/10`, and comma separated lists of those.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday are set for `*` day fields, when both day
+	// fields are restricted either matching is enough, like in cron
+	anyDay, anyWeekday bool
+}
+
+// cronField is the range of values of a field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Invalid cron expression %q, expected 5 fields", expression)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		bits[i], err = cronFields[i].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q, %v", expression, err)
+		}
+	}
+	// Sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minutes:    bits[0],
+		hours:      bits[1],
+		days:       bits[2],
+		months:     bits[3],
+		weekdays:   bits[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parse returns the values of a field as a bit set
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+			item = item[:i]
+		}
+		low, high := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s %q", f.name, item)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %s %q", f.name, item)
+				}
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", f.name, item, f.min, f.max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// next returns the first time matching the schedule after t, in the time zone
+// of t, or the zero time when nothing matches within five years
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDeliveryTTL is how long delivery IDs are remembered by default
+const defaultDeliveryTTL = time.Hour
+
+// deliveryTTL returns how long delivery IDs are remembered to skip
+// redeliveries
+func (c *config) deliveryTTL() time.Duration {
+	if c.DeliveryTTL <= 0 {
+		return defaultDeliveryTTL
+	}
+	return c.DeliveryTTL
+}
+
+// seenDeliveries remembers the `X-GitHub-Delivery` IDs of recent webhooks so
+// deliveries GitHub sends again aren't applied twice
+type seenDeliveries struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// firstSeen reports whether a delivery wasn't seen within ttl, and remembers
+// it. Deliveries without an ID are always new.
+func (d *seenDeliveries) firstSeen(id string, ttl time.Duration, now time.Time) bool {
+	if id == "" {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+	for seenID, at := range d.seen {
+		if now.Sub(at) >= ttl {
+			delete(d.seen, seenID)
+		}
+	}
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	d.seen[id] = now
+	return true
+}
+
+// forget lets a delivery be handled again, for deliveries that failed
+func (d *seenDeliveries) forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, id)
+}
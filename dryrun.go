@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Dry-run services log the mutating calls of the bot instead of making them,
+// to try config changes against production repositories. Read calls go through
+// so decisions are taken against the real state of the boards. Objects that
+// would have been created come back with an ID of 0.
+
+type dryRunIssues struct {
+	issuesService
+}
+
+func (s dryRunIssues) AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error) {
+	log.Infof("DRY RUN: would add labels %v to %s/%s#%d", labels, owner, repo, number)
+	var added []*github.Label
+	for _, label := range labels {
+		added = append(added, &github.Label{Name: github.String(label)})
+	}
+	return added, nil, nil
+}
+
+func (s dryRunIssues) RemoveLabelForIssue(ctx context.Context, owner string, repo string, number int, label string) (*github.Response, error) {
+	log.Infof("DRY RUN: would remove label %v from %s/%s#%d", label, owner, repo, number)
+	return nil, nil
+}
+
+func (s dryRunIssues) Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	log.Infof("DRY RUN: would edit %s/%s#%d, state %v", owner, repo, number, issue.GetState())
+	return &github.Issue{Number: github.Int(number), State: issue.State}, nil, nil
+}
+
+func (s dryRunIssues) Create(ctx context.Context, owner string, repo string, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	log.Infof("DRY RUN: would create issue %q in %s/%s", issue.GetTitle(), owner, repo)
+	return &github.Issue{ID: github.Int(0), Number: github.Int(0), Title: issue.Title}, nil, nil
+}
+
+func (s dryRunIssues) CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	log.Infof("DRY RUN: would comment on %s/%s#%d: %q", owner, repo, number, comment.GetBody())
+	return &github.IssueComment{ID: github.Int(0), Body: comment.Body}, nil, nil
+}
+
+func (s dryRunIssues) CreateLabel(ctx context.Context, owner string, repo string, label *github.Label) (*github.Label, *github.Response, error) {
+	log.Infof("DRY RUN: would create label %v in %s/%s", label.GetName(), owner, repo)
+	return &github.Label{ID: github.Int(0), Name: label.Name, Color: label.Color}, nil, nil
+}
+
+type dryRunProjects struct {
+	projectsService
+}
+
+func (s dryRunProjects) CreateProjectColumn(ctx context.Context, projectID int, opt *github.ProjectColumnOptions) (*github.ProjectColumn, *github.Response, error) {
+	log.Infof("DRY RUN: would create column %q in project %d", opt.Name, projectID)
+	return &github.ProjectColumn{ID: github.Int(0), Name: github.String(opt.Name)}, nil, nil
+}
+
+func (s dryRunProjects) CreateProjectCard(ctx context.Context, columnID int, opt *github.ProjectCardOptions) (*github.ProjectCard, *github.Response, error) {
+	log.Infof("DRY RUN: would create a card for %s %d in column %d", opt.ContentType, opt.ContentID, columnID)
+	return &github.ProjectCard{ID: github.Int(0)}, nil, nil
+}
+
+func (s dryRunProjects) DeleteProjectCard(ctx context.Context, cardID int) (*github.Response, error) {
+	log.Infof("DRY RUN: would delete card %d", cardID)
+	return nil, nil
+}
+
+func (s dryRunProjects) MoveProjectCard(ctx context.Context, cardID int, opt *github.ProjectCardMoveOptions) (*github.Response, error) {
+	log.Infof("DRY RUN: would move card %d to the %s of column %d", cardID, opt.Position, opt.ColumnID)
+	return nil, nil
+}
+
+type dryRunReactions struct {
+	reactionsService
+}
+
+func (s dryRunReactions) CreateIssueReaction(ctx context.Context, owner, repo string, number int, content string) (*github.Reaction, *github.Response, error) {
+	log.Infof("DRY RUN: would react with %s to %s/%s#%d", content, owner, repo, number)
+	return &github.Reaction{ID: github.Int(0), Content: github.String(content)}, nil, nil
+}
+
+type dryRunRepositories struct {
+	repositoriesService
+}
+
+func (s dryRunRepositories) CreateProject(ctx context.Context, owner, repo string, opt *github.ProjectOptions) (*github.Project, *github.Response, error) {
+	log.Infof("DRY RUN: would create project %q in %s/%s", opt.Name, owner, repo)
+	return &github.Project{ID: github.Int(0), Name: github.String(opt.Name)}, nil, nil
+}
+
+type dryRunReviews struct {
+	reviewRequestsService
+}
+
+func (s dryRunReviews) RequestTeamReviewers(ctx context.Context, owner, repo string, number int, teams []string) (*github.Response, error) {
+	log.Infof("DRY RUN: would request reviews from %v on %s/%s#%d", teams, owner, repo, number)
+	return nil, nil
+}
+
+type dryRunBackports struct {
+	backportsService
+}
+
+func (s dryRunBackports) CherryPick(ctx context.Context, owner, repo, base, branch, sha string) (*github.Response, error) {
+	log.Infof("DRY RUN: would cherry-pick %s onto %s as %s in %s/%s", sha, base, branch, owner, repo)
+	return nil, nil
+}
+
+func (s dryRunBackports) CreatePullRequest(ctx context.Context, owner, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+	log.Infof("DRY RUN: would open pull request %q from %s to %s in %s/%s", pull.GetTitle(), pull.GetHead(), pull.GetBase(), owner, repo)
+	return &github.PullRequest{ID: github.Int(0), Number: github.Int(0), Title: pull.Title}, nil, nil
+}
+
+func (s dryRunBackports) DeleteBranch(ctx context.Context, owner, repo, branch string) (*github.Response, error) {
+	log.Infof("DRY RUN: would delete branch %s of %s/%s", branch, owner, repo)
+	return nil, nil
+}
+
+type dryRunProjectsV2 struct {
+	projectsV2Service
+}
+
+func (s dryRunProjectsV2) AddProjectV2Item(ctx context.Context, projectID, contentID string) (string, *github.Response, error) {
+	log.Infof("DRY RUN: would add %s to project %s", contentID, projectID)
+	return "", nil, nil
+}
+
+func (s dryRunProjectsV2) SetProjectV2Field(ctx context.Context, projectID, itemID, fieldID, optionID string) (*github.Response, error) {
+	log.Infof("DRY RUN: would set field %s of item %s in project %s to %s", fieldID, itemID, projectID, optionID)
+	return nil, nil
+}
+
+type dryRunProjectStates struct {
+	projectStatesService
+}
+
+func (s dryRunProjectStates) CloseProject(ctx context.Context, id int) (*github.Project, *github.Response, error) {
+	log.Infof("DRY RUN: would close project %d", id)
+	return &github.Project{ID: github.Int(id)}, nil, nil
+}
+
+// dryRun returns a copy of client whose mutating calls are only logged
+func dryRun(client *githubClient) *githubClient {
+	dry := *client
+	dry.Issues = dryRunIssues{client.Issues}
+	dry.Projects = dryRunProjects{client.Projects}
+	dry.Repositories = dryRunRepositories{client.Repositories}
+	dry.Reviews = dryRunReviews{client.Reviews}
+	dry.Reactions = dryRunReactions{client.Reactions}
+	dry.Backports = dryRunBackports{client.Backports}
+	dry.ProjectsV2 = dryRunProjectsV2{client.ProjectsV2}
+	dry.ProjectStates = dryRunProjectStates{client.ProjectStates}
+	return &dry
+}
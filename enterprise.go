@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// githubURLs are the API endpoints of a GitHub Enterprise Server instance, the
+// bot talks to github.com when they are empty
+type githubURLs struct {
+	baseURL   string
+	uploadURL string
+}
+
+// enterpriseURL returns a URL ending with suffix, like GitHub Enterprise
+// Server expects `https://ghes.example.com/api/v3/`
+func enterpriseURL(raw, suffix string) (*url.URL, error) {
+	if !strings.HasSuffix(raw, "/") {
+		raw += "/"
+	}
+	if !strings.HasSuffix(raw, suffix) {
+		raw += suffix
+	}
+	return url.Parse(raw)
+}
+
+// configure points a client at the enterprise endpoints, if any
+func (u githubURLs) configure(client *github.Client) error {
+	if u.baseURL == "" {
+		return nil
+	}
+	baseURL, err := enterpriseURL(u.baseURL, "api/v3/")
+	if err != nil {
+		return err
+	}
+	// uploads are served by the same host unless told otherwise
+	rawUploadURL := u.uploadURL
+	if rawUploadURL == "" {
+		rawUploadURL = strings.TrimSuffix(baseURL.String(), "api/v3/")
+	}
+	uploadURL, err := enterpriseURL(rawUploadURL, "api/uploads/")
+	if err != nil {
+		return err
+	}
+	client.BaseURL = baseURL
+	client.UploadURL = uploadURL
+	return nil
+}
+
+// graphqlURL returns the GraphQL endpoint next to the REST API of a client,
+// `/api/graphql` on GitHub Enterprise Server
+func graphqlURL(client *github.Client) string {
+	base := client.BaseURL.String()
+	if strings.HasSuffix(base, "/api/v3/") {
+		return strings.TrimSuffix(base, "v3/") + "graphql"
+	}
+	return base + "graphql"
+}
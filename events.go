@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// decision is a single action the bot took, or declined to take, for an event.
+type decision struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Repo    string    `json:"repo"`
+	Issue   int       `json:"issue"`
+	Sender  string    `json:"sender,omitempty"`
+	Action  string    `json:"action"`
+	Outcome string    `json:"outcome"`
+}
+
+// decisionLog is a fixed size ring buffer of the most recent decisions, so
+// maintainers can see why a card did or didn't move without digging in logs.
+type decisionLog struct {
+	mu      sync.Mutex
+	entries []decision
+	next    int
+	full    bool
+}
+
+func newDecisionLog(size int) *decisionLog {
+	return &decisionLog{entries: make([]decision, size)}
+}
+
+func (l *decisionLog) add(d decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = d
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the recorded decisions, oldest first
+func (l *decisionLog) list() []decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]decision{}, l.entries[:l.next]...)
+	}
+	return append(append([]decision{}, l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// since returns the decisions recorded for an issue since start
+func (l *decisionLog) since(repo string, issue int, start time.Time) []decision {
+	decisions := []decision{}
+	for _, d := range l.list() {
+		if d.Repo == repo && d.Issue == issue && !d.Time.Before(start) {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions
+}
+
+func (l *decisionLog) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// record adds a decision taken for an issues event to the decision log
+func (mon *githubMonitor) record(e *github.IssuesEvent, action, outcome string) {
+	mon.recordFor(
+		fmt.Sprintf("issues.%s", e.GetAction()),
+		e.Sender.GetLogin(),
+		fmt.Sprintf("%s/%s", *e.Repo.Owner.Login, *e.Repo.Name),
+		*e.Issue.Number,
+		action,
+		outcome,
+	)
+}
+
+// recordFor adds a decision taken for any event sent by sender to the
+// decision log and to the summary comment of the issue
+func (mon *githubMonitor) recordFor(event, sender, repo string, issue int, action, outcome string) {
+	mon.recordJob(event, sender, repo, issue, action, outcome)
+	mon.summarize(repo, issue, action, outcome)
+}
+
+// recordJob adds a decision to the decision log without summarizing it on
+// the issue, for jobs like stale card nags that already comment themselves
+func (mon *githubMonitor) recordJob(event, sender, repo string, issue int, action, outcome string) {
+	mon.decisions.add(decision{
+		Time:    time.Now(),
+		Event:   event,
+		Repo:    repo,
+		Issue:   issue,
+		Sender:  sender,
+		Action:  action,
+		Outcome: outcome,
+	})
+	mon.auditLog.add(auditRecord{
+		Time:    time.Now(),
+		Kind:    "decision",
+		Event:   event,
+		Repo:    repo,
+		Issue:   issue,
+		Sender:  sender,
+		Action:  action,
+		Outcome: outcome,
+	})
+	mon.metrics.observeDecision(action, outcome)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// exportedBoard is the state of a project board written by the export command
+type exportedBoard struct {
+	Project string           `json:"project"`
+	Columns []exportedColumn `json:"columns"`
+}
+
+type exportedColumn struct {
+	Name  string         `json:"name"`
+	Cards []exportedCard `json:"cards"`
+}
+
+// exportedCard is either the issue of a card or its note
+type exportedCard struct {
+	ID     int    `json:"id"`
+	Repo   string `json:"repo,omitempty"`
+	Number int    `json:"number,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// exportBoard writes the columns and cards of the project named projectName
+// of a repository, as owner/name, to w as JSON
+func (mon *githubMonitor) exportBoard(ctx context.Context, repository, projectName string, w io.Writer) error {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid repository %q, expected owner/name", repository)
+	}
+	owner, repo := parts[0], parts[1]
+	client := mon.clients.forOwner(owner)
+	project, err := findProject(ctx, client, owner, repo, projectName)
+	if err != nil {
+		return err
+	}
+	board := exportedBoard{Project: *project.Name, Columns: []exportedColumn{}}
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		exported, err := mon.exportColumn(ctx, client, column)
+		if err != nil {
+			return err
+		}
+		board.Columns = append(board.Columns, exported)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(board)
+}
+
+func (mon *githubMonitor) exportColumn(ctx context.Context, client *githubClient, column *github.ProjectColumn) (exportedColumn, error) {
+	exported := exportedColumn{Name: *column.Name, Cards: []exportedCard{}}
+	cards, err := listCards(ctx, client, *column.ID)
+	if err != nil {
+		return exported, err
+	}
+	for _, card := range cards {
+		exportedCard := exportedCard{ID: *card.ID, Note: card.GetNote()}
+		issue, err := mon.issueFromCard(ctx, card)
+		if err != nil && err != errNoteCard {
+			return exported, err
+		}
+		if issue != nil {
+			cardOwner, cardRepo, _, _ := parseContentURL(card.GetContentURL())
+			exportedCard.Repo = fmt.Sprintf("%s/%s", cardOwner, cardRepo)
+			exportedCard.Number = issue.GetNumber()
+			exportedCard.Title = issue.GetTitle()
+		}
+		exported.Cards = append(exported.Cards, exportedCard)
+	}
+	return exported, nil
+}
+
+// findProject returns the project of a repository named name, open or closed
+func findProject(ctx context.Context, client *githubClient, owner, repo, name string) (*github.Project, error) {
+	projects, err := listRepoProjects(ctx, client, owner, repo, "all")
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if strings.EqualFold(project.GetName(), name) {
+			return project, nil
+		}
+	}
+	return nil, fmt.Errorf("No project named %s in %s/%s", name, owner, repo)
+}
@@ -0,0 +1,671 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// fakeGitHub is an in-memory GitHub holding the boards, issues and labels of
+// repositories. It records the calls changing them so tests can check what the
+// bot did.
+type fakeGitHub struct {
+	mu     sync.Mutex
+	nextID int
+	// projects maps lower cased `owner/name` to the projects of a repository
+	projects map[string][]*github.Project
+	// columns maps project IDs to their columns, in order
+	columns map[int][]*github.ProjectColumn
+	// cards maps column IDs to their cards, from top to bottom
+	cards map[int][]*github.ProjectCard
+	// issues maps issue IDs to their issue
+	issues map[int]*github.Issue
+	// calls lists the calls changing something, like `MoveProjectCard 4 3`
+	calls []string
+	// clients counts the clients handed out, none means no call was made
+	clients int
+	// branches maps the backport branches of the repositories to whether they
+	// sit on the head of their release branch
+	branches map[string]bool
+	// pulls maps the backport branches to the number of their pull request
+	pulls map[string]int
+	// closed holds the IDs of closed projects
+	closed map[int]bool
+	// labels maps lower cased `owner/name` to the labels of a repository
+	labels map[string][]*github.Label
+	// reviews maps `owner/name#number` to the teams a pull request awaits a
+	// review from
+	reviews map[string][]string
+	// hooks run before the calls of the methods they are keyed by, an error
+	// they return fails the call
+	hooks map[string]func() error
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{
+		projects: make(map[string][]*github.Project),
+		columns:  make(map[int][]*github.ProjectColumn),
+		cards:    make(map[int][]*github.ProjectCard),
+		issues:   make(map[int]*github.Issue),
+		branches: make(map[string]bool),
+		pulls:    make(map[string]int),
+		hooks:    make(map[string]func() error),
+		labels:   make(map[string][]*github.Label),
+		closed:   make(map[int]bool),
+		reviews:  make(map[string][]string),
+	}
+}
+
+// client returns a githubClient backed by the fake
+func (f *fakeGitHub) client() *githubClient {
+	f.mu.Lock()
+	f.clients++
+	f.mu.Unlock()
+	return &githubClient{
+		Issues:       fakeIssues{f},
+		Projects:     fakeProjects{f},
+		Repositories: fakeRepositories{f},
+		Orgs:         fakeOrgs{f},
+		Cards:        fakeCards{f},
+		Backports:    fakeBackports{f},
+		Search:       fakeSearch{f},
+		Reviews:      fakeReviews{f},
+	}
+}
+
+func (f *fakeGitHub) id() int {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *fakeGitHub) record(format string, args ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+// addProject adds an open project to a repository
+func (f *fakeGitHub) addProject(repo, name string) *github.Project {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	project := &github.Project{ID: github.Int(f.id()), Name: github.String(name)}
+	key := strings.ToLower(repo)
+	f.projects[key] = append(f.projects[key], project)
+	return project
+}
+
+// closeProject closes a project, it is only listed with the closed and all
+// states
+func (f *fakeGitHub) closeProject(project *github.Project) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed[*project.ID] = true
+}
+
+// addColumn adds a column at the end of a project
+func (f *fakeGitHub) addColumn(project *github.Project, name string) *github.ProjectColumn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	column := &github.ProjectColumn{
+		ID:         github.Int(f.id()),
+		Name:       github.String(name),
+		ProjectURL: github.String(fmt.Sprintf("https://api.github.com/projects/%d", *project.ID)),
+	}
+	f.columns[*project.ID] = append(f.columns[*project.ID], column)
+	f.cards[*column.ID] = nil
+	return column
+}
+
+// addLabels adds labels to a repository
+func (f *fakeGitHub) addLabels(repo string, names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.ToLower(repo)
+	for _, name := range names {
+		f.labels[key] = append(f.labels[key], &github.Label{Name: github.String(name)})
+	}
+}
+
+// addIssue adds an open issue to a repository
+func (f *fakeGitHub) addIssue(repo string, number int, labels ...string) *github.Issue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue := &github.Issue{
+		ID:     github.Int(f.id()),
+		Number: github.Int(number),
+		State:  github.String("open"),
+		URL:    github.String(fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", repo, number)),
+	}
+	for _, label := range labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: github.String(label)})
+	}
+	f.issues[*issue.ID] = issue
+	return issue
+}
+
+// addCard adds the card of an issue at the bottom of a column
+func (f *fakeGitHub) addCard(column *github.ProjectColumn, issue *github.Issue) *github.ProjectCard {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	card := &github.ProjectCard{ID: github.Int(f.id()), ContentURL: issue.URL}
+	f.cards[*column.ID] = append(f.cards[*column.ID], card)
+	return card
+}
+
+// issueColumns returns the names of the columns holding a card of an issue
+func (f *fakeGitHub) issueColumns(project *github.Project, issue *github.Issue) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, column := range f.columns[*project.ID] {
+		for _, card := range f.cards[*column.ID] {
+			if card.GetContentURL() == issue.GetURL() {
+				names = append(names, column.GetName())
+			}
+		}
+	}
+	return names
+}
+
+// madeCalls returns the calls changing something, in order
+func (f *fakeGitHub) madeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// findCard returns the column holding a card and its index in the column
+func (f *fakeGitHub) findCard(cardID int) (int, int) {
+	for columnID, cards := range f.cards {
+		for i, card := range cards {
+			if *card.ID == cardID {
+				return columnID, i
+			}
+		}
+	}
+	return 0, -1
+}
+
+func (f *fakeGitHub) projectOf(columnID int) int {
+	for projectID, columns := range f.columns {
+		for _, column := range columns {
+			if *column.ID == columnID {
+				return projectID
+			}
+		}
+	}
+	return 0
+}
+
+// hook runs the hook of a method, if any
+func (f *fakeGitHub) hook(method string) error {
+	if hook, ok := f.hooks[method]; ok {
+		return hook()
+	}
+	return nil
+}
+
+// notFound is the error of calls about something the fake doesn't have
+func notFound(format string, args ...interface{}) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusNotFound, Request: &http.Request{}},
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// unprocessable is the error of calls conflicting with a concurrent change
+func unprocessable(format string, args ...interface{}) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity, Request: &http.Request{}},
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+type fakeIssues struct{ f *fakeGitHub }
+
+func (s fakeIssues) ListLabels(ctx context.Context, owner string, repo string, opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	return s.f.labels[strings.ToLower(owner+"/"+repo)], nil, nil
+}
+
+func (s fakeIssues) ListLabelsByIssue(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+	issue, _, err := s.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	var labels []*github.Label
+	for i := range issue.Labels {
+		labels = append(labels, &issue.Labels[i])
+	}
+	return labels, nil, nil
+}
+
+func (s fakeIssues) AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("AddLabelsToIssue %s/%s#%d %v", owner, repo, number, labels)
+	return nil, nil, nil
+}
+
+func (s fakeIssues) Get(ctx context.Context, owner string, repo string, number int) (*github.Issue, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repo, number)
+	for _, issue := range s.f.issues {
+		if strings.EqualFold(issue.GetURL(), url) {
+			return issue, nil, nil
+		}
+	}
+	return nil, nil, notFound("No issue %s/%s#%d", owner, repo, number)
+}
+
+func (s fakeIssues) ListByRepo(ctx context.Context, owner string, repo string, opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	prefix := strings.ToLower(fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/", owner, repo))
+	var issues []*github.Issue
+	for _, issue := range s.f.issues {
+		if !strings.HasPrefix(strings.ToLower(issue.GetURL()), prefix) {
+			continue
+		}
+		if opt.State != "all" && issue.GetState() != "open" {
+			continue
+		}
+		if hasLabels(issue, opt.Labels) {
+			issues = append(issues, issue)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].GetNumber() < issues[j].GetNumber() })
+	return issues, nil, nil
+}
+
+// hasLabels reports whether an issue has every label
+func hasLabels(issue *github.Issue, labels []string) bool {
+	for _, label := range labels {
+		found := false
+		for _, has := range issue.Labels {
+			found = found || has.GetName() == label
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s fakeIssues) Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("Edit %s/%s#%d", owner, repo, number)
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repo, number)
+	for _, stored := range s.f.issues {
+		if strings.EqualFold(stored.GetURL(), url) && issue.State != nil {
+			stored.State = issue.State
+		}
+	}
+	return &github.Issue{Number: github.Int(number)}, nil, nil
+}
+
+func (s fakeIssues) Create(ctx context.Context, owner string, repo string, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("Create %s/%s %s", owner, repo, issue.GetTitle())
+	id := s.f.id()
+	created := &github.Issue{
+		ID:     github.Int(id),
+		Number: github.Int(id),
+		Title:  issue.Title,
+		State:  github.String("open"),
+		URL:    github.String(fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repo, id)),
+	}
+	s.f.issues[id] = created
+	return created, nil, nil
+}
+
+func (s fakeIssues) CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("CreateComment %s/%s#%d %q", owner, repo, number, comment.GetBody())
+	return comment, nil, nil
+}
+
+func (s fakeIssues) RemoveLabelForIssue(ctx context.Context, owner string, repo string, number int, label string) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("RemoveLabelForIssue %s/%s#%d %s", owner, repo, number, label)
+	return nil, nil
+}
+
+func (s fakeIssues) CreateLabel(ctx context.Context, owner string, repo string, label *github.Label) (*github.Label, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("CreateLabel %s/%s %s", owner, repo, label.GetName())
+	return label, nil, nil
+}
+
+type fakeProjects struct{ f *fakeGitHub }
+
+func (s fakeProjects) GetProject(ctx context.Context, id int) (*github.Project, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	for _, projects := range s.f.projects {
+		for _, project := range projects {
+			if *project.ID == id {
+				return project, nil, nil
+			}
+		}
+	}
+	return nil, nil, notFound("No project %d", id)
+}
+
+func (s fakeProjects) ListProjectColumns(ctx context.Context, projectID int, opt *github.ListOptions) ([]*github.ProjectColumn, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.hook("ListProjectColumns"); err != nil {
+		return nil, nil, err
+	}
+	return append([]*github.ProjectColumn(nil), s.f.columns[projectID]...), nil, nil
+}
+
+func (s fakeProjects) GetProjectColumn(ctx context.Context, id int) (*github.ProjectColumn, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	for _, columns := range s.f.columns {
+		for _, column := range columns {
+			if *column.ID == id {
+				return column, nil, nil
+			}
+		}
+	}
+	return nil, nil, notFound("No column %d", id)
+}
+
+func (s fakeProjects) CreateProjectColumn(ctx context.Context, projectID int, opt *github.ProjectColumnOptions) (*github.ProjectColumn, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("CreateProjectColumn %d %s", projectID, opt.Name)
+	column := &github.ProjectColumn{ID: github.Int(s.f.id()), Name: github.String(opt.Name)}
+	s.f.columns[projectID] = append(s.f.columns[projectID], column)
+	s.f.cards[*column.ID] = nil
+	return column, nil, nil
+}
+
+func (s fakeProjects) GetProjectCard(ctx context.Context, cardID int) (*github.ProjectCard, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	columnID, i := s.f.findCard(cardID)
+	if i < 0 {
+		return nil, nil, notFound("No card %d", cardID)
+	}
+	card := *s.f.cards[columnID][i]
+	card.ColumnURL = github.String(fmt.Sprintf("https://api.github.com/projects/columns/%d", columnID))
+	return &card, nil, nil
+}
+
+func (s fakeProjects) ListProjectCards(ctx context.Context, columnID int, opt *github.ListOptions) ([]*github.ProjectCard, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	cards, ok := s.f.cards[columnID]
+	if !ok {
+		return nil, nil, notFound("No column %d", columnID)
+	}
+	return append([]*github.ProjectCard(nil), cards...), nil, nil
+}
+
+func (s fakeProjects) CreateProjectCard(ctx context.Context, columnID int, opt *github.ProjectCardOptions) (*github.ProjectCard, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	issue, ok := s.f.issues[opt.ContentID]
+	if !ok {
+		return nil, nil, notFound("No issue %d", opt.ContentID)
+	}
+	if _, ok := s.f.cards[columnID]; !ok {
+		return nil, nil, notFound("No column %d", columnID)
+	}
+	s.f.record("CreateProjectCard %d #%d", columnID, issue.GetNumber())
+	card := &github.ProjectCard{ID: github.Int(s.f.id()), ContentURL: issue.URL}
+	s.f.cards[columnID] = append([]*github.ProjectCard{card}, s.f.cards[columnID]...)
+	return card, nil, nil
+}
+
+func (s fakeProjects) DeleteProjectCard(ctx context.Context, cardID int) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	columnID, i := s.f.findCard(cardID)
+	if i < 0 {
+		return nil, notFound("No card %d", cardID)
+	}
+	s.f.record("DeleteProjectCard %d", cardID)
+	cards := s.f.cards[columnID]
+	s.f.cards[columnID] = append(cards[:i:i], cards[i+1:]...)
+	return nil, nil
+}
+
+func (s fakeProjects) MoveProjectCard(ctx context.Context, cardID int, opt *github.ProjectCardMoveOptions) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.hook("MoveProjectCard"); err != nil {
+		return nil, err
+	}
+	from, i := s.f.findCard(cardID)
+	if i < 0 {
+		return nil, notFound("No card %d", cardID)
+	}
+	to := opt.ColumnID
+	if to == 0 {
+		to = from
+	}
+	if _, ok := s.f.cards[to]; !ok || s.f.projectOf(to) != s.f.projectOf(from) {
+		return nil, notFound("No column %d in the project of card %d", to, cardID)
+	}
+	s.f.record("MoveProjectCard %d %d %s", cardID, to, opt.Position)
+	card := s.f.cards[from][i]
+	s.f.cards[from] = append(s.f.cards[from][:i:i], s.f.cards[from][i+1:]...)
+	if opt.Position == cardPositionBottom {
+		s.f.cards[to] = append(s.f.cards[to], card)
+	} else {
+		s.f.cards[to] = append([]*github.ProjectCard{card}, s.f.cards[to]...)
+	}
+	return nil, nil
+}
+
+type fakeRepositories struct{ f *fakeGitHub }
+
+func (s fakeRepositories) ListProjects(ctx context.Context, owner, repo string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	state := "open"
+	if opt != nil && opt.State != "" {
+		state = opt.State
+	}
+	var projects []*github.Project
+	for _, project := range s.f.projects[strings.ToLower(owner+"/"+repo)] {
+		if state == "all" || s.f.closed[*project.ID] == (state == "closed") {
+			projects = append(projects, project)
+		}
+	}
+	return projects, nil, nil
+}
+
+func (s fakeRepositories) IsCollaborator(ctx context.Context, owner, repo, user string) (bool, *github.Response, error) {
+	return true, nil, nil
+}
+
+func (s fakeRepositories) CreateProject(ctx context.Context, owner, repo string, opt *github.ProjectOptions) (*github.Project, *github.Response, error) {
+	s.f.mu.Lock()
+	s.f.record("CreateProject %s/%s %s", owner, repo, opt.Name)
+	s.f.mu.Unlock()
+	return s.f.addProject(owner+"/"+repo, opt.Name), nil, nil
+}
+
+func (s fakeRepositories) GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	return nil, nil, nil, notFound("No file %s in %s/%s", path, owner, repo)
+}
+
+type fakeOrgs struct{ f *fakeGitHub }
+
+func (s fakeOrgs) ListProjects(ctx context.Context, org string, opt *github.ProjectListOptions) ([]*github.Project, *github.Response, error) {
+	return nil, nil, notFound("No organization %s", org)
+}
+
+type fakeCards struct{ f *fakeGitHub }
+
+func (s fakeCards) ListIssueCards(ctx context.Context, owner, repo string, number int) ([]issueCard, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repo, number)
+	var found []issueCard
+	for columnID, cards := range s.f.cards {
+		for _, card := range cards {
+			if !strings.EqualFold(card.GetContentURL(), url) {
+				continue
+			}
+			c := issueCard{ID: *card.ID}
+			c.Project.ID = s.f.projectOf(columnID)
+			c.Column = &struct {
+				ID int `json:"databaseId"`
+			}{ID: columnID}
+			found = append(found, c)
+		}
+	}
+	return found, nil, nil
+}
+
+type fakeSearch struct{ f *fakeGitHub }
+
+// Issues only supports `repo:` qualifiers, every issue of the repository is
+// returned
+func (s fakeSearch) Issues(ctx context.Context, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	result := &github.IssuesSearchResult{}
+	for _, term := range strings.Fields(query) {
+		if !strings.HasPrefix(term, "repo:") {
+			continue
+		}
+		prefix := strings.ToLower(fmt.Sprintf("https://api.github.com/repos/%s/issues/", strings.TrimPrefix(term, "repo:")))
+		for _, issue := range s.f.issues {
+			if strings.HasPrefix(strings.ToLower(issue.GetURL()), prefix) {
+				result.Issues = append(result.Issues, *issue)
+			}
+		}
+	}
+	result.Total = github.Int(len(result.Issues))
+	return result, nil, nil
+}
+
+type fakeReviews struct{ f *fakeGitHub }
+
+func (s fakeReviews) ListRequestedTeams(ctx context.Context, owner, repo string, number int) ([]string, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	return s.f.reviews[fmt.Sprintf("%s/%s#%d", owner, repo, number)], nil, nil
+}
+
+func (s fakeReviews) RequestTeamReviewers(ctx context.Context, owner, repo string, number int, teams []string) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	pull := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	s.f.record("RequestTeamReviewers %s %v", pull, teams)
+	s.f.reviews[pull] = append(s.f.reviews[pull], teams...)
+	return nil, nil
+}
+
+type fakeBackports struct{ f *fakeGitHub }
+
+func (s fakeBackports) BranchExists(ctx context.Context, owner, repo, branch string) (bool, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	_, ok := s.f.branches[branch]
+	return ok, nil, nil
+}
+
+func (s fakeBackports) CherryPick(ctx context.Context, owner, repo, base, branch, sha string) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("CherryPick %s %s %s", sha, base, branch)
+	s.f.branches[branch] = true
+	return nil, nil
+}
+
+func (s fakeBackports) CreatePullRequest(ctx context.Context, owner, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("CreatePullRequest %s %s", pull.GetHead(), pull.GetBase())
+	number := s.f.id()
+	s.f.pulls[pull.GetHead()] = number
+	return &github.PullRequest{Number: github.Int(number)}, nil, nil
+}
+
+func (s fakeBackports) BranchPullRequest(ctx context.Context, owner, repo, branch string) (*github.PullRequest, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	number, ok := s.f.pulls[branch]
+	if !ok {
+		return nil, nil, nil
+	}
+	return &github.PullRequest{Number: github.Int(number)}, nil, nil
+}
+
+func (s fakeBackports) BranchOnBase(ctx context.Context, owner, repo, base, branch string) (bool, *github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	onBase, ok := s.f.branches[branch]
+	if !ok {
+		return false, nil, notFound("No branch %s", branch)
+	}
+	return onBase, nil, nil
+}
+
+func (s fakeBackports) DeleteBranch(ctx context.Context, owner, repo, branch string) (*github.Response, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.f.record("DeleteBranch %s", branch)
+	delete(s.f.branches, branch)
+	return nil, nil
+}
+
+// newTestMonitor returns a monitor whose GitHub clients are all backed by f
+func newTestMonitor(t *testing.T, f *fakeGitHub, cfg *config) *githubMonitor {
+	if cfg == nil {
+		var err error
+		if cfg, err = loadConfig(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clients := &githubClients{
+		ctx:       ctx,
+		newClient: func(ts oauth2.TokenSource) *githubClient { return f.client() },
+	}
+	clients.setTokens("token", nil, nil)
+	return &githubMonitor{
+		ctx:       ctx,
+		clients:   clients,
+		config:    cfg,
+		decisions: newDecisionLog(defaultDebugEvents),
+		metrics:   newMetrics(),
+	}
+}
+
+// labeledEvent returns the event of label being added to issue
+func labeledEvent(repo string, issue *github.Issue, label string) *github.IssuesEvent {
+	parts := strings.SplitN(repo, "/", 2)
+	return &github.IssuesEvent{
+		Action: github.String("labeled"),
+		Issue:  issue,
+		Label:  &github.Label{Name: github.String(label)},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String(parts[0])},
+			Name:  github.String(parts[1]),
+		},
+		Sender: &github.User{Login: github.String("someone")},
+	}
+}
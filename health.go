@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// readinessTTL is how long the result of a GitHub check is reused, so probes
+// don't spend the API rate limit
+const readinessTTL = time.Minute
+
+// readiness caches the result of the last GitHub check
+type readiness struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// ping makes a cheap authenticated call to check the GitHub credentials work,
+// as the app when app authentication is on and with the global token otherwise
+func (c *githubClients) ping(ctx context.Context) error {
+	c.mu.Lock()
+	app, token := c.app, c.token
+	c.mu.Unlock()
+	if app != nil {
+		_, _, err := app.client.Apps.ListInstallations(ctx, &github.ListOptions{PerPage: 1})
+		return err
+	}
+	_, _, err := c.newClient(staticToken(token)).Limits.RateLimits(ctx)
+	return err
+}
+
+// checkGithub returns the result of the last GitHub check, checking again once it
+// is older than readinessTTL
+func (mon *githubMonitor) checkGithub() error {
+	mon.readiness.mu.Lock()
+	defer mon.readiness.mu.Unlock()
+	if time.Since(mon.readiness.checkedAt) < readinessTTL {
+		return mon.readiness.err
+	}
+	ctx, cancel := context.WithTimeout(mon.ctx, 10*time.Second)
+	defer cancel()
+	mon.readiness.err = mon.clients.ping(ctx)
+	mon.readiness.checkedAt = time.Now()
+	return mon.readiness.err
+}
+
+// handleHealthz reports the bot is alive, for liveness probes
+func (mon *githubMonitor) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether the bot can handle webhooks, for readiness
+// probes: the webhook secret has to be configured and GitHub has to accept
+// the credentials of the bot
+func (mon *githubMonitor) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if len(mon.webhookSecrets()) == 0 && !mon.skipSignature {
+		http.Error(w, "No webhook secret configured", http.StatusServiceUnavailable)
+		return
+	}
+	if err := mon.checkGithub(); err != nil {
+		requestLog(r).Warnf("Not ready, GitHub check failed: %v", err)
+		http.Error(w, fmt.Sprintf("GitHub check failed: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// labelRule adds labels to the issues whose title or body match it, like
+// area/networking for issues mentioning iptables
+type labelRule struct {
+	// Labels are the labels added to matching issues
+	Labels []string `yaml:"labels" json:"labels"`
+	// Pattern is a regular expression matched against the title and body
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Keywords match when any of them is in the title or body, ignoring case
+	Keywords []string `yaml:"keywords" json:"keywords"`
+	// TitleOnly matches the title alone
+	TitleOnly bool `yaml:"titleOnly" json:"titleOnly"`
+	// Repos restricts the rule to some repositories, as `owner/name`, every
+	// repository by default
+	Repos []string `yaml:"repos" json:"repos"`
+
+	// pattern is the compiled Pattern
+	pattern *regexp.Regexp
+}
+
+func (r *labelRule) validate() error {
+	if len(r.Labels) == 0 {
+		return fmt.Errorf("Label rule without labels")
+	}
+	if r.Pattern == "" && len(r.Keywords) == 0 {
+		return fmt.Errorf("Label rule for %v without a pattern or keywords", r.Labels)
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid label rule pattern %q: %v", r.Pattern, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+// appliesTo reports whether the rule is used in a repository
+func (r *labelRule) appliesTo(repo string) bool {
+	if len(r.Repos) == 0 {
+		return true
+	}
+	for _, name := range r.Repos {
+		if strings.EqualFold(name, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule matches an issue
+func (r *labelRule) matches(issue *github.Issue) bool {
+	text := issue.GetTitle()
+	if !r.TitleOnly {
+		text += "\n" + issue.GetBody()
+	}
+	if r.pattern != nil && r.pattern.MatchString(text) {
+		return true
+	}
+	lower := strings.ToLower(text)
+	for _, keyword := range r.Keywords {
+		if strings.Contains(lower, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleLabels returns the labels of the rules matching an issue of a
+// repository that the issue doesn't have yet
+func (c *config) ruleLabels(repo string, issue *github.Issue) []string {
+	has := make(map[string]bool)
+	for _, label := range issue.Labels {
+		has[strings.ToLower(label.GetName())] = true
+	}
+	var labels []string
+	for i := range c.LabelRules {
+		rule := &c.LabelRules[i]
+		if !rule.appliesTo(repo) || !rule.matches(issue) {
+			continue
+		}
+		for _, label := range rule.Labels {
+			if !has[strings.ToLower(label)] {
+				has[strings.ToLower(label)] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// When an issue is opened or edited the labels of the `labelRules` matching
+// its title and body are added to it. Labels are never taken off, an edit
+// that no longer matches leaves them for a human to remove.
+func (mon *githubMonitor) handleLabelRules(e *github.IssuesEvent, r *http.Request) {
+	labels := mon.config.ruleLabels(repoFullName(e.Repo), e.Issue)
+	if len(labels) == 0 {
+		requestLog(r).Debugf("No label rule matches issue #%v", *e.Issue.Number)
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	requestLog(r).Infof("Adding rule labels %v to issue #%v", labels, *e.Issue.Number)
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, labels); err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "label rules", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	mon.record(e, "label rules", fmt.Sprintf("added labels %v", labels))
+	mon.stats.processed.inc()
+}
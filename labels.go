@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// labelChanges is the changes section of an edited label event, which
+// go-github doesn't decode
+type labelChanges struct {
+	Changes struct {
+		Name *struct {
+			From string `json:"from"`
+		} `json:"name"`
+	} `json:"changes"`
+}
+
+// When a `{projectPrefix}/{action}` label is renamed the issues carrying it
+// may now be in the wrong column, so re-run the placement of every issue
+// carrying the label as if the renamed label had just been applied.
+func (mon *githubMonitor) handleLabelEditedEvent(e *github.LabelEvent, payload []byte, r *http.Request) {
+	var changes labelChanges
+	if err := json.Unmarshal(payload, &changes); err != nil {
+		requestLog(r).Errorf("Failed to parse label changes, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	if changes.Changes.Name == nil || e.Repo == nil {
+		requestLog(r).Debugf("Label '%v' was edited without being renamed", *e.Label.Name)
+		mon.stats.ignored.inc()
+		return
+	}
+	requestLog(r).Infof("Label '%v' was renamed to '%v'", changes.Changes.Name.From, *e.Label.Name)
+	if _, _, err := splitLabel(*e.Label.Name); err != nil {
+		requestLog(r).Debugf("Not re-evaluating issues, %v", err)
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	opt := github.IssueListByRepoOptions{Labels: []string{*e.Label.Name}}
+	issues, err := listIssues(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, opt)
+	if err != nil {
+		requestLog(r).Errorf("Failed listing issues labeled '%v', %v", *e.Label.Name, err)
+		mon.dropError(r)
+		return
+	}
+	for _, issue := range issues {
+		requestLog(r).Infof("Re-evaluating issue #%v for renamed label '%v'", *issue.Number, *e.Label.Name)
+		mon.handleLabelEvent(&github.IssuesEvent{
+			Action: github.String("labeled"),
+			Issue:  issue,
+			Label:  e.Label,
+			Repo:   e.Repo,
+		}, r)
+	}
+}
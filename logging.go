@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestLog returns the logger for the lines about a request. They carry the
+// delivery ID, so the actions taken for one webhook can be followed end to
+// end in aggregated logs.
+func requestLog(r *http.Request) *log.Entry {
+	fields := log.Fields{"uri": r.RequestURI}
+	if delivery := github.DeliveryID(r); delivery != "" {
+		fields["delivery"] = delivery
+	}
+	if event := github.WebHookType(r); event != "" {
+		fields["event"] = event
+	}
+	return log.WithFields(fields)
+}
+
+// queuedLog returns the logger for the lines about a queued delivery, with
+// the fields of requestLog
+func queuedLog(event queuedEvent) *log.Entry {
+	return log.WithFields(log.Fields{
+		"uri":      event.RequestURI,
+		"delivery": event.Delivery,
+		"event":    event.EventType,
+	})
+}
+
+// setLogFormat switches the log output to `text` or `json`
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("Invalid log format %q, expected text or json", format)
+	}
+	return nil
+}
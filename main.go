@@ -2,93 +2,485 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
 	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
 )
 
 var (
-	webhookSecretEnvVariable = "RELEASE_BOT_WEBHOOK_SECRET"
-	githubTokenEnvVariable   = "RELEASE_BOT_GITHUB_TOKEN"
-	debugModeEnvVariable     = "RELEASE_BOT_DEBUG"
+	webhookSecretEnvVariable     = "RELEASE_BOT_WEBHOOK_SECRET"
+	webhookSecretFileEnvVariable = "RELEASE_BOT_WEBHOOK_SECRET_FILE"
+	githubTokenEnvVariable       = "RELEASE_BOT_GITHUB_TOKEN"
+	githubTokenFileEnvVariable   = "RELEASE_BOT_GITHUB_TOKEN_FILE"
+	debugModeEnvVariable         = "RELEASE_BOT_DEBUG"
+	bindAddrEnvVariable          = "RELEASE_BOT_BIND_ADDR"
+	adminTokenEnvVariable        = "RELEASE_BOT_ADMIN_TOKEN"
+	adminTokenFileEnvVariable    = "RELEASE_BOT_ADMIN_TOKEN_FILE"
+	dryRunEnvVariable            = "RELEASE_BOT_DRY_RUN"
+	allowedReposEnvVariable      = "RELEASE_BOT_ALLOWED_REPOS"
 )
 
+// advanceAction is the label action moving cards to the next column of the
+// configured pipeline
+const advanceAction = "advance"
+
+// columnNames maps label actions to the name of the column they move cards to,
+// `columns` in the config adds to them
+var columnNames = map[string]string{
+	"triage":        "Triage",
+	"cherry-pick":   "Cherry Pick",
+	"cherry-picked": "Cherry Picked",
+}
+
 type githubMonitor struct {
-	ctx    context.Context
-	secret []byte
-	client *github.Client
+	stats eventStats
+	ctx   context.Context
+	// secretMu guards secrets, which can be reloaded. Payloads signed with
+	// any of them are accepted.
+	secretMu  sync.RWMutex
+	secrets   [][]byte
+	clients   *githubClients
+	config    *config
+	decisions *decisionLog
+	// auditLog is nil unless the audit log is persisted
+	auditLog *auditLog
+	// boards is nil unless boards are cached
+	boards *boardCache
+	// adminToken protects the admin routes, which are disabled when empty
+	adminToken []byte
+	// secretSources is where secrets are read from again on /reload
+	secretSources secretSources
+	// skipSignature accepts unsigned webhooks, for local development only
+	skipSignature bool
+	// columnsMu serializes column creation
+	columnsMu sync.Mutex
+	// retries is nil unless the retry queue is enabled
+	retries *retryQueue
+	// authFailures tracks signature failures per source for `authLimit`
+	authFailures authFailures
+	// deliveries remembers recent delivery IDs to skip redeliveries
+	deliveries seenDeliveries
+	// moves remembers recent card moves for `moveThrottle`
+	moves recentMoves
+	// mirrored caches the tracking issues of mirrored labels
+	mirrored trackingIssues
+	// tracer is nil unless tracing is enabled
+	tracer *tracer
+	// summaries debounces the summary comments of the repositories that
+	// have them
+	summaries *actionSummaries
+	metrics   *metrics
+	// githubURLs are the GitHub Enterprise Server endpoints, if any
+	githubURLs githubURLs
+	readiness  readiness
+	// handlers counts the dispatched handlers still running
+	handlers sync.WaitGroup
+	// workers handles the events of each issue in order, handlers run in
+	// their own goroutine when nil
+	workers *issueWorkers
 }
 
 func (mon *githubMonitor) handleGithubWebhook(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("%s Recieved webhook", r.RequestURI)
-	payload, err := github.ValidatePayload(r, mon.secret)
+	requestLog(r).Debugf("Recieved webhook")
+	ctx, span := mon.tracer.startKind(r.Context(), "webhook", otlpKindServer)
+	defer span.finish()
+	span.setAttribute("github.delivery", github.DeliveryID(r))
+	span.setAttribute("github.event", github.WebHookType(r))
+	r = r.WithContext(ctx)
+	audit := mon.auditDelivery(r)
+	defer mon.logAudit(audit, r)
+	if err := mon.checkContentType(r); err != nil {
+		requestLog(r).Errorf("Rejecting webhook, %v", err)
+		mon.stats.droppedError.inc()
+		audit.status = http.StatusUnsupportedMediaType
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	source := mon.config.Audit.sourceIP(r)
+	limit := mon.config.AuthLimit
+	if limit.MaxFailures > 0 && mon.authFailures.exceeded(source, limit.MaxFailures, limit.window(), time.Now()) {
+		requestLog(r).Warnf("Rejecting webhook from %s, too many signature failures", source)
+		mon.stats.droppedError.inc()
+		audit.status = http.StatusTooManyRequests
+		http.Error(w, "Too many failed deliveries", http.StatusTooManyRequests)
+		return
+	}
+	payload, err := mon.readPayload(r)
 	if err != nil {
-		log.Errorf("%s Failed to validate secret, %v", r.RequestURI, err)
+		requestLog(r).Errorf("Failed to validate secret, %v", err)
+		mon.stats.droppedError.inc()
+		mon.stats.authFailures.inc()
+		if limit.MaxFailures > 0 {
+			mon.authFailures.add(source, limit.window(), time.Now())
+		}
+		audit.signature = "invalid"
+		audit.status = http.StatusUnauthorized
 		http.Error(w, "Secret did not match", http.StatusUnauthorized)
 		return
 	}
+	audit.signature = "valid"
+	if mon.skipSignature {
+		audit.signature = "skipped"
+	}
 	event, err := github.ParseWebHook(github.WebHookType(r), payload)
 	if err != nil {
-		log.Errorf("%s Failed to parse webhook, %v", r.RequestURI, err)
+		requestLog(r).Errorf("Failed to parse webhook, %v", err)
+		mon.stats.droppedError.inc()
+		audit.status = http.StatusBadRequest
 		http.Error(w, "Bad webhook payload", http.StatusBadRequest)
 		return
 	}
+	audit.describe(event)
+	if repo := eventRepository(event); repo != nil && !mon.config.allowsRepo(repoFullName(repo)) {
+		requestLog(r).Warnf("Rejecting delivery %s of %s, the repository is not allowed", github.DeliveryID(r), repoFullName(repo))
+		mon.stats.droppedError.inc()
+		audit.status = http.StatusForbidden
+		http.Error(w, "Repository not allowed", http.StatusForbidden)
+		return
+	}
+	// redeliveries long after the fact shouldn't reshuffle boards
+	if age, stale := mon.config.isStale(event, time.Now()); stale {
+		requestLog(r).Infof("Ignoring delivery %s, the event is %v old", github.DeliveryID(r), age)
+		mon.stats.ignored.inc()
+		return
+	}
+	if !mon.deliveries.firstSeen(github.DeliveryID(r), mon.config.deliveryTTL(), time.Now()) {
+		requestLog(r).Infof("Ignoring delivery %s, it was already handled", github.DeliveryID(r))
+		mon.stats.ignored.inc()
+		return
+	}
+	mon.boards.apply(event)
+	mon.metrics.observeEvent(github.WebHookType(r), payload)
+	delivery := queuedEvent{
+		Delivery:   github.DeliveryID(r),
+		EventType:  github.WebHookType(r),
+		RequestURI: r.RequestURI,
+		Payload:    payload,
+		FailedAt:   time.Now(),
+	}
+	if mon.workers != nil && mon.workers.full(issueKey(event)) {
+		mon.stats.busy.inc()
+		if audit.status = mon.deferDelivery(delivery, r); audit.status == http.StatusAccepted {
+			w.WriteHeader(http.StatusAccepted)
+		} else {
+			http.Error(w, "Too many events queued", audit.status)
+		}
+		return
+	}
+	r = withDelivery(r, delivery)
+	mon.handleDurably(event, payload, r)
+}
+
+// handleEvent dispatches a parsed webhook event to its handler
+func (mon *githubMonitor) handleEvent(event interface{}, payload []byte, r *http.Request) {
+	span := spanFromContext(r.Context())
+	key := issueKey(event)
+	if repo := eventRepository(event); repo != nil {
+		if mon.config.repoFiles != nil {
+			mon.refreshRepoFile(r, repo)
+		}
+		if mon.config.repo(repoFullName(repo)).Disabled {
+			requestLog(r).Debugf("Ignoring event of disabled repository %s", repoFullName(repo))
+			mon.stats.ignored.inc()
+			return
+		}
+	}
 	switch e := event.(type) {
 	case *github.IssuesEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		span.setAttribute("github.issue", e.Issue.GetNumber())
+		if sender := e.Sender.GetLogin(); mon.config.ignoresActor(sender) {
+			requestLog(r).Infof("Ignoring %s event from ignored actor %s", *e.Action, sender)
+			mon.record(e, *e.Action, fmt.Sprintf("ignored: actor %s", sender))
+			mon.stats.ignored.inc()
+			return
+		}
 		switch *e.Action {
 		case "labeled":
-			go mon.handleLabelEvent(e, r)
+			if label := mon.config.Boards.Label; label != "" && e.Label.GetName() == label {
+				mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleNewBoardLabel(e, r) })
+				return
+			}
+			if mon.config.Mirror.Repo != "" {
+				mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleMirrorLabel(e, r) })
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleLabelEvent(e, r) })
+		case "unlabeled":
+			if mon.config.Unlabeled == "" {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleUnlabelEvent(e, r) })
 		case "opened":
-			go mon.handleIssueOpenedEvent(e, r)
+			if len(mon.config.LabelRules) > 0 {
+				mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleLabelRules(e, r) })
+			}
+			if !mon.config.autoTriage(repoFullName(e.Repo)) {
+				requestLog(r).Debugf("Ignoring opened issue, autoTriage is disabled")
+				mon.record(e, "triage", "skipped: autoTriage is disabled")
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleIssueOpenedEvent(e, r) })
+		case "edited":
+			if len(mon.config.LabelRules) == 0 {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleLabelRules(e, r) })
+		case "closed", "reopened":
+			if mon.config.ClosedColumn == "" {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleIssueStateEvent(e, r) })
+		case "milestoned":
+			if !mon.config.Milestones.Enabled {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleMilestonedEvent(e, r) })
+		case "demilestoned":
+			if !mon.config.Milestones.Enabled || mon.config.Milestones.KeepDemilestoned {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleDemilestonedEvent(e, payload, r) })
+		default:
+			mon.stats.ignored.inc()
 		}
+	case *github.PullRequestEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		span.setAttribute("github.issue", e.PullRequest.GetNumber())
+		if sender := e.Sender.GetLogin(); mon.config.ignoresActor(sender) {
+			requestLog(r).Infof("Ignoring %s event from ignored actor %s", *e.Action, sender)
+			mon.stats.ignored.inc()
+			return
+		}
+		switch *e.Action {
+		case "opened", "ready_for_review":
+			if !mon.config.triagesPullRequests() && len(mon.config.InheritLabels) == 0 && mon.config.releaseBranches == nil {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handlePullRequestOpenedEvent(e, payload, r) })
+		case "edited":
+			if len(mon.config.InheritLabels) == 0 {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handlePullRequestEditedEvent(e, payload, r) })
+		case "labeled":
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handlePullRequestLabeledEvent(e, payload, r) })
+		case "closed":
+			if !mon.config.Backports.Enabled || !e.PullRequest.GetMerged() {
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handlePullRequestMergedEvent(e, payload, r) })
+		default:
+			mon.stats.ignored.inc()
+		}
+	case *github.IssueCommentEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		span.setAttribute("github.issue", e.Issue.GetNumber())
+		if !mon.config.SlashCommands || e.GetAction() != "created" {
+			mon.stats.ignored.inc()
+			return
+		}
+		if sender := e.Sender.GetLogin(); mon.config.ignoresActor(sender) {
+			requestLog(r).Infof("Ignoring comment from ignored actor %s", sender)
+			mon.stats.ignored.inc()
+			return
+		}
+		mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleIssueCommentEvent(e, r) })
+	case *github.ProjectCardEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		switch *e.Action {
+		// GitHub sends `converted` when a note card is converted to an issue
+		case "created", "moved", "converted":
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleProjectCardEvent(e, r) })
+		default:
+			mon.stats.ignored.inc()
+		}
+	case *github.ReleaseEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		if e.GetAction() != "published" || !mon.config.Releases.Enabled {
+			mon.stats.ignored.inc()
+			return
+		}
+		mon.dispatch(r, func(r *http.Request) { mon.handleReleaseEvent(e, r) })
+	case *github.LabelEvent:
+		span.setAttribute("github.action", e.GetAction())
+		span.setAttribute("github.repo", e.Repo.GetFullName())
+		switch *e.Action {
+		case "edited":
+			mon.dispatchIssue(key, r, func(r *http.Request) { mon.handleLabelEditedEvent(e, payload, r) })
+		default:
+			mon.stats.ignored.inc()
+		}
+	default:
+		mon.stats.ignored.inc()
 	}
 }
 
+// readPayload validates the signature of a webhook and returns its payload.
+// The signature is only ever skipped for local development when
+// -insecure-skip-signature is set.
+func (mon *githubMonitor) readPayload(r *http.Request) ([]byte, error) {
+	if !mon.skipSignature {
+		return validatePayload(r, mon.webhookSecrets())
+	}
+	requestLog(r).Warnf("INSECURE: accepting webhook without validating its signature")
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		return []byte(r.FormValue("payload")), nil
+	}
+	return ioutil.ReadAll(r.Body)
+}
+
+// checkContentType makes sure a webhook was sent with a content type we
+// accept. Form encoded payloads are only accepted when configured since their
+// signatures fail confusingly otherwise.
+func (mon *githubMonitor) checkContentType(r *http.Request) error {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("Invalid Content-Type %q: %v", r.Header.Get("Content-Type"), err)
+	}
+	switch contentType {
+	case "application/json":
+		return nil
+	case "application/x-www-form-urlencoded":
+		if mon.config.AcceptFormPayloads {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"Unsupported Content-Type %q, set the webhook's content type to application/json in the repository's webhook settings",
+		contentType,
+	)
+}
+
+// dispatch runs a handler in the background, recovering from any panic so a
+// single bad event can't take the whole bot down. The handler is given the
+// request with its own span.
+func (mon *githubMonitor) dispatch(r *http.Request, handler func(r *http.Request)) {
+	mon.dispatchIssue("", r, handler)
+}
+
+// dispatchIssue runs a handler like dispatch, after the handlers dispatched
+// before it for the same issue key. Handlers without a key run as soon as a
+// worker slot is free.
+func (mon *githubMonitor) dispatchIssue(key string, r *http.Request, handler func(r *http.Request)) {
+	delivery, tracked := deliveryFromRequest(r)
+	if tracked {
+		delivery.handlers.Add(1)
+	}
+	mon.handlers.Add(1)
+	run := func() {
+		defer mon.handlers.Done()
+		if tracked {
+			defer delivery.handlers.Done()
+		}
+		ctx, span := mon.tracer.start(r.Context(), "handle "+github.WebHookType(r))
+		defer span.finish()
+		start := time.Now()
+		defer func() {
+			mon.metrics.handlerDuration.observe(time.Since(start), github.WebHookType(r))
+		}()
+		defer func() {
+			if err := recover(); err != nil {
+				mon.stats.panics.inc()
+				requestLog(r).Errorf(
+					"Recovered from panic handling delivery %s: %v\n%s",
+					github.DeliveryID(r),
+					err,
+					debug.Stack(),
+				)
+			}
+		}()
+		handler(r.WithContext(ctx))
+	}
+	if mon.workers == nil {
+		go run()
+		return
+	}
+	mon.workers.run(key, run)
+}
+
 // When a user submits an issue to docker/release-tracking we want that issue to
-// automagically have a `triage` label for all open projects.
+// automagically have a `triage` label for all open projects, or the labels of
+// every suffix in `triageSuffixes`.
 func (mon *githubMonitor) handleIssueOpenedEvent(e *github.IssuesEvent, r *http.Request) {
-	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
+	if !mon.hasRequiredLabel(e, r) {
+		mon.record(e, "triage", fmt.Sprintf("skipped: missing label '%v'", mon.config.RequireLabel))
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
 	defer cancel()
-	labels, _, err := mon.client.Issues.ListLabels(ctx, *e.Repo.Owner.Login, *e.Repo.Name, nil)
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	labels, err := listLabels(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name)
 	if err != nil {
-		log.Errorf("%q", err)
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "triage", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
 		return
 	}
-	appliedLabelsStructs, _, err := mon.client.Issues.ListLabelsByIssue(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, nil)
+	appliedLabelsStructs, err := listIssueLabels(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number)
 	appliedLabels := make(map[string]bool)
 	if err != nil {
-		log.Errorf("%q", err)
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "triage", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
 		return
 	}
 	for _, labelStruct := range appliedLabelsStructs {
 		appliedLabels[*labelStruct.Name] = true
 	}
 	var labelsToApply []string
+	var projects []*github.Project
+	// several triage suffixes can match the same project
+	seenProjects := make(map[int]bool)
 	for _, label := range labels {
-		matched, err := regexp.MatchString(".*/triage", *label.Name)
+		projectPrefix, labelSuffix, err := splitLabel(*label.Name)
 		if err != nil {
-			log.Errorf("%q", err)
-			return
+			continue
 		}
-		if matched {
-			projectPrefix, _, err := splitLabel(*label.Name)
-			if err != nil {
-				log.Errorf("%q", err)
-				return
-			}
+		if mon.config.isTriageLabel(repoFullName(e.Repo), *label.Name, labelSuffix) {
 			// Only apply the label if there's a corresponding open project
-			if _, err := mon.getProject(projectPrefix, e); err != nil {
+			matched, err := mon.getProjects(projectPrefix, e)
+			if err != nil {
 				continue
 			}
+			if mon.config.RequireTriageColumn {
+				matched = mon.withTriageColumn(ctx, client, e, matched, projectPrefix, labelSuffix, r)
+				if len(matched) == 0 {
+					continue
+				}
+			}
+			for _, project := range matched {
+				if !seenProjects[*project.ID] {
+					seenProjects[*project.ID] = true
+					projects = append(projects, project)
+				}
+			}
 			if appliedLabels[*label.Name] == false {
 				labelsToApply = append(labelsToApply, *label.Name)
 			}
@@ -96,8 +488,8 @@ func (mon *githubMonitor) handleIssueOpenedEvent(e *github.IssuesEvent, r *http.
 	}
 	// We have labels to apply
 	if len(labelsToApply) > 0 {
-		log.Infof("%v Adding labels %v to issue #%v", r.RequestURI, labelsToApply, *e.Issue.Number)
-		_, _, err = mon.client.Issues.AddLabelsToIssue(
+		requestLog(r).Infof("Adding labels %v to issue #%v", labelsToApply, *e.Issue.Number)
+		_, _, err = client.Issues.AddLabelsToIssue(
 			ctx,
 			*e.Repo.Owner.Login,
 			*e.Repo.Name,
@@ -105,10 +497,74 @@ func (mon *githubMonitor) handleIssueOpenedEvent(e *github.IssuesEvent, r *http.
 			labelsToApply,
 		)
 		if err != nil {
-			log.Errorf("%q", err)
+			requestLog(r).Errorf("%q", err)
+			mon.record(e, "triage", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		mon.record(e, "triage", fmt.Sprintf("added labels %v", labelsToApply))
+	} else {
+		mon.record(e, "triage", "no labels to add")
+	}
+	// Also put the issue on each matching board when configured to
+	if mon.config.OpenColumn != "" {
+		for _, project := range projects {
+			mon.createOpenCard(ctx, client, project, e, r)
+		}
+	}
+	mon.stats.processed.inc()
+}
+
+// createOpenCard creates a card for a newly opened issue in the `openColumn`
+// of a project
+func (mon *githubMonitor) createOpenCard(ctx context.Context, client *githubClient, project *github.Project, e *github.IssuesEvent, r *http.Request) {
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "create card", fmt.Sprintf("error: %v", err))
+		return
+	}
+	for _, column := range columns {
+		if *column.Name != mon.config.OpenColumn {
+			continue
+		}
+		requestLog(r).Infof(
+			"Creating card for issue #%v in project %v in column '%v'",
+			*e.Issue.Number,
+			*project.Name,
+			*column.Name,
+		)
+		card, _, err := client.Projects.CreateProjectCard(
+			ctx,
+			*column.ID,
+			&github.ProjectCardOptions{
+				ContentID:   *e.Issue.ID,
+				ContentType: cardContentType(e.Issue),
+			},
+		)
+		if err == nil {
+			err = positionNewCard(ctx, client, card, *column.ID, mon.config.cardPosition(repoFullName(e.Repo), *column.Name), r)
+		}
+		if err != nil {
+			requestLog(r).Errorf(
+				"Failed creating card for issue #%v in project %v in column '%v':\n%v",
+				*e.Issue.Number,
+				*project.Name,
+				*column.Name,
+				err,
+			)
+			mon.record(e, "create card", fmt.Sprintf("error: %v", err))
 			return
 		}
+		mon.record(e, "create card", fmt.Sprintf("created in %v/%v", *project.Name, *column.Name))
+		return
 	}
+	requestLog(r).Infof(
+		"Requested destination column '%v' does not exist for project '%v'",
+		mon.config.OpenColumn,
+		*project.Name,
+	)
+	mon.record(e, "create card", fmt.Sprintf("skipped: column '%v' does not exist", mon.config.OpenColumn))
 }
 
 // When a user adds a label matching {projectPrefix}/{action} it should move the
@@ -125,123 +581,557 @@ func (mon *githubMonitor) handleIssueOpenedEvent(e *github.IssuesEvent, r *http.
 //       For example a mapping of label `17.03.1-ee/bleh` should move that issue
 //       to the bleh column of the open project of 17.03.1-ee-1-rc1 if that column
 //       exists
+//
+// NOTE: Actions configured with `close` also close the issue, and with
+//       `closeOnly` the card is left where it is
+//
+// NOTE: Actions configured with `allowedFrom` only move cards that are
+//       currently in one of the listed columns
+//
+// NOTE: With a `pipeline` configured the `advance` action moves the card to
+//       the pipeline column following its current one
+//
+// NOTE: With `strictColumns` set labels outside of the defined label map are
+//       ignored unless their action is listed in `allowedColumns`
+//
+// NOTE: Cards of closed issues are left alone unless `skipClosedIssues` is
+//       turned off
+//
+// NOTE: Repositories listed in `flatLabels` also accept labels without a
+//       release prefix, like `cherry-pick`, which act on their default project
 func (mon *githubMonitor) handleLabelEvent(e *github.IssuesEvent, r *http.Request) {
-	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
+	if !mon.hasRequiredLabel(e, r) {
+		mon.record(e, "move", fmt.Sprintf("skipped: missing label '%v'", mon.config.RequireLabel))
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
 	defer cancel()
-	var columnID, cardID int
-	var sourceColumn, destColumn github.ProjectColumn
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
 	projectPrefix, labelSuffix, err := splitLabel(*e.Label.Name)
+	// flat labels like `cherry-pick` act on the default project of the repo
+	defaultProject, flat := mon.config.defaultProject(*e.Repo.Owner.Login, *e.Repo.Name)
+	flat = flat && !strings.Contains(*e.Label.Name, "/")
+	if flat {
+		labelSuffix, err = *e.Label.Name, nil
+	}
 	if err != nil {
-		log.Errorf("%q", err)
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
 		return
 	}
-	project, err := mon.getProject(projectPrefix, e)
-	if err != nil {
-		log.Errorf("%q", err)
+	// Actions match regardless of case, so `Triage` and `TRIAGE` act like `triage`
+	normalizedSuffix := strings.ToLower(labelSuffix)
+	action := mon.config.Actions[normalizedSuffix]
+	if action.Close || action.CloseOnly {
+		reason := fmt.Sprintf("label '%v'", *e.Label.Name)
+		mon.record(e, "close", closeIssue(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, e.Issue, reason, r))
+		if action.CloseOnly {
+			mon.stats.processed.inc()
+			return
+		}
+	}
+	// late or redelivered labels shouldn't pull closed issues back on the board
+	if mon.config.SkipClosedIssues && e.Issue.GetState() == "closed" {
+		requestLog(r).Infof("Not moving issue #%v, it is closed", *e.Issue.Number)
+		mon.record(e, "move", "skipped: issue is closed")
+		mon.stats.ignored.inc()
 		return
 	}
-	columns, _, err := mon.client.Projects.ListProjectColumns(ctx, *project.ID, nil)
+	// advancing picks the destination column once the card has been found
+	advance := normalizedSuffix == advanceAction && len(mon.config.Pipeline) > 0
+	columnName, known, err := mon.config.columnName(repoFullName(e.Repo), projectPrefix, labelSuffix)
 	if err != nil {
-		log.Errorf("%q", err)
+		requestLog(r).Errorf("Could not render the column of label '%v', %v", *e.Label.Name, err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.stats.droppedError.inc()
 		return
 	}
-	columnName := map[string]string{
-		"triage":        "Triage",
-		"cherry-pick":   "Cherry Pick",
-		"cherry-picked": "Cherry Picked",
-	}[labelSuffix]
-	if columnName == "" {
+	if !known && !advance {
+		if mon.config.StrictColumns && !mon.config.allowsColumn(labelSuffix) {
+			requestLog(r).Warnf("Ignoring label '%v', '%v' is not a known action", *e.Label.Name, labelSuffix)
+			mon.record(e, "move", fmt.Sprintf("skipped: unknown action '%v'", labelSuffix))
+			mon.stats.ignored.inc()
+			return
+		}
 		columnName = labelSuffix
 	}
+	if mon.config.ProjectsV2.Enabled && !flat {
+		if advance {
+			mon.record(e, "move", "skipped: advance is not supported with Projects (V2)")
+			mon.stats.ignored.inc()
+			return
+		}
+		mon.handleProjectV2Label(ctx, client, e, projectPrefix, columnName, r)
+		return
+	}
+	placement := labelPlacement{
+		labelSuffix: labelSuffix,
+		columnName:  columnName,
+		advance:     advance,
+		action:      action,
+	}
+	var projects []*github.Project
+	if flat {
+		var project *github.Project
+		project, err = mon.getDefaultProject(defaultProject, e)
+		projects = []*github.Project{project}
+	} else {
+		projects, err = mon.getProjects(projectPrefix, e)
+	}
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
+		return
+	}
+	for _, project := range projects {
+		mon.placeCard(ctx, client, e, project, placement, r)
+	}
+}
+
+// labelPlacement is where a `{release}/{action}` label asks for the card of
+// an issue to go
+type labelPlacement struct {
+	labelSuffix string
+	columnName  string
+	// advance picks the column once the card has been found
+	advance bool
+	action  actionConfig
+}
+
+// placeCard creates or moves the card of the issue of a label event in a
+// project, according to the placement requested by the label
+func (mon *githubMonitor) placeCard(ctx context.Context, client *githubClient, e *github.IssuesEvent, project *github.Project, placement labelPlacement, r *http.Request) {
+	var columnID, cardID int
+	var duplicateCardIDs []int
+	var duplicateColumns []string
+	var sourceColumn, destColumn github.ProjectColumn
+	columnName := placement.columnName
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
 	for _, column := range columns {
 		// Found our column to move into
 		if *column.Name == columnName {
 			destColumn = *column
 			columnID = *column.ID
 		}
-		cards, _, err := mon.client.Projects.ListProjectCards(ctx, *column.ID, nil)
-		if err != nil {
-			log.Errorf("%q", err)
+	}
+	cards, err := issueCards(ctx, client, project, columns, e)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	for _, found := range cards {
+		// Keep the first card found, any others are duplicates
+		if cardID == 0 {
+			sourceColumn = *found.column
+			cardID = *found.card.ID
+		} else {
+			duplicateCardIDs = append(duplicateCardIDs, *found.card.ID)
+			duplicateColumns = append(duplicateColumns, *found.column.Name)
+		}
+	}
+
+	// issue has cards in more than one column
+	if len(duplicateCardIDs) > 0 {
+		requestLog(r).Warnf(
+			"Issue #%v has duplicate cards in project %v, using the card in '%v' and ignoring the cards in %v",
+			*e.Issue.Number,
+			*project.Name,
+			*sourceColumn.Name,
+			duplicateColumns,
+		)
+		if mon.config.DeleteDuplicateCards {
+			for i, duplicateCardID := range duplicateCardIDs {
+				requestLog(r).Infof(
+					"Deleting duplicate card for issue #%v in project %v from '%v'",
+					*e.Issue.Number,
+					*project.Name,
+					duplicateColumns[i],
+				)
+				if _, err := client.Projects.DeleteProjectCard(ctx, duplicateCardID); err != nil {
+					requestLog(r).Errorf("Failed deleting duplicate card %v:\n%v", duplicateCardID, err)
+				}
+			}
+		}
+	}
+
+	// card moves to the column after its current one in the pipeline
+	if placement.advance {
+		if cardID == 0 {
+			requestLog(r).Infof("Not advancing issue #%v, it has no card in project %v", *e.Issue.Number, *project.Name)
+			mon.record(e, "advance", fmt.Sprintf("skipped: no card in %v", *project.Name))
+			mon.stats.ignored.inc()
+			return
+		}
+		index := mon.config.pipelineIndex(*sourceColumn.Name)
+		if index == -1 || index == len(mon.config.Pipeline)-1 {
+			requestLog(r).Infof(
+				"Not advancing issue #%v in project %v, '%v' is not followed by another pipeline column",
+				*e.Issue.Number,
+				*project.Name,
+				*sourceColumn.Name,
+			)
+			mon.record(e, "advance", fmt.Sprintf("skipped: nothing after '%v' in the pipeline", *sourceColumn.Name))
+			mon.stats.ignored.inc()
 			return
 		}
-		for _, card := range cards {
-			if *card.ContentURL == *e.Issue.URL {
-				sourceColumn = *column
-				cardID = *card.ID
+		columnName = mon.config.Pipeline[index+1]
+		for _, column := range columns {
+			if *column.Name == columnName {
+				destColumn = *column
+				columnID = *column.ID
 			}
 		}
 	}
 
 	// destination column doesn't exist
 	if destColumn == (github.ProjectColumn{}) {
-		log.Infof(
-			"%s Requested destination column '%v' does not exist for project '%v'",
+		requestLog(r).Infof(
+			"Requested destination column '%v' does not exist for project '%v'",
 			columnName,
 			*project.Name,
 		)
+		if !mon.config.CreateMissingColumns {
+			mon.record(e, "move", fmt.Sprintf("skipped: column '%v' does not exist", columnName))
+			mon.stats.ignored.inc()
+			return
+		}
+		column, err := mon.createColumn(ctx, client, project, columnName, r)
+		if err != nil {
+			requestLog(r).Errorf("Failed creating column '%v' in project %v:\n%v", columnName, *project.Name, err)
+			mon.record(e, "create column", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		destColumn = *column
+		columnID = *column.ID
+	}
+
+	// card exists but the action only moves cards out of specific columns
+	if cardID != 0 && !placement.action.allowsMoveFrom(*sourceColumn.Name) {
+		requestLog(r).Infof(
+			"Not moving issue #%v in project %v, '%v' is not an allowed source column for '%v'",
+			*e.Issue.Number,
+			*project.Name,
+			*sourceColumn.Name,
+			placement.labelSuffix,
+		)
+		mon.record(e, "move", fmt.Sprintf("skipped: '%v' is not an allowed source column", *sourceColumn.Name))
+		mon.stats.ignored.inc()
+		return
+	}
+
+	// card exists but moving it would send it backwards on the board
+	if cardID != 0 && mon.config.movesBackward(*sourceColumn.Name, *destColumn.Name) {
+		requestLog(r).Infof(
+			"Not moving issue #%v in project %v backwards from '%v' to '%v'",
+			*e.Issue.Number,
+			*project.Name,
+			*sourceColumn.Name,
+			*destColumn.Name,
+		)
+		mon.record(e, "move", fmt.Sprintf("skipped: '%v' is before '%v'", *destColumn.Name, *sourceColumn.Name))
+		mon.stats.ignored.inc()
+		return
+	}
+
+	// card does not exist and the action only moves existing cards
+	if cardID == 0 && !placement.action.createsIfMissing() {
+		requestLog(r).Infof(
+			"Not creating card for issue #%v in project %v, '%v' only moves existing cards",
+			*e.Issue.Number,
+			*project.Name,
+			placement.labelSuffix,
+		)
+		mon.record(e, "move", fmt.Sprintf("skipped: no card in %v", *project.Name))
+		mon.stats.ignored.inc()
+		return
+	}
+
+	// card would go over the WIP limit of its destination column
+	if limit, ok := mon.config.WIPLimits[*destColumn.Name]; ok && limit.Limit > 0 && (cardID == 0 || *sourceColumn.ID != columnID) {
+		count, err := countCards(ctx, client, columnID)
+		if err != nil {
+			requestLog(r).Errorf("Failed counting cards in '%v' of project %v:\n%v", *destColumn.Name, *project.Name, err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		if count+1 > limit.Limit {
+			requestLog(r).Infof(
+				"Column '%v' of project %v is at its WIP limit of %v",
+				*destColumn.Name,
+				*project.Name,
+				limit.Limit,
+			)
+			if limit.Block {
+				mon.record(e, "move", fmt.Sprintf("skipped: '%v' is at its WIP limit of %v", *destColumn.Name, limit.Limit))
+				mon.stats.ignored.inc()
+				return
+			}
+			mon.warnWIPLimit(ctx, client, e, project, *destColumn.Name, limit.Limit, r)
+		}
 	}
 
 	// card does not exist
 	if cardID == 0 {
-		contentType := "Issue"
-		if e.Issue.PullRequestLinks != nil {
-			contentType = "PullRequest"
-		}
-		log.Infof(
-			"%s Creating card for issue #%v in project %v in column '%v'",
-			r.RequestURI,
+		requestLog(r).Infof(
+			"Creating card for issue #%v in project %v in column '%v'",
 			*e.Issue.Number,
 			*project.Name,
 			*destColumn.Name,
 		)
-		_, _, err := mon.client.Projects.CreateProjectCard(
+		card, _, err := client.Projects.CreateProjectCard(
 			ctx,
 			columnID,
 			&github.ProjectCardOptions{
 				ContentID:   *e.Issue.ID,
-				ContentType: contentType,
+				ContentType: cardContentType(e.Issue),
 			},
 		)
+		if err == nil {
+			err = positionNewCard(ctx, client, card, columnID, mon.config.cardPosition(repoFullName(e.Repo), *destColumn.Name), r)
+		}
 		if err != nil {
-			log.Errorf(
-				"%s Failed creating card for issue #%v in project %v in column '%v':\n%v",
-				r.RequestURI,
+			requestLog(r).Errorf(
+				"Failed creating card for issue #%v in project %v in column '%v':\n%v",
 				*e.Issue.Number,
 				*project.Name,
 				*destColumn.Name,
 				err,
 			)
+			mon.record(e, "create card", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
 		}
+		mon.record(e, "create card", fmt.Sprintf("created in %v/%v", *project.Name, *destColumn.Name))
+		mon.stats.processed.inc()
+		mon.notifySlack(e, project, *destColumn.Name, r)
+		mon.closeIfTerminal(ctx, client, e, *destColumn.Name, r)
 	} else {
-		log.Infof(
-			"%s Moving issue #%v in project %v from '%v' to '%v'",
-			r.RequestURI,
+		if mon.config.MoveThrottle > 0 && !mon.moves.allow(cardID, columnID, mon.config.MoveThrottle, time.Now()) {
+			requestLog(r).Infof(
+				"Not moving issue #%v in project %v to '%v' again within %v",
+				*e.Issue.Number,
+				*project.Name,
+				*destColumn.Name,
+				mon.config.MoveThrottle,
+			)
+			mon.record(e, "move", fmt.Sprintf("skipped: moved to %v within %v", *destColumn.Name, mon.config.MoveThrottle))
+			mon.stats.ignored.inc()
+			return
+		}
+		requestLog(r).Infof(
+			"Moving issue #%v in project %v from '%v' to '%v'",
 			*e.Issue.Number,
 			*project.Name,
 			*sourceColumn.Name,
 			*destColumn.Name,
 		)
-		_, err = mon.client.Projects.MoveProjectCard(
-			ctx,
-			cardID,
-			&github.ProjectCardMoveOptions{
-				Position: "top",
-				ColumnID: columnID,
-			},
-		)
-
+		err := moveCard(ctx, client, cardID, columnID, mon.config.cardPosition(repoFullName(e.Repo), *destColumn.Name), r)
 		if err != nil {
-			log.Errorf(
-				"%s Move failed for issue #%v in project %v from '%v' to '%v':\n%v",
-				r.RequestURI,
+			requestLog(r).Errorf(
+				"Move failed for issue #%v in project %v from '%v' to '%v':\n%v",
 				*e.Issue.Number,
 				*project.Name,
 				*sourceColumn.Name,
 				*destColumn.Name,
 				err,
 			)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		mon.record(e, "move", fmt.Sprintf("moved from %v to %v in %v", *sourceColumn.Name, *destColumn.Name, *project.Name))
+		mon.stats.processed.inc()
+		mon.notifySlack(e, project, *destColumn.Name, r)
+		mon.closeIfTerminal(ctx, client, e, *destColumn.Name, r)
+	}
+}
+
+// withTriageColumn returns the projects having the column a triage label moves
+// cards to
+func (mon *githubMonitor) withTriageColumn(ctx context.Context, client *githubClient, e *github.IssuesEvent, projects []*github.Project, projectPrefix, labelSuffix string, r *http.Request) []*github.Project {
+	columnName, known, err := mon.config.columnName(repoFullName(e.Repo), projectPrefix, labelSuffix)
+	if !known {
+		columnName = labelSuffix
+	}
+	if err != nil {
+		requestLog(r).Errorf("Could not render the triage column, %v", err)
+		return nil
+	}
+	var withColumn []*github.Project
+	for _, project := range projects {
+		columns, err := listColumns(ctx, client, *project.ID)
+		if err != nil {
+			requestLog(r).Errorf("%q", err)
+			continue
+		}
+		found := false
+		for _, column := range columns {
+			if *column.Name == columnName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			requestLog(r).Debugf("Not triaging for project %v, it has no '%v' column", *project.Name, columnName)
+			continue
+		}
+		withColumn = append(withColumn, project)
+	}
+	return withColumn
+}
+
+// repoFullName returns the owner/name of a repository
+func repoFullName(repo *github.Repository) string {
+	return fmt.Sprintf("%s/%s", repo.Owner.GetLogin(), repo.GetName())
+}
+
+// cardContentType returns the content type of a project card for an issue
+func cardContentType(issue *github.Issue) string {
+	if issue.PullRequestLinks != nil {
+		return "PullRequest"
+	}
+	return "Issue"
+}
+
+// hasRequiredLabel reports whether the issue of an event carries the label
+// configured with `requireLabel`, always true when none is configured
+func (mon *githubMonitor) hasRequiredLabel(e *github.IssuesEvent, r *http.Request) bool {
+	if mon.config.RequireLabel == "" {
+		return true
+	}
+	for _, label := range e.Issue.Labels {
+		if label.GetName() == mon.config.RequireLabel {
+			return true
+		}
+	}
+	requestLog(r).Debugf("Ignoring issue #%v without label '%v'", *e.Issue.Number, mon.config.RequireLabel)
+	return false
+}
+
+// positionNewCard moves a card just created, which GitHub puts at the top of
+// its column, to where the cards of the column go
+func positionNewCard(ctx context.Context, client *githubClient, card *github.ProjectCard, columnID int, position string, r *http.Request) error {
+	if position == cardPositionTop || card == nil {
+		return nil
+	}
+	return moveCard(ctx, client, *card.ID, columnID, position, r)
+}
+
+// moveCard moves a card to the top, the bottom or after another card of a
+// column. When two events race the move can conflict, in which case the card
+// is re-fetched: if it is already in the destination column the move is
+// done, otherwise it is retried once.
+func moveCard(ctx context.Context, client *githubClient, cardID, columnID int, position string, r *http.Request) error {
+	opt := &github.ProjectCardMoveOptions{
+		Position: position,
+		ColumnID: columnID,
+	}
+	_, err := client.Projects.MoveProjectCard(ctx, cardID, opt)
+	if !isConflict(err) {
+		return err
+	}
+	card, _, getErr := client.Projects.GetProjectCard(ctx, cardID)
+	if getErr != nil {
+		requestLog(r).Debugf("Could not re-fetch card %v after conflict, %v", cardID, getErr)
+		return err
+	}
+	if cardColumnID(card) == columnID {
+		requestLog(r).Debugf("Card %v was already moved to column %v", cardID, columnID)
+		return nil
+	}
+	requestLog(r).Debugf("Retrying move of card %v to column %v after conflict", cardID, columnID)
+	_, err = client.Projects.MoveProjectCard(ctx, cardID, opt)
+	return err
+}
+
+// isConflict reports whether err is a 409 or 422 response from GitHub
+func isConflict(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	if !ok || errResp.Response == nil {
+		return false
+	}
+	return errResp.Response.StatusCode == http.StatusConflict ||
+		errResp.Response.StatusCode == http.StatusUnprocessableEntity
+}
+
+// cardColumnID returns the ID of the column a card is in
+func cardColumnID(card *github.ProjectCard) int {
+	if card.ColumnID != nil {
+		return *card.ColumnID
+	}
+	// column_url looks like https://api.github.com/projects/columns/367
+	columnURL := card.GetColumnURL()
+	id, _ := strconv.Atoi(columnURL[strings.LastIndex(columnURL, "/")+1:])
+	return id
+}
+
+// createColumn creates a column in a project unless it already exists.
+// Creation is serialized and the columns re-listed under the lock so that
+// concurrent events can't create the same column twice.
+func (mon *githubMonitor) createColumn(ctx context.Context, client *githubClient, project *github.Project, columnName string, r *http.Request) (*github.ProjectColumn, error) {
+	mon.columnsMu.Lock()
+	defer mon.columnsMu.Unlock()
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range columns {
+		if *column.Name == columnName {
+			return column, nil
 		}
 	}
+	requestLog(r).Infof("Creating column '%v' in project %v", columnName, *project.Name)
+	column, _, err := client.Projects.CreateProjectColumn(
+		ctx,
+		*project.ID,
+		&github.ProjectColumnOptions{Name: columnName},
+	)
+	return column, err
+}
+
+// closeIfTerminal closes the issue of an event when its card was placed in one
+// of the configured terminal columns
+func (mon *githubMonitor) closeIfTerminal(ctx context.Context, client *githubClient, e *github.IssuesEvent, columnName string, r *http.Request) {
+	if !mon.config.isTerminalColumn(columnName) {
+		return
+	}
+	reason := fmt.Sprintf("terminal column '%v'", columnName)
+	mon.record(e, "close", closeIssue(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, e.Issue, reason, r))
+}
+
+// closeIssue closes an issue unless it is already closed, returning the
+// outcome for the decision log
+func closeIssue(ctx context.Context, client *githubClient, owner, repo string, issue *github.Issue, reason string, r *http.Request) string {
+	if issue.GetState() == "closed" {
+		requestLog(r).Debugf("Issue #%v is already closed", *issue.Number)
+		return "skipped: already closed"
+	}
+	requestLog(r).Infof("Closing issue #%v for %v", *issue.Number, reason)
+	_, _, err := client.Issues.Edit(
+		ctx,
+		owner,
+		repo,
+		*issue.Number,
+		&github.IssueRequest{State: github.String("closed")},
+	)
+	if err != nil {
+		requestLog(r).Errorf("Failed closing issue #%v:\n%v", *issue.Number, err)
+		return fmt.Sprintf("error: %v", err)
+	}
+	return "closed"
 }
 
 func splitLabel(label string) (string, string, error) {
@@ -252,46 +1142,157 @@ func splitLabel(label string) (string, string, error) {
 	return splitResults[0], splitResults[1], nil
 }
 
-func (mon *githubMonitor) getProject(projectPrefix string, e *github.IssuesEvent) (*github.Project, error) {
-	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
-	defer cancel()
-	projects, _, err := mon.client.Repositories.ListProjects(
-		ctx,
-		*e.Repo.Owner.Login,
-		*e.Repo.Name,
-		&github.ProjectListOptions{State: "open"},
-	)
+// getProjects returns the open projects matching a label prefix, only one of
+// them unless `multiProject` is `all`
+func (mon *githubMonitor) getProjects(projectPrefix string, e *github.IssuesEvent) ([]*github.Project, error) {
+	projects, err := mon.listOpenProjects(e)
+	if err != nil {
+		return nil, err
+	}
+	matched := mon.matchProjects(projects, projectPrefix)
+	// recently closed releases can still have their cards placed
+	if len(matched) == 0 && mon.config.IncludeClosedProjects {
+		projects, err = mon.listProjects(e, "all")
+		if err != nil {
+			return nil, err
+		}
+		matched = mon.matchProjects(projects, projectPrefix)
+		for _, project := range matched {
+			log.Infof("Matched closed project %v for prefix %s", *project.Name, projectPrefix)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("No project found with prefix %s", projectPrefix)
+	}
+	return matched, nil
+}
+
+// matchProjects returns the projects matching a label prefix, only the first
+// one unless `multiProject` is `all`, or the latest one when it is `latest`
+func (mon *githubMonitor) matchProjects(projects []*github.Project, projectPrefix string) []*github.Project {
+	var matched []*github.Project
+	for _, project := range projects {
+		if !projectMatches(project, projectPrefix, mon.config.MatchBy) {
+			continue
+		}
+		matched = append(matched, project)
+		if mon.config.MultiProject == multiProjectFirst {
+			break
+		}
+	}
+	if mon.config.MultiProject == multiProjectLatest && len(matched) > 1 {
+		names := make([]string, len(matched))
+		for i, project := range matched {
+			names[i] = project.GetName()
+		}
+		latest := latestVersion(names)
+		matched = matched[latest : latest+1]
+	}
+	return matched
+}
+
+// getDefaultProject returns the open project named name, used for the flat
+// labels of repositories configured in `flatLabels`
+func (mon *githubMonitor) getDefaultProject(name string, e *github.IssuesEvent) (*github.Project, error) {
+	projects, err := mon.listOpenProjects(e)
 	if err != nil {
 		return nil, err
 	}
 	for _, project := range projects {
-		if strings.HasPrefix(*project.Name, projectPrefix) {
+		if strings.EqualFold(project.GetName(), name) {
 			return project, nil
 		}
 	}
-	return nil, fmt.Errorf("No project found with prefix %s", projectPrefix)
+	return nil, fmt.Errorf("No open project named %s", name)
 }
 
-func main() {
-	debug := flag.Bool("debug", false, "Toggle debug mode")
-	port := flag.String("port", "8080", "Port to bind release-bot to")
-	flag.Parse()
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv(githubTokenEnvVariable)},
-	)
-	client := github.NewClient(oauth2.NewClient(ctx, ts))
-	if *debug || os.Getenv(debugModeEnvVariable) != "" {
-		log.SetLevel(log.DebugLevel)
-		log.Debug("Log level set to debug")
+func (mon *githubMonitor) listOpenProjects(e *github.IssuesEvent) ([]*github.Project, error) {
+	return mon.listProjects(e, "open")
+}
+
+// listProjects returns the projects of the repository of an event in state,
+// one of open, closed or all, followed by the ones of its organization when
+// `orgProjects` is set
+func (mon *githubMonitor) listProjects(e *github.IssuesEvent, state string) ([]*github.Project, error) {
+	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	projects, err := listRepoProjects(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, state)
+	if err != nil || !mon.config.OrgProjects {
+		return projects, err
+	}
+	orgProjects, err := listOrgProjects(ctx, client, *e.Repo.Owner.Login, state)
+	// repositories owned by users have no organization projects
+	if isNotFound(err) {
+		return projects, nil
 	}
-	monitor := githubMonitor{
-		ctx:    ctx,
-		secret: []byte(os.Getenv(webhookSecretEnvVariable)),
-		client: client,
+	if err != nil {
+		return nil, err
 	}
+	return append(projects, orgProjects...), nil
+}
+
+// projectMarker finds `release-bot: {prefix}` lines in a project body
+var projectMarker = regexp.MustCompile(`(?m)^\s*release-bot:\s*(\S+)\s*$`)
+
+func projectMatches(project *github.Project, projectPrefix, matchBy string) bool {
+	if matchBy == matchByBody {
+		for _, marker := range projectMarker.FindAllStringSubmatch(project.GetBody(), -1) {
+			if marker[1] == projectPrefix {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.HasPrefix(*project.Name, projectPrefix)
+}
+
+// readSecret reads a secret from file, as mounted by Kubernetes secrets,
+// falling back to the inline env variable when no file is given.
+func readSecret(file, envVariable string) (string, error) {
+	if file == "" {
+		return os.Getenv(envVariable), nil
+	}
+	return readSecretFile(file)
+}
+
+// readSecretFile reads a secret from file, trimming any trailing newline
+func readSecretFile(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// parseLogLevel parses a logrus level name. Our logrus has no trace level, so
+// trace falls back to debug which is already the most verbose.
+func parseLogLevel(level string) (log.Level, error) {
+	if strings.ToLower(level) == "trace" {
+		return log.DebugLevel, nil
+	}
+	return log.ParseLevel(level)
+}
+
+// newRouter wires the routes of the bot to mon. The webhook route catches
+// every other POST so it must stay last.
+func newRouter(mon *githubMonitor) *mux.Router {
 	router := mux.NewRouter()
-	router.Handle("/{user:.*}/{name:.*}", http.HandlerFunc(monitor.handleGithubWebhook)).Methods("POST")
-	log.Infof("Starting release-bot on port %s", *port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", *port), router))
+	router.HandleFunc("/healthz", mon.handleHealthz).Methods("GET")
+	router.HandleFunc("/readyz", mon.handleReadyz).Methods("GET")
+	router.HandleFunc("/status", mon.stats.handleStatus).Methods("GET")
+	router.HandleFunc("/config", mon.requireAdmin(mon.handleConfig)).Methods("GET")
+	router.HandleFunc("/resync/{owner}/{name}/{number:[0-9]+}", mon.requireAdmin(mon.handleResync)).Methods("POST")
+	router.HandleFunc("/reload", mon.requireAdmin(mon.handleReload)).Methods("POST")
+	router.HandleFunc("/audit", mon.requireAdmin(mon.handleAudit)).Methods("GET")
+	router.HandleFunc("/admin/label", mon.requireAdmin(mon.handleAdminLabel)).Methods("POST")
+	router.HandleFunc("/admin/move", mon.requireAdmin(mon.handleAdminMove)).Methods("POST")
+	router.HandleFunc("/metrics", mon.handleMetrics).Methods("GET")
+	router.HandleFunc("/debug/events", mon.requireAdmin(mon.decisions.handleList)).Methods("GET")
+	router.Handle("/{user:.*}/{name:.*}", http.HandlerFunc(mon.handleGithubWebhook)).Methods("POST")
+	return router
+}
+
+func main() {
+	runCommand(os.Args[1:])
 }
@@ -0,0 +1,2313 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/oauth2"
+)
+
+// boardColumns is a board of the fake and its columns
+type boardColumns struct {
+	project                          *github.Project
+	triage, cherryPick, cherryPicked *github.ProjectColumn
+}
+
+// labelBoard is a 17.06 board of docker/docker with a triage, a cherry pick
+// and a cherry picked column
+func labelBoard(f *fakeGitHub) *boardColumns {
+	project := f.addProject("docker/docker", "17.06.1")
+	return &boardColumns{
+		project:      project,
+		triage:       f.addColumn(project, "Triage"),
+		cherryPick:   f.addColumn(project, "Cherry Pick"),
+		cherryPicked: f.addColumn(project, "Cherry Picked"),
+	}
+}
+
+func TestHandleLabelEventCreatesCard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/triage"), httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected a card in Triage, got %v", got)
+	}
+	if got := mon.stats.processed.load(); got != 1 {
+		t.Fatalf("Expected 1 processed event, got %d", got)
+	}
+}
+
+func TestHandleLabelEventMovesCard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	card := f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the card in Cherry Pick, got %v", got)
+	}
+	calls := f.madeCalls()
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "MoveProjectCard ") || !strings.Contains(calls[0], strconv.Itoa(*card.ID)) {
+		t.Fatalf("Expected the existing card to be moved, got calls %v", calls)
+	}
+}
+
+func TestHandleLabelEventDuplicateCards(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	duplicate := f.addCard(board.cherryPick, issue)
+	cfg, _ := loadConfig("")
+	cfg.DeleteDuplicateCards = true
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-picked"), httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Picked"}) {
+		t.Fatalf("Expected a single card in Cherry Picked, got %v", got)
+	}
+	deleted := false
+	for _, call := range f.madeCalls() {
+		deleted = deleted || call == "DeleteProjectCard "+strconv.Itoa(*duplicate.ID)
+	}
+	if !deleted {
+		t.Fatalf("Expected the duplicate card to be deleted, got calls %v", f.madeCalls())
+	}
+}
+
+func TestHandleLabelEventMissingColumn(t *testing.T) {
+	f := newFakeGitHub()
+	project := f.addProject("docker/docker", "17.06.1")
+	f.addColumn(project, "Triage")
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if calls := f.madeCalls(); len(calls) != 0 {
+		t.Fatalf("Expected no changes to the board, got calls %v", calls)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected 1 ignored event, got %d", got)
+	}
+
+	cfg, _ := loadConfig("")
+	cfg.CreateMissingColumns = true
+	mon = newTestMonitor(t, f, cfg)
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if got := f.issueColumns(project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected a card in the created Cherry Pick column, got %v", got)
+	}
+}
+
+// signedWebhook returns a webhook delivery of payload signed with secret
+func signedWebhook(event, payload, secret string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest("POST", "/docker/docker", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+const labeledPayload = `{
+  "action": "labeled",
+  "issue": {
+    "id": %d,
+    "number": 1,
+    "state": "open",
+    "url": "https://api.github.com/repos/docker/docker/issues/1"
+  },
+  "label": {"name": "17.06.1/cherry-pick"},
+  "repository": {"name": "docker", "full_name": "docker/docker", "owner": {"login": "docker"}},
+  "sender": {"login": "someone"}
+}`
+
+func TestWebhookMovesCard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	server := httptest.NewServer(newRouter(mon))
+	defer server.Close()
+
+	req := signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret")
+	req.RequestURI = ""
+	req.URL, _ = url.Parse(server.URL + "/docker/docker")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	mon.handlers.Wait()
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the card in Cherry Pick, got %v", got)
+	}
+}
+
+func TestWebhookBadSignature(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "not the secret"))
+	mon.handlers.Wait()
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", w.Code)
+	}
+	if f.clients != 0 || len(f.madeCalls()) != 0 {
+		t.Fatalf("Expected no GitHub calls, got %d clients and calls %v", f.clients, f.madeCalls())
+	}
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the card to stay in Triage, got %v", got)
+	}
+}
+
+// mergedPullRequest returns the pull request of a merged, so closed, issue
+func mergedPullRequest(issue *github.Issue) *github.PullRequest {
+	issue.State = github.String("closed")
+	issue.PullRequestLinks = &github.PullRequestLinks{}
+	return &github.PullRequest{
+		Number:         issue.Number,
+		Title:          github.String("Fix the thing"),
+		Merged:         github.Bool(true),
+		MergeCommitSHA: github.String("abc123"),
+	}
+}
+
+func TestBackportMovesCardToDone(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.cherryPick, issue)
+	pr := mergedPullRequest(issue)
+	cfg, _ := loadConfig("")
+	cfg.Backports.Enabled = true
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.backportLabeled(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), pr, httptest.NewRequest("POST", "/docker/docker", nil))
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Picked"}) {
+		t.Fatalf("Expected the card in Cherry Picked, got %v", got)
+	}
+	if _, ok := f.pulls["backport-1-to-17.06.1"]; !ok {
+		t.Fatalf("Expected a backport pull request, got calls %v", f.madeCalls())
+	}
+}
+
+func TestBackportRedoesStaleBranch(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	pr := mergedPullRequest(issue)
+	f.branches["backport-1-to-17.06.1"] = false
+	cfg, _ := loadConfig("")
+	cfg.Backports.Enabled = true
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.backportLabeled(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), pr, httptest.NewRequest("POST", "/docker/docker", nil))
+
+	calls := f.madeCalls()
+	expected := []string{
+		"DeleteBranch backport-1-to-17.06.1",
+		"CherryPick abc123 17.06.1 backport-1-to-17.06.1",
+		"CreatePullRequest backport-1-to-17.06.1 17.06.1",
+	}
+	if len(calls) < len(expected) || !reflect.DeepEqual(calls[:len(expected)], expected) {
+		t.Fatalf("Expected the stale branch to be cherry-picked again, got calls %v", calls)
+	}
+}
+
+// eventRequest returns the request a handler is given for an event of
+// docker/docker
+func eventRequest() *http.Request {
+	return httptest.NewRequest("POST", "/docker/docker", nil)
+}
+
+func TestHandleLabelEventClosesIssue(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	wontfix := f.addColumn(board.project, "wontfix")
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	cfg, _ := loadConfig("")
+	cfg.Actions = map[string]actionConfig{"wontfix": {Close: true}}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/wontfix"), eventRequest())
+
+	if issue.GetState() != "closed" {
+		t.Fatalf("Expected the issue to be closed, got calls %v", f.madeCalls())
+	}
+	// the closed issue skips the move unless skipClosedIssues is off
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the card to stay in Triage, got %v", got)
+	}
+
+	issue = f.addIssue("docker/docker", 2)
+	f.addCard(board.triage, issue)
+	cfg.SkipClosedIssues = false
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/wontfix"), eventRequest())
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{wontfix.GetName()}) {
+		t.Fatalf("Expected the card in wontfix, got %v", got)
+	}
+}
+
+func TestHandleLabelEventCloseOnly(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	f.addColumn(board.project, "wontfix")
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	cfg, _ := loadConfig("")
+	cfg.Actions = map[string]actionConfig{"wontfix": {CloseOnly: true}}
+	cfg.SkipClosedIssues = false
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/wontfix"), eventRequest())
+
+	if calls := f.madeCalls(); !reflect.DeepEqual(calls, []string{"Edit docker/docker#1"}) {
+		t.Fatalf("Expected the issue to be closed without moving its card, got calls %v", calls)
+	}
+}
+
+func TestHandleLabelEventAlreadyClosed(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	issue.State = github.String("closed")
+	cfg, _ := loadConfig("")
+	cfg.Actions = map[string]actionConfig{"wontfix": {CloseOnly: true}}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/wontfix"), eventRequest())
+
+	if calls := f.madeCalls(); len(calls) != 0 {
+		t.Fatalf("Expected no calls for a closed issue, got %v", calls)
+	}
+}
+
+func TestWebhookRecoversFromPanic(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	f.hooks["ListProjectColumns"] = func() error { panic("boom") }
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+	logs := test.NewGlobal()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret"))
+	mon.handlers.Wait()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if got := mon.stats.panics.load(); got != 1 {
+		t.Fatalf("Expected 1 panic, got %d", got)
+	}
+	recovered := false
+	for _, entry := range logs.AllEntries() {
+		recovered = recovered || strings.HasPrefix(entry.Message, "Recovered from panic handling delivery")
+	}
+	if !recovered {
+		t.Fatal("Expected the recovery to be logged")
+	}
+
+	delete(f.hooks, "ListProjectColumns")
+	req := signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret")
+	req.Header.Set("X-GitHub-Delivery", "a8f3d90c-cc78-11e3-81ab-4c9367dc0958")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	mon.handlers.Wait()
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the next delivery to move the card to Cherry Pick, got %v", got)
+	}
+}
+
+func TestHandleLabelEventAllowedFrom(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	allowed := f.addIssue("docker/docker", 1)
+	f.addCard(board.cherryPick, allowed)
+	disallowed := f.addIssue("docker/docker", 2)
+	f.addCard(board.triage, disallowed)
+	cfg, _ := loadConfig("")
+	cfg.Actions = map[string]actionConfig{"cherry-picked": {AllowedFrom: []string{"Cherry Pick"}}}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", allowed, "17.06.1/cherry-picked"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", disallowed, "17.06.1/cherry-picked"), eventRequest())
+
+	if got := f.issueColumns(board.project, allowed); !reflect.DeepEqual(got, []string{"Cherry Picked"}) {
+		t.Fatalf("Expected the card from Cherry Pick in Cherry Picked, got %v", got)
+	}
+	if got := f.issueColumns(board.project, disallowed); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the card from Triage to stay, got %v", got)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected 1 ignored event, got %d", got)
+	}
+}
+
+func TestDebugEventsCapped(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	mon := newTestMonitor(t, f, nil)
+	mon.decisions = newDecisionLog(2)
+	mon.adminToken = []byte("admin")
+	for number := 1; number <= 3; number++ {
+		issue := f.addIssue("docker/docker", number)
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/triage"), eventRequest())
+	}
+	router := newRouter(mon)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/events", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without the admin token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/events", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var decisions []decision
+	if err := json.NewDecoder(w.Body).Decode(&decisions); err != nil {
+		t.Fatal(err)
+	}
+	var issues []int
+	for _, d := range decisions {
+		issues = append(issues, d.Issue)
+	}
+	if !reflect.DeepEqual(issues, []int{2, 3}) {
+		t.Fatalf("Expected the decisions of the last 2 issues, got %v", decisions)
+	}
+}
+
+func TestServerBoundsSlowBodies(t *testing.T) {
+	read := make(chan error, 1)
+	server := newServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		read <- err
+	}), 100*time.Millisecond, time.Second, time.Second)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST /docker/docker HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\n{\"action\":")
+
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Fatal("Expected reading the partial body to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the read timeout to end the slow body")
+	}
+}
+
+func TestHandleLabelEventMatchByBody(t *testing.T) {
+	f := newFakeGitHub()
+	named := f.addProject("docker/docker", "17.06.1")
+	f.addColumn(named, "Triage")
+	marked := f.addProject("docker/docker", "Next patch release")
+	marked.Body = github.String("Tracks the backports.\n\nrelease-bot: 17.06.1")
+	f.addColumn(marked, "Triage")
+	issue := f.addIssue("docker/docker", 1)
+	cfg, _ := loadConfig("")
+	cfg.MatchBy = matchByBody
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/triage"), eventRequest())
+
+	if got := f.issueColumns(marked, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected a card in the project marked 17.06.1, got %v", got)
+	}
+	if got := f.issueColumns(named, issue); len(got) != 0 {
+		t.Fatalf("Expected no card in the project named 17.06.1, got %v", got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for level, expected := range map[string]log.Level{
+		"trace": log.DebugLevel,
+		"TRACE": log.DebugLevel,
+		"debug": log.DebugLevel,
+		"info":  log.InfoLevel,
+		"warn":  log.WarnLevel,
+		"error": log.ErrorLevel,
+	} {
+		got, err := parseLogLevel(level)
+		if err != nil || got != expected {
+			t.Errorf("Expected %q to parse as %v, got %v, %v", level, expected, got, err)
+		}
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("Expected an invalid level to fail")
+	}
+}
+
+func TestHandleLabelEventKeepsDuplicateCards(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	first := f.addCard(board.triage, issue)
+	f.addCard(board.cherryPick, issue)
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-picked"), eventRequest())
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick", "Cherry Picked"}) {
+		t.Fatalf("Expected the duplicate to stay in Cherry Pick, got %v", got)
+	}
+	calls := f.madeCalls()
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "MoveProjectCard "+strconv.Itoa(*first.ID)+" ") {
+		t.Fatalf("Expected only the card of the first column to move, got calls %v", calls)
+	}
+}
+
+func TestReadSecretFile(t *testing.T) {
+	t.Setenv(webhookSecretEnvVariable, "inline")
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(file, []byte("mounted\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if secret, err := readSecret(file, webhookSecretEnvVariable); err != nil || secret != "mounted" {
+		t.Fatalf("Expected the mounted secret without its newline, got %q, %v", secret, err)
+	}
+	if secret, err := readSecret("", webhookSecretEnvVariable); err != nil || secret != "inline" {
+		t.Fatalf("Expected the inline secret without a file, got %q, %v", secret, err)
+	}
+	if _, err := readSecret(file+".missing", webhookSecretEnvVariable); err == nil {
+		t.Fatal("Expected an unreadable file to fail")
+	}
+}
+
+func TestHandleLabelEventCreatesColumnOnce(t *testing.T) {
+	f := newFakeGitHub()
+	project := f.addProject("docker/docker", "17.06.1")
+	f.addColumn(project, "Triage")
+	first := f.addIssue("docker/docker", 1)
+	second := f.addIssue("docker/docker", 2)
+	cfg, _ := loadConfig("")
+	cfg.CreateMissingColumns = true
+	mon := newTestMonitor(t, f, cfg)
+
+	var wg sync.WaitGroup
+	for _, issue := range []*github.Issue{first, second} {
+		wg.Add(1)
+		go func(issue *github.Issue) {
+			defer wg.Done()
+			mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+		}(issue)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, call := range f.madeCalls() {
+		if strings.HasPrefix(call, "CreateProjectColumn ") {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Fatalf("Expected the column to be created once, got calls %v", f.madeCalls())
+	}
+	for _, issue := range []*github.Issue{first, second} {
+		if got := f.issueColumns(project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+			t.Fatalf("Expected the card of #%d in Cherry Pick, got %v", issue.GetNumber(), got)
+		}
+	}
+}
+
+func TestWebhookIgnoresActor(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	cfg, _ := loadConfig("")
+	cfg.IgnoreActors = []string{"someone"}
+	mon := newTestMonitor(t, f, cfg)
+	mon.secrets = [][]byte{[]byte("secret")}
+
+	w := httptest.NewRecorder()
+	newRouter(mon).ServeHTTP(w, signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret"))
+	mon.handlers.Wait()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if f.clients != 0 {
+		t.Fatalf("Expected no GitHub calls, got calls %v", f.madeCalls())
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected 1 ignored event, got %d", got)
+	}
+}
+
+func TestHandleLabelEventMovesOnlyForward(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	inbox := f.addColumn(board.project, "Inbox")
+	forward := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, forward)
+	backward := f.addIssue("docker/docker", 2)
+	f.addCard(board.cherryPicked, backward)
+	unordered := f.addIssue("docker/docker", 3)
+	f.addCard(inbox, unordered)
+	cfg, _ := loadConfig("")
+	cfg.ColumnOrder = []string{"Triage", "Cherry Pick", "Cherry Picked"}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", forward, "17.06.1/cherry-pick"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", backward, "17.06.1/triage"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", unordered, "17.06.1/triage"), eventRequest())
+
+	for issue, expected := range map[*github.Issue]string{forward: "Cherry Pick", backward: "Cherry Picked", unordered: "Triage"} {
+		if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{expected}) {
+			t.Errorf("Expected the card of #%d in %s, got %v", issue.GetNumber(), expected, got)
+		}
+	}
+}
+
+func TestStatusCountsEvents(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", f.addIssue("docker/docker", 1), "17.06.1/triage"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", f.addIssue("docker/docker", 2), "17.06.1/missing"), eventRequest())
+	f.hooks["ListProjectColumns"] = func() error { return errors.New("GitHub is down") }
+	mon.handleLabelEvent(labeledEvent("docker/docker", f.addIssue("docker/docker", 3), "17.06.1/triage"), eventRequest())
+
+	w := httptest.NewRecorder()
+	newRouter(mon).ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	var stats map[string]uint64
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]uint64{"processed": 1, "ignored": 1, "dropped_error": 1} {
+		if stats[name] != expected {
+			t.Errorf("Expected %s to be %d, got %v", name, expected, stats)
+		}
+	}
+}
+
+func TestHandleLabelEventStrictColumns(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		f := newFakeGitHub()
+		board := labelBoard(f)
+		f.addColumn(board.project, "Blocked")
+		f.addColumn(board.project, "Docs")
+		typo := f.addIssue("docker/docker", 1)
+		f.addCard(board.triage, typo)
+		allowed := f.addIssue("docker/docker", 2)
+		f.addCard(board.triage, allowed)
+		cfg, _ := loadConfig("")
+		cfg.StrictColumns = strict
+		cfg.AllowedColumns = []string{"Docs"}
+		mon := newTestMonitor(t, f, cfg)
+
+		mon.handleLabelEvent(labeledEvent("docker/docker", typo, "17.06.1/Blocked"), eventRequest())
+		mon.handleLabelEvent(labeledEvent("docker/docker", allowed, "17.06.1/Docs"), eventRequest())
+
+		expected := "Blocked"
+		if strict {
+			expected = "Triage"
+		}
+		if got := f.issueColumns(board.project, typo); !reflect.DeepEqual(got, []string{expected}) {
+			t.Errorf("Expected the unknown action to leave the card in %s with strictColumns %v, got %v", expected, strict, got)
+		}
+		if got := f.issueColumns(board.project, allowed); !reflect.DeepEqual(got, []string{"Docs"}) {
+			t.Errorf("Expected the allowed action to move the card to Docs with strictColumns %v, got %v", strict, got)
+		}
+	}
+}
+
+func TestClientsPerOwnerToken(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	mobyBoard := f.addProject("moby/moby", "17.06.1")
+	f.addColumn(mobyBoard, "Triage")
+	var tokens []string
+	mon := newTestMonitor(t, f, nil)
+	mon.clients.newClient = func(ts oauth2.TokenSource) *githubClient {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token.AccessToken)
+		return f.client()
+	}
+	mon.clients.setTokens("global", map[string]string{"Docker": "docker"}, nil)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", f.addIssue("docker/docker", 1), "17.06.1/triage"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("moby/moby", f.addIssue("moby/moby", 1), "17.06.1/triage"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", f.addIssue("docker/docker", 2), "17.06.1/triage"), eventRequest())
+
+	if !reflect.DeepEqual(tokens, []string{"docker", "global"}) {
+		t.Fatalf("Expected one client with the docker token and one with the global token, got %v", tokens)
+	}
+}
+
+const renamedLabelPayload = `{
+  "action": "edited",
+  "label": {"name": "17.06.1/cherry-pick"},
+  "changes": {"name": {"from": "17.06.1/cherrypick"}},
+  "repository": {"name": "docker", "full_name": "docker/docker", "owner": {"login": "docker"}},
+  "sender": {"login": "someone"}
+}`
+
+func TestWebhookRenamedLabel(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	renamed := f.addIssue("docker/docker", 1, "17.06.1/cherry-pick")
+	f.addCard(board.triage, renamed)
+	other := f.addIssue("docker/docker", 2, "17.06.1/triage")
+	f.addCard(board.triage, other)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+
+	w := httptest.NewRecorder()
+	newRouter(mon).ServeHTTP(w, signedWebhook("label", renamedLabelPayload, "secret"))
+	mon.handlers.Wait()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if got := f.issueColumns(board.project, renamed); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the card of the renamed label in Cherry Pick, got %v", got)
+	}
+	if got := f.issueColumns(board.project, other); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the other card to stay in Triage, got %v", got)
+	}
+}
+
+func TestHandleLabelEventMoveConflict(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	moved := f.addIssue("docker/docker", 1)
+	card := f.addCard(board.triage, moved)
+	stuck := f.addIssue("docker/docker", 2)
+	f.addCard(board.triage, stuck)
+	mon := newTestMonitor(t, f, nil)
+
+	// another event moves the card first
+	f.hooks["MoveProjectCard"] = func() error {
+		delete(f.hooks, "MoveProjectCard")
+		f.cards[*board.triage.ID] = f.cards[*board.triage.ID][1:]
+		f.cards[*board.cherryPick.ID] = append(f.cards[*board.cherryPick.ID], card)
+		return unprocessable("Card was moved")
+	}
+	mon.handleLabelEvent(labeledEvent("docker/docker", moved, "17.06.1/cherry-pick"), eventRequest())
+
+	if got := mon.stats.processed.load(); got != 1 {
+		t.Fatalf("Expected the conflict to count as processed, got %v", mon.stats.snapshot())
+	}
+
+	// the conflict is retried once when the card didn't move
+	f.hooks["MoveProjectCard"] = func() error {
+		delete(f.hooks, "MoveProjectCard")
+		return unprocessable("Try again")
+	}
+	mon.handleLabelEvent(labeledEvent("docker/docker", stuck, "17.06.1/cherry-pick"), eventRequest())
+
+	if got := f.issueColumns(board.project, stuck); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the retried move to reach Cherry Pick, got %v", got)
+	}
+	if got := mon.stats.droppedError.load(); got != 0 {
+		t.Fatalf("Expected no dropped events, got %d", got)
+	}
+}
+
+func TestRequireLabel(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	f.addLabels("docker/docker", "17.06.1/triage")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RequireLabel = "area/release"
+	mon := newTestMonitor(t, f, cfg)
+	unmarked := f.addIssue("docker/docker", 1)
+	marked := f.addIssue("docker/docker", 2, "area/release")
+
+	for _, issue := range []*github.Issue{unmarked, marked} {
+		opened := labeledEvent("docker/docker", issue, "")
+		opened.Action, opened.Label = github.String("opened"), nil
+		mon.handleIssueOpenedEvent(opened, eventRequest())
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+	}
+
+	if got := f.issueColumns(board.project, unmarked); len(got) != 0 {
+		t.Fatalf("Expected no card for the issue without the label, got %v", got)
+	}
+	if got := f.issueColumns(board.project, marked); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected a card in Cherry Pick for the issue with the label, got %v", got)
+	}
+	for _, call := range f.madeCalls() {
+		if strings.Contains(call, "#1") {
+			t.Fatalf("Expected no call for the issue without the label, got %q", call)
+		}
+	}
+	if !reflect.DeepEqual(f.madeCalls()[:1], []string{"AddLabelsToIssue docker/docker#2 [17.06.1/triage]"}) {
+		t.Fatalf("Expected the issue with the label to be triaged, got %v", f.madeCalls())
+	}
+	if got := mon.stats.ignored.load(); got != 2 {
+		t.Fatalf("Expected 2 ignored events, got %d", got)
+	}
+	if got := mon.stats.processed.load(); got != 2 {
+		t.Fatalf("Expected 2 processed events, got %d", got)
+	}
+}
+
+func TestClientsThrottlePerOwner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limit := rateLimitConfig{PerSecond: 20, Burst: 1}
+	clients := newGithubClients(ctx, "token", nil, nil, githubURLs{baseURL: srv.URL}, limit, nil, nil)
+
+	get := func(owner string) time.Duration {
+		start := time.Now()
+		if _, _, err := clients.forOwner(owner).Issues.Get(ctx, owner, "docker", 1); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+	get("docker")
+	var waited time.Duration
+	for i := 0; i < 2; i++ {
+		waited += get("docker")
+	}
+	// a call every 50ms, with some slack for the timer
+	if waited < 80*time.Millisecond {
+		t.Fatalf("Expected calls of an owner to be spaced by the limit, 2 calls took %v", waited)
+	}
+	if took := get("moby"); took > 40*time.Millisecond {
+		t.Fatalf("Expected another owner not to wait for the limit, its call took %v", took)
+	}
+}
+
+func TestHandleIssueOpenedEventCreatesCard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	f.addLabels("docker/docker", "17.06.1/triage", "17.03.2/triage", "kind/bug")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.OpenColumn = "Triage"
+	mon := newTestMonitor(t, f, cfg)
+	issue := f.addIssue("docker/docker", 1)
+	opened := labeledEvent("docker/docker", issue, "")
+	opened.Action, opened.Label = github.String("opened"), nil
+
+	mon.handleIssueOpenedEvent(opened, eventRequest())
+
+	// 17.03.2 has no open project so it is neither labeled nor carded
+	if got := f.madeCalls()[0]; got != "AddLabelsToIssue docker/docker#1 [17.06.1/triage]" {
+		t.Fatalf("Expected the triage label of the open project, got %q", got)
+	}
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected a card in Triage, got %v", got)
+	}
+	if got := mon.stats.processed.load(); got != 1 {
+		t.Fatalf("Expected 1 processed event, got %d", got)
+	}
+}
+
+func TestLoadConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"00-global.yaml":   "matchBy: body\nallowedRepos: [docker/docker, docker/cli]\n",
+		"docker.yaml":      "repos:\n  docker/docker:\n    cardPosition: bottom\n",
+		"cli.json":         `{"repos": {"docker/cli": {"disabled": true}}}`,
+		"notes.txt":        "not: config",
+		"nested.yaml/skip": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MatchBy != matchByBody || len(cfg.AllowedRepos) != 2 {
+		t.Fatalf("Expected the global settings, got matchBy %q and allowedRepos %v", cfg.MatchBy, cfg.AllowedRepos)
+	}
+	if cfg.Repos["docker/docker"].CardPosition != "bottom" || !cfg.Repos["docker/cli"].Disabled {
+		t.Fatalf("Expected the settings of both repository files, got %+v", cfg.Repos)
+	}
+
+	// the same key in two files names both of them
+	conflict := filepath.Join(dir, "zz-conflict.yaml")
+	if err := ioutil.WriteFile(conflict, []byte("repos:\n  docker/docker:\n    cardPosition: top\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadConfig(dir)
+	if err == nil || !strings.Contains(err.Error(), "repos.docker/docker.cardPosition") || !strings.Contains(err.Error(), "docker.yaml") || !strings.Contains(err.Error(), conflict) {
+		t.Fatalf("Expected a conflict naming both files, got %v", err)
+	}
+}
+
+// cardEvent returns the event of a card of the fake, as GitHub sends it
+func cardEvent(action string, card *github.ProjectCard, column *github.ProjectColumn) *github.ProjectCardEvent {
+	return &github.ProjectCardEvent{
+		Action: github.String(action),
+		ProjectCard: &github.ProjectCard{
+			ID:         card.ID,
+			ContentURL: card.ContentURL,
+			ColumnID:   column.ID,
+		},
+		Sender: &github.User{Login: github.String("someone")},
+	}
+}
+
+func TestHandleProjectCardEventLabelsIssue(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	moved := f.addIssue("docker/docker", 1)
+	converted := f.addIssue("docker/docker", 2)
+	labeled := f.addIssue("docker/docker", 3, "17.06.1/cherry-pick")
+	mon := newTestMonitor(t, f, nil)
+
+	mon.handleProjectCardEvent(cardEvent("moved", f.addCard(board.cherryPick, moved), board.cherryPick), eventRequest())
+	mon.handleProjectCardEvent(cardEvent("converted", f.addCard(board.cherryPicked, converted), board.cherryPicked), eventRequest())
+	mon.handleProjectCardEvent(cardEvent("moved", f.addCard(board.cherryPick, labeled), board.cherryPick), eventRequest())
+
+	expected := []string{
+		"AddLabelsToIssue docker/docker#1 [17.06.1/cherry-pick]",
+		"AddLabelsToIssue docker/docker#2 [17.06.1/cherry-picked]",
+	}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected the labels of the columns, got %v", got)
+	}
+	if got := mon.stats.processed.load(); got != 2 {
+		t.Fatalf("Expected 2 processed events, got %d", got)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected the card of the labeled issue to be ignored, got %d", got)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	for _, tc := range []struct {
+		host, port, addr string
+	}{
+		{"", "8080", ":8080"},
+		{"127.0.0.1", "8080", "127.0.0.1:8080"},
+		{"::1", "8080", "[::1]:8080"},
+	} {
+		addr, err := listenAddr(tc.host, tc.port)
+		if err != nil || addr != tc.addr {
+			t.Fatalf("Expected %s for host %q, got %s, %v", tc.addr, tc.host, addr, err)
+		}
+	}
+	if _, err := listenAddr("127.0.0.1", "port"); err == nil {
+		t.Fatal("Expected an invalid port to fail")
+	}
+
+	// a server bound to the loopback interface only listens there
+	addr, err := listenAddr("127.0.0.1", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", newServer(addr, http.NotFoundHandler(), time.Second, time.Second, time.Second).Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if ip := listener.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Fatalf("Expected to listen on the loopback interface, got %v", ip)
+	}
+}
+
+func TestWebhookContentType(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+	payload := fmt.Sprintf(labeledPayload, *issue.ID)
+
+	form := signedWebhook("issues", "payload="+url.QueryEscape(payload), "secret")
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, form)
+	mon.handlers.Wait()
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected form payloads to be rejected with 415, got %d", w.Code)
+	}
+	if len(f.madeCalls()) != 0 {
+		t.Fatalf("Expected no GitHub calls for a rejected delivery, got %v", f.madeCalls())
+	}
+
+	req := signedWebhook("issues", payload, "secret")
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	mon.handlers.Wait()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected JSON payloads to be accepted, got %d", w.Code)
+	}
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the card in Cherry Pick, got %v", got)
+	}
+}
+
+func TestHandleLabelEventAdvance(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	uncarded := f.addIssue("docker/docker", 2)
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Pipeline = []string{"Triage", "Cherry Pick", "Cherry Picked"}
+	mon := newTestMonitor(t, f, cfg)
+
+	for _, column := range []string{"Cherry Pick", "Cherry Picked", "Cherry Picked"} {
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/advance"), eventRequest())
+		if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{column}) {
+			t.Fatalf("Expected the card to advance to %s, got %v", column, got)
+		}
+	}
+	mon.handleLabelEvent(labeledEvent("docker/docker", uncarded, "17.06.1/advance"), eventRequest())
+	if got := f.issueColumns(board.project, uncarded); len(got) != 0 {
+		t.Fatalf("Expected no card to be created by advance, got %v", got)
+	}
+
+	// the last stage and the issue without a card are left alone
+	if processed, ignored := mon.stats.processed.load(), mon.stats.ignored.load(); processed != 2 || ignored != 2 {
+		t.Fatalf("Expected 2 processed and 2 ignored events, got %d and %d", processed, ignored)
+	}
+}
+
+func TestTerminalColumnClosesIssue(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	picking := f.addIssue("docker/docker", 1)
+	picked := f.addIssue("docker/docker", 2)
+	dragged := f.addIssue("docker/docker", 3)
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.TerminalColumns = []string{"Cherry Picked"}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", picking, "17.06.1/cherry-pick"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", picked, "17.06.1/cherry-picked"), eventRequest())
+	mon.handleProjectCardEvent(cardEvent("moved", f.addCard(board.cherryPicked, dragged), board.cherryPicked), eventRequest())
+
+	if picking.GetState() != "open" {
+		t.Fatal("Expected the issue placed in Cherry Pick to stay open")
+	}
+	if picked.GetState() != "closed" {
+		t.Fatal("Expected the issue labeled into Cherry Picked to be closed")
+	}
+	if dragged.GetState() != "closed" {
+		t.Fatal("Expected the issue whose card was moved to Cherry Picked to be closed")
+	}
+}
+
+func TestConfigEndpointRedactsSecrets(t *testing.T) {
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RequireLabel = "area/release"
+	cfg.Tokens = map[string]tokenConfig{
+		"docker": {Token: "docker-token"},
+		"moby":   {File: "/run/secrets/moby"},
+	}
+	cfg.Slack.WebhookURL = "https://hooks.slack.com/services/secret"
+	cfg.Tracing.Headers = map[string]string{"api-key": "tracing-key"}
+	mon := newTestMonitor(t, newFakeGitHub(), cfg)
+	mon.adminToken = []byte("admin")
+	router := newRouter(mon)
+
+	req := httptest.NewRequest("GET", "/config", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"docker-token", "hooks.slack.com", "tracing-key"} {
+		if strings.Contains(body, secret) {
+			t.Fatalf("Expected %q to be redacted, got %s", secret, body)
+		}
+	}
+	var shown config
+	if err := json.Unmarshal(w.Body.Bytes(), &shown); err != nil {
+		t.Fatal(err)
+	}
+	if shown.RequireLabel != "area/release" || shown.Tokens["moby"].File != "/run/secrets/moby" || shown.Tokens["docker"].Token != redactedSecret {
+		t.Fatalf("Expected the effective config with secrets redacted, got %s", body)
+	}
+	// the running config keeps its secrets
+	if cfg.Tokens["docker"].Token != "docker-token" {
+		t.Fatal("Expected redacting not to change the running config")
+	}
+}
+
+func TestHandleLabelEventMixedCase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("actions:\n  Cherry-Picked:\n    close: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	picking := f.addIssue("docker/docker", 1)
+	picked := f.addIssue("docker/docker", 2)
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", picking, "17.06.1/Cherry-Pick"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", picked, "17.06.1/CHERRY-PICKED"), eventRequest())
+
+	if got := f.issueColumns(board.project, picking); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected a card in Cherry Pick, got %v", got)
+	}
+	if picked.GetState() != "closed" {
+		t.Fatal("Expected the action configured in another case to close the issue")
+	}
+
+	// keys only differing by case are ambiguous
+	if err := ioutil.WriteFile(path, []byte("actions:\n  close:\n    close: true\n  Close:\n    closeOnly: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "Action close is set more than once") {
+		t.Fatalf("Expected actions differing by case to be rejected, got %v", err)
+	}
+}
+
+func TestResyncMovesCard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1, "17.06.1/cherry-pick", "kind/bug")
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.adminToken = []byte("admin")
+	router := newRouter(mon)
+
+	req := httptest.NewRequest("POST", "/resync/docker/docker/1", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the card moved to the column of its label, got %v", got)
+	}
+	var summary []decision
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) == 0 {
+		t.Fatal("Expected the decisions of the resync to be returned")
+	}
+
+	req = httptest.NewRequest("POST", "/resync/docker/docker/2", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502 for a missing issue, got %d", w.Code)
+	}
+}
+
+func TestHandleLabelEventMultiProject(t *testing.T) {
+	for _, tc := range []struct {
+		multiProject string
+		rc1, rc2     []string
+	}{
+		{multiProjectFirst, []string{"Cherry Pick"}, nil},
+		{multiProjectAll, []string{"Cherry Pick"}, []string{"Cherry Pick"}},
+		{multiProjectLatest, nil, []string{"Cherry Pick"}},
+	} {
+		f := newFakeGitHub()
+		var projects []*github.Project
+		for _, name := range []string{"17.06.1-rc1", "17.06.1-rc2"} {
+			project := f.addProject("docker/docker", name)
+			f.addColumn(project, "Triage")
+			f.addColumn(project, "Cherry Pick")
+			projects = append(projects, project)
+		}
+		issue := f.addIssue("docker/docker", 1)
+		cfg, err := loadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.MultiProject = tc.multiProject
+		mon := newTestMonitor(t, f, cfg)
+
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+
+		rc1, rc2 := f.issueColumns(projects[0], issue), f.issueColumns(projects[1], issue)
+		if !reflect.DeepEqual(rc1, tc.rc1) || !reflect.DeepEqual(rc2, tc.rc2) {
+			t.Fatalf("Expected cards %v and %v with multiProject %s, got %v and %v", tc.rc1, tc.rc2, tc.multiProject, rc1, rc2)
+		}
+	}
+}
+
+func TestWebhookAuditEntries(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.Audit.Enabled = true
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+	logs := test.NewGlobal()
+
+	for _, secret := range []string{"secret", "not the secret"} {
+		router.ServeHTTP(httptest.NewRecorder(), signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), secret))
+	}
+	mon.handlers.Wait()
+
+	var audits []string
+	for _, entry := range logs.AllEntries() {
+		if strings.HasPrefix(entry.Message, "Audit ") {
+			audits = append(audits, entry.Message)
+		}
+	}
+	if len(audits) != 2 {
+		t.Fatalf("Expected an audit entry per delivery, got %v", audits)
+	}
+	for i, expected := range []string{"signature=valid status=200", "signature=invalid status=401"} {
+		if !strings.Contains(audits[i], expected) || !strings.Contains(audits[i], `delivery="72d3162e-cc78-11e3-81ab-4c9367dc0958"`) {
+			t.Fatalf("Expected audit entry %q to contain %q and the delivery", audits[i], expected)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	for _, tc := range []struct {
+		header  string
+		scopes  []string
+		missing []string
+	}{
+		{"repo, read:org", []string{"repo", "read:org"}, nil},
+		{"repo,project", []string{"repo", "project"}, nil},
+		{" repo ,, ", []string{"repo"}, []string{"project"}},
+		{"read:org", []string{"read:org"}, []string{"repository"}},
+		{"", nil, []string{"repository", "project"}},
+	} {
+		scopes := parseScopes(tc.header)
+		if !reflect.DeepEqual(scopes, tc.scopes) {
+			t.Fatalf("Expected scopes %q for %q, got %q", tc.scopes, tc.header, scopes)
+		}
+		if missing := missingScopes(scopes); !reflect.DeepEqual(missing, tc.missing) {
+			t.Fatalf("Expected missing %v for %q, got %v", tc.missing, tc.header, missing)
+		}
+	}
+}
+
+func TestCheckTokenScopes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer classic":
+			w.Header().Set("X-OAuth-Scopes", "read:org")
+		case "Bearer complete":
+			w.Header().Set("X-OAuth-Scopes", "repo, project")
+		}
+		fmt.Fprint(w, `{"login": "release-bot"}`)
+	}))
+	defer srv.Close()
+	mon := newTestMonitor(t, newFakeGitHub(), nil)
+	mon.clients = newGithubClients(mon.ctx, "classic", map[string]string{"docker": "complete", "moby": "fine-grained"}, nil, githubURLs{baseURL: srv.URL}, rateLimitConfig{}, nil, nil)
+	logs := test.NewGlobal()
+
+	mon.checkTokenScopes()
+
+	var warnings []string
+	for _, entry := range logs.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	expected := []string{`The default token may be missing repository scopes, it has ["read:org"]`}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("Expected a warning about the default token only, got %q", warnings)
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	// Thursday
+	now := time.Date(2017, time.June, 15, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expression string
+		next       time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.June, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.June, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2017, time.June, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2017, time.June, 18, 9, 0, 0, 0, time.UTC)},
+		{"30 8,12 1 * *", time.Date(2017, time.July, 1, 8, 30, 0, 0, time.UTC)},
+		// restricted days match on either day field
+		{"0 0 20 * 5", time.Date(2017, time.June, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		schedule, err := parseCronSchedule(tc.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := schedule.next(now); !next.Equal(tc.next) {
+			t.Fatalf("Expected %q to run next at %v, got %v", tc.expression, tc.next, next)
+		}
+	}
+	schedule, err := parseCronSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.next(now); !next.IsZero() {
+		t.Fatalf("Expected a schedule that never matches to have no next run, got %v", next)
+	}
+	for _, expression := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCronSchedule(expression); err == nil {
+			t.Fatalf("Expected %q to be rejected", expression)
+		}
+	}
+}
+
+func TestHandleLabelEventFlatLabels(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	backlog := f.addProject("docker/docker", "Backlog")
+	f.addColumn(backlog, "Triage")
+	f.addColumn(backlog, "Cherry Pick")
+	flat := f.addIssue("docker/docker", 1)
+	prefixed := f.addIssue("docker/docker", 2)
+	other := f.addIssue("docker/cli", 1)
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.FlatLabels = map[string]string{"Docker/Docker": "Backlog"}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", flat, "cherry-pick"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", prefixed, "17.06.1/cherry-pick"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/cli", other, "cherry-pick"), eventRequest())
+
+	if got := f.issueColumns(backlog, flat); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the flat label to act on the default project, got %v", got)
+	}
+	if got := f.issueColumns(board.project, flat); len(got) != 0 {
+		t.Fatalf("Expected the flat label to leave other projects alone, got %v", got)
+	}
+	if got := f.issueColumns(board.project, prefixed); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected release labels to keep acting on their project, got %v", got)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected the flat label of a repository without a default project to be ignored, got %d", got)
+	}
+}
+
+func TestParseContentURL(t *testing.T) {
+	for _, tc := range []struct {
+		url          string
+		owner, repo  string
+		number       int
+		expectsError bool
+	}{
+		{url: "https://api.github.com/repos/docker/docker/issues/1", owner: "docker", repo: "docker", number: 1},
+		{url: "https://api.github.com/repos/docker/cli/pulls/42", owner: "docker", repo: "cli", number: 42},
+		{url: "https://ghes.example.com/api/v3/repos/docker/docker/issues/7", owner: "docker", repo: "docker", number: 7},
+		{url: "https://api.github.com/repos/docker/docker/issues/1/comments", expectsError: true},
+		{url: "https://api.github.com/projects/columns/1", expectsError: true},
+	} {
+		owner, repo, number, err := parseContentURL(tc.url)
+		if tc.expectsError {
+			if err == nil || err == errNoteCard {
+				t.Fatalf("Expected %s to be rejected, got %v", tc.url, err)
+			}
+			continue
+		}
+		if err != nil || owner != tc.owner || repo != tc.repo || number != tc.number {
+			t.Fatalf("Expected %s/%s#%d for %s, got %s/%s#%d, %v", tc.owner, tc.repo, tc.number, tc.url, owner, repo, number, err)
+		}
+	}
+	if _, _, _, err := parseContentURL(""); err != errNoteCard {
+		t.Fatalf("Expected note cards to return errNoteCard, got %v", err)
+	}
+
+	// note cards are ignored by card events
+	mon := newTestMonitor(t, newFakeGitHub(), nil)
+	note := &github.ProjectCardEvent{
+		Action:      github.String("moved"),
+		ProjectCard: &github.ProjectCard{ID: github.Int(1), Note: github.String("Release notes")},
+		Sender:      &github.User{Login: github.String("someone")},
+	}
+	mon.handleProjectCardEvent(note, eventRequest())
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected the note card to be ignored, got %d", got)
+	}
+}
+
+func TestSummaryCommentBatchesActions(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.SummaryComment.Enabled = true
+	posted := make(chan struct{})
+	mon.summaries = newActionSummaries(50*time.Millisecond, func(repo string, issue int, actions []string) {
+		mon.postSummary(repo, issue, actions)
+		close(posted)
+	})
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/triage"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+	// skipped decisions aren't listed
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/unknown"), eventRequest())
+	select {
+	case <-posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the summary to be posted once the window passed")
+	}
+
+	var comments []string
+	for _, call := range f.madeCalls() {
+		if strings.HasPrefix(call, "CreateComment ") {
+			comments = append(comments, call)
+		}
+	}
+	if len(comments) != 1 {
+		t.Fatalf("Expected a single summary comment, got %q", comments)
+	}
+	for _, expected := range []string{"create card: created in 17.06.1/Triage", "move: moved from Triage to Cherry Pick"} {
+		if !strings.Contains(comments[0], expected) {
+			t.Fatalf("Expected the summary to list %q, got %s", expected, comments[0])
+		}
+	}
+	if strings.Contains(comments[0], "skipped") {
+		t.Fatalf("Expected skipped decisions to be left out, got %s", comments[0])
+	}
+}
+
+// queuedDeliveries returns the deliveries waiting in a retry queue
+func queuedDeliveries(q *retryQueue) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var deliveries []string
+	for _, event := range q.events {
+		deliveries = append(deliveries, event.Delivery)
+	}
+	return deliveries
+}
+
+func TestRetryQueue(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	cfg := retryQueueConfig{Path: filepath.Join(t.TempDir(), "retries.json"), Interval: time.Minute, MaxAge: time.Hour}
+	var err error
+	if mon.retries, err = loadRetryQueue(cfg, &mon.stats.retryQueue); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(mon)
+	f.hooks["ListProjectColumns"] = func() error { return errors.New("GitHub is down") }
+	delivery := "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+
+	router.ServeHTTP(httptest.NewRecorder(), signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret"))
+	mon.handlers.Wait()
+	if got := queuedDeliveries(mon.retries); !reflect.DeepEqual(got, []string{delivery}) {
+		t.Fatalf("Expected the failed delivery to be queued, got %v", got)
+	}
+	// the queue survives a restart
+	reloaded, err := loadRetryQueue(cfg, &mon.stats.retryQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queuedDeliveries(reloaded); !reflect.DeepEqual(got, []string{delivery}) {
+		t.Fatalf("Expected the queued delivery to be read back, got %v", got)
+	}
+
+	// not due yet
+	mon.retryDue(time.Now())
+	mon.handlers.Wait()
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the delivery to wait for its backoff, got %v", got)
+	}
+
+	delete(f.hooks, "ListProjectColumns")
+	mon.retryDue(time.Now().Add(2 * time.Minute))
+	mon.handlers.Wait()
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Cherry Pick"}) {
+		t.Fatalf("Expected the retried delivery to move the card, got %v", got)
+	}
+	if got := queuedDeliveries(mon.retries); len(got) != 0 {
+		t.Fatalf("Expected the queue to be empty once the retry succeeded, got %v", got)
+	}
+
+	// deliveries failing for longer than the max age are given up on
+	if err := mon.retries.enqueue(queuedEvent{Delivery: "old", FailedAt: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mon.retries.enqueue(queuedEvent{Delivery: "aging", FailedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if got := queuedDeliveries(mon.retries); !reflect.DeepEqual(got, []string{"aging"}) {
+		t.Fatalf("Expected deliveries past the max age not to be queued, got %v", got)
+	}
+	due, err := mon.retries.take(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 || len(queuedDeliveries(mon.retries)) != 0 {
+		t.Fatalf("Expected deliveries reaching the max age in the queue to be evicted, got %v", due)
+	}
+}
+
+// openedEvent returns the event of issue being opened
+func openedEvent(repo string, issue *github.Issue) *github.IssuesEvent {
+	e := labeledEvent(repo, issue, "")
+	e.Action, e.Label = github.String("opened"), nil
+	return e
+}
+
+func TestAutoTriageDisabled(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	f.addLabels("docker/docker", "17.06.1/triage")
+	f.addLabels("docker/cli", "17.06.1/triage")
+	f.addProject("docker/cli", "17.06.1")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AutoTriage = false
+	cfg.Repos = map[string]repoConfig{"docker/cli": {AutoTriage: github.Bool(true)}}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleEvent(openedEvent("docker/docker", f.addIssue("docker/docker", 1)), nil, eventRequest())
+	mon.handleEvent(openedEvent("docker/cli", f.addIssue("docker/cli", 1)), nil, eventRequest())
+	mon.handlers.Wait()
+
+	expected := []string{"AddLabelsToIssue docker/cli#1 [17.06.1/triage]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected only the repository turning autoTriage back on to be triaged, got %v", got)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected the opened issue to be ignored, got %d", got)
+	}
+}
+
+func TestTemplatedColumnNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("columns:\n  cherry-pick: '{{.Prefix}} {{.Suffix}}s'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeGitHub()
+	project := f.addProject("docker/docker", "17.06.1")
+	f.addColumn(project, "Triage")
+	picks := f.addColumn(project, "17.06.1 cherry-picks")
+	labeled := f.addIssue("docker/docker", 1)
+	dragged := f.addIssue("docker/docker", 2)
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", labeled, "17.06.1/cherry-pick"), eventRequest())
+	if got := f.issueColumns(project, labeled); !reflect.DeepEqual(got, []string{"17.06.1 cherry-picks"}) {
+		t.Fatalf("Expected the card in the rendered column, got %v", got)
+	}
+	// cards moved to the column get the label it was rendered for
+	mon.handleProjectCardEvent(cardEvent("moved", f.addCard(picks, dragged), picks), eventRequest())
+	if got := f.madeCalls(); got[len(got)-1] != "AddLabelsToIssue docker/docker#2 [17.06.1/cherry-pick]" {
+		t.Fatalf("Expected the label of the rendered column, got %v", got)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("columns:\n  cherry-pick: '{{.Prefix'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "Invalid column for cherry-pick") {
+		t.Fatalf("Expected an invalid template to be rejected, got %v", err)
+	}
+}
+
+// collectedSpans decodes the spans of OTLP/HTTP JSON exports
+func collectedSpans(t *testing.T, body []byte) []otlpSpan {
+	var export struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &export); err != nil {
+		t.Fatal(err)
+	}
+	var spans []otlpSpan
+	for _, resource := range export.ResourceSpans {
+		for _, scope := range resource.ScopeSpans {
+			spans = append(spans, scope.Spans...)
+		}
+	}
+	return spans
+}
+
+// spanAttributes returns the attributes of a span as a map
+func spanAttributes(s otlpSpan) map[string]string {
+	attributes := make(map[string]string)
+	for _, attribute := range s.Attributes {
+		attributes[attribute.Key] = attribute.Value.StringValue
+	}
+	return attributes
+}
+
+func TestWebhookSpans(t *testing.T) {
+	exported := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		exported <- body
+	}))
+	defer collector.Close()
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+	mon.secrets = [][]byte{[]byte("secret")}
+	mon.tracer = newTracer(tracingConfig{Endpoint: collector.URL})
+
+	newRouter(mon).ServeHTTP(httptest.NewRecorder(), signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "secret"))
+	mon.handlers.Wait()
+	mon.tracer.flush()
+
+	spans := make(map[string]otlpSpan)
+	for _, s := range collectedSpans(t, <-exported) {
+		spans[s.Name] = s
+	}
+	webhook, handler := spans["webhook"], spans["handle issues"]
+	if webhook.Kind != otlpKindServer || webhook.ParentSpanID != "" {
+		t.Fatalf("Expected a root server span for the webhook, got %+v", spans)
+	}
+	if handler.TraceID != webhook.TraceID || handler.ParentSpanID != webhook.SpanID {
+		t.Fatalf("Expected the handler span to be a child of the webhook span, got %+v", spans)
+	}
+	expected := map[string]string{
+		"github.delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		"github.event":    "issues",
+		"github.action":   "labeled",
+		"github.repo":     "docker/docker",
+		"github.issue":    "1",
+	}
+	if got := spanAttributes(webhook); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected the webhook span to describe the delivery, got %v", got)
+	}
+}
+
+func TestSkipClosedIssues(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		f := newFakeGitHub()
+		board := labelBoard(f)
+		issue := f.addIssue("docker/docker", 1)
+		issue.State = github.String("closed")
+		f.addCard(board.triage, issue)
+		cfg, err := loadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.SkipClosedIssues = skip
+		mon := newTestMonitor(t, f, cfg)
+
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+
+		expected := []string{"Cherry Pick"}
+		if skip {
+			expected = []string{"Triage"}
+		}
+		if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Expected the card of the closed issue in %v with skipClosedIssues %v, got %v", expected, skip, got)
+		}
+	}
+}
+
+func TestRequireTriageColumn(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	// 17.03.2 has a board without a triage column
+	f.addColumn(f.addProject("docker/docker", "17.03.2"), "Cherry Pick")
+	f.addLabels("docker/docker", "17.06.1/triage", "17.03.2/triage")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RequireTriageColumn = true
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleIssueOpenedEvent(openedEvent("docker/docker", f.addIssue("docker/docker", 1)), eventRequest())
+
+	expected := []string{"AddLabelsToIssue docker/docker#1 [17.06.1/triage]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected only the board with a triage column to be triaged, got %v", got)
+	}
+
+	cfg.RequireTriageColumn = false
+	mon.handleIssueOpenedEvent(openedEvent("docker/docker", f.addIssue("docker/docker", 2)), eventRequest())
+	if got := f.madeCalls(); got[len(got)-1] != "AddLabelsToIssue docker/docker#2 [17.06.1/triage 17.03.2/triage]" {
+		t.Fatalf("Expected every open board to be triaged without requireTriageColumn, got %v", got)
+	}
+}
+
+func TestMirrorLabels(t *testing.T) {
+	f := newFakeGitHub()
+	tracked := f.addIssue("docker/release-tracking", 100)
+	tracked.Title = github.String("docker/cli#5: Fix the build")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Mirror.Repo = "docker/release-tracking"
+	mon := newTestMonitor(t, f, cfg)
+
+	// concurrent labels of a new source issue create a single tracking issue
+	issue := f.addIssue("docker/docker", 1)
+	var wg sync.WaitGroup
+	for _, label := range []string{"17.06.1/triage", "17.06.1/cherry-pick", "17.07.0/triage", "17.07.0/cherry-pick"} {
+		wg.Add(1)
+		go func(label string) {
+			defer wg.Done()
+			mon.handleMirrorLabel(labeledEvent("docker/docker", issue, label), eventRequest())
+		}(label)
+	}
+	wg.Wait()
+	// a source issue with a tracking issue found by search gets a comment
+	mon.handleMirrorLabel(labeledEvent("docker/cli", f.addIssue("docker/cli", 5), "17.06.1/triage"), eventRequest())
+	// labels of the tracking repository itself aren't mirrored
+	mon.handleMirrorLabel(labeledEvent("docker/release-tracking", tracked, "17.06.1/triage"), eventRequest())
+
+	created, comments := 0, make(map[string]int)
+	for _, call := range f.madeCalls() {
+		if strings.HasPrefix(call, "Create docker/release-tracking docker/docker#1: ") {
+			created++
+		}
+		if strings.HasPrefix(call, "CreateComment ") {
+			comments[strings.Fields(call)[1]]++
+		}
+	}
+	if created != 1 {
+		t.Fatalf("Expected a single tracking issue, got calls %v", f.madeCalls())
+	}
+	if len(comments) != 2 || comments["docker/release-tracking#100"] != 1 {
+		t.Fatalf("Expected 3 comments on the new tracking issue and 1 on the existing one, got %v", comments)
+	}
+	for number, count := range comments {
+		if number != "docker/release-tracking#100" && count != 3 {
+			t.Fatalf("Expected 3 comments on the new tracking issue, got %v", comments)
+		}
+	}
+	if len(mon.mirrored.locks) != 0 {
+		t.Fatalf("Expected the tracking issue locks to be dropped once released, got %v", mon.mirrored.locks)
+	}
+}
+
+const pullRequestEventPayload = `{
+  "action": %q,
+  "pull_request": {
+    "id": %d,
+    "number": 7,
+    "state": "open",
+    "draft": %t,
+    "url": "https://api.github.com/repos/docker/docker/pulls/7",
+    "issue_url": "https://api.github.com/repos/docker/docker/issues/7",
+    "labels": []
+  },
+  "repository": {"name": "docker", "full_name": "docker/docker", "owner": {"login": "docker"}},
+  "sender": {"login": "someone"}
+}`
+
+func TestDraftPullRequestsWaitForReview(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	f.addLabels("docker/docker", "17.06.1/triage")
+	pull := f.addIssue("docker/docker", 7)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.TriagePullRequests = true
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+	deliver := func(action string, draft bool, delivery string) {
+		req := signedWebhook("pull_request", fmt.Sprintf(pullRequestEventPayload, action, *pull.ID, draft), "secret")
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		mon.handlers.Wait()
+	}
+
+	deliver("opened", true, "1")
+	if got := f.madeCalls(); len(got) != 0 {
+		t.Fatalf("Expected the draft pull request not to be triaged, got %v", got)
+	}
+	deliver("ready_for_review", false, "2")
+	expected := []string{"AddLabelsToIssue docker/docker#7 [17.06.1/triage]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected the pull request to be triaged once ready for review, got %v", got)
+	}
+}
+
+func TestMilestonedIssuePlacement(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	incoming := f.addProject("docker/docker", "Incoming")
+	inbox := f.addColumn(incoming, "Inbox")
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(inbox, issue)
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Milestones = milestoneConfig{Enabled: true, RemoveOtherCards: true}
+	mon := newTestMonitor(t, f, cfg)
+	milestoned := labeledEvent("docker/docker", issue, "")
+	milestoned.Action, milestoned.Label = github.String("milestoned"), nil
+	issue.Milestone = &github.Milestone{Title: github.String("17.06.1")}
+
+	mon.handleMilestonedEvent(milestoned, eventRequest())
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected a card in Triage of the board of the milestone, got %v", got)
+	}
+	if got := f.issueColumns(incoming, issue); len(got) != 0 {
+		t.Fatalf("Expected the card of the other board to be removed, got %v", got)
+	}
+
+	// demilestoning removes the card again
+	issue.Milestone = nil
+	demilestoned := labeledEvent("docker/docker", issue, "")
+	demilestoned.Action, demilestoned.Label = github.String("demilestoned"), nil
+	mon.handleDemilestonedEvent(demilestoned, []byte(`{"milestone": {"title": "17.06.1"}}`), eventRequest())
+	if got := f.issueColumns(board.project, issue); len(got) != 0 {
+		t.Fatalf("Expected the card to be removed from the board of the milestone, got %v", got)
+	}
+}
+
+func TestMoveThrottle(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	card := f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.MoveThrottle = time.Minute
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+	// another automation moves the card back
+	if _, err := f.client().Projects.MoveProjectCard(context.Background(), *card.ID, &github.ProjectCardMoveOptions{Position: "top", ColumnID: *board.triage.ID}); err != nil {
+		t.Fatal(err)
+	}
+	mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+
+	if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected the card not to be moved to Cherry Pick again within the throttle, got %v", got)
+	}
+	if got := mon.stats.ignored.load(); got != 1 {
+		t.Fatalf("Expected the throttled move to be ignored, got %d", got)
+	}
+
+	var moves recentMoves
+	now := time.Now()
+	for _, tc := range []struct {
+		columnID int
+		at       time.Time
+		allowed  bool
+	}{
+		{1, now, true},
+		{1, now.Add(30 * time.Second), false},
+		{2, now.Add(40 * time.Second), true},
+		{2, now.Add(2 * time.Minute), true},
+	} {
+		if allowed := moves.allow(10, tc.columnID, time.Minute, tc.at); allowed != tc.allowed {
+			t.Fatalf("Expected the move to column %d at %v to be allowed %v", tc.columnID, tc.at.Sub(now), tc.allowed)
+		}
+	}
+}
+
+// writePrivateKey writes a new PKCS #1 RSA key to path and returns it
+func writePrivateKey(t *testing.T, path string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestReloadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile, tokenFile, keyFile := filepath.Join(dir, "secret"), filepath.Join(dir, "token"), filepath.Join(dir, "app.pem")
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(secretFile, "old")
+	write(tokenFile, "token")
+	writePrivateKey(t, keyFile)
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	f.addCard(board.triage, issue)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.App = appConfig{ID: 1, PrivateKeyFile: keyFile}
+	mon.secretSources = secretSources{webhookSecretFile: secretFile, githubTokenFile: tokenFile}
+	mon.adminToken = []byte("admin")
+	if err := mon.reloadSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(mon)
+	reload := func() int {
+		req := httptest.NewRequest("POST", "/reload", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	write(secretFile, "new")
+	rotated := writePrivateKey(t, keyFile)
+	if code := reload(); code != http.StatusNoContent {
+		t.Fatalf("Expected the reload to succeed, got %d", code)
+	}
+	if key := mon.clients.app.key; key.N.Cmp(rotated.N) != 0 {
+		t.Fatal("Expected the rotated app key to be used")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "old"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected the previous secret to be rejected, got %d", w.Code)
+	}
+
+	// nothing is replaced when a secret can't be read
+	write(secretFile, "newer")
+	write(keyFile, "not a key")
+	if code := reload(); code != http.StatusInternalServerError {
+		t.Fatalf("Expected the reload to fail with an invalid key, got %d", code)
+	}
+	if mon.clients.app.key.N.Cmp(rotated.N) != 0 {
+		t.Fatal("Expected the app key to be kept after a failed reload")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), "new"))
+	mon.handlers.Wait()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the secret to be kept after a failed reload, got %d", w.Code)
+	}
+}
+
+func TestInheritLabels(t *testing.T) {
+	if got := linkedIssues("Fixes #1, closes #2, resolved #1 and mentions #3, see docker/cli#4"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("Expected the closed issues 1 and 2, got %v", got)
+	}
+	f := newFakeGitHub()
+	f.addIssue("docker/docker", 1, "17.06.1/cherry-pick", "kind/bug")
+	f.addIssue("docker/docker", 2, "17.03.2/cherry-pick", "17.06.1/triage")
+	f.addIssue("docker/docker", 3, "17.07.0/cherry-pick")
+	mon := newTestMonitor(t, f, nil)
+	mon.config.InheritLabels = []string{"cherry-pick"}
+	pull := f.addIssue("docker/docker", 7, "17.03.2/cherry-pick")
+	pull.Body = github.String("Fixes #1, closes #2 and mentions #3")
+	pull.PullRequestLinks = &github.PullRequestLinks{}
+
+	if err := mon.inheritLabels(labeledEvent("docker/docker", pull, ""), eventRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"AddLabelsToIssue docker/docker#7 [17.06.1/cherry-pick]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected only the missing inherited labels of the closed issues, got %v", got)
+	}
+}
+
+func TestWIPLimits(t *testing.T) {
+	for _, block := range []bool{false, true} {
+		f := newFakeGitHub()
+		board := labelBoard(f)
+		cfg, err := loadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.WIPLimits = map[string]wipLimitConfig{"Cherry Pick": {Limit: 2, Block: block}}
+		mon := newTestMonitor(t, f, cfg)
+		var issues []*github.Issue
+		for number := 1; number <= 3; number++ {
+			issue := f.addIssue("docker/docker", number)
+			f.addCard(board.triage, issue)
+			issues = append(issues, issue)
+			mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+		}
+
+		var comments []string
+		for _, call := range f.madeCalls() {
+			if strings.HasPrefix(call, "CreateComment ") {
+				comments = append(comments, strings.Fields(call)[1])
+			}
+		}
+		under := f.issueColumns(board.project, issues[1])
+		over := f.issueColumns(board.project, issues[2])
+		if !reflect.DeepEqual(under, []string{"Cherry Pick"}) {
+			t.Fatalf("Expected moves under the limit to go through with block %v, got %v", block, under)
+		}
+		if block {
+			if !reflect.DeepEqual(over, []string{"Triage"}) || len(comments) != 0 {
+				t.Fatalf("Expected the move over the limit to be blocked, got %v and comments %v", over, comments)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(over, []string{"Cherry Pick"}) || !reflect.DeepEqual(comments, []string{"docker/docker#3"}) {
+			t.Fatalf("Expected the move over the limit to warn on the issue, got %v and comments %v", over, comments)
+		}
+	}
+}
+
+func TestIncludeClosedProjects(t *testing.T) {
+	for _, include := range []bool{false, true} {
+		f := newFakeGitHub()
+		board := labelBoard(f)
+		f.closeProject(board.project)
+		// an open board of another release doesn't stop the fallback
+		f.addColumn(f.addProject("docker/docker", "17.07.0"), "Cherry Pick")
+		issue := f.addIssue("docker/docker", 1)
+		cfg, err := loadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.IncludeClosedProjects = include
+		mon := newTestMonitor(t, f, cfg)
+
+		mon.handleLabelEvent(labeledEvent("docker/docker", issue, "17.06.1/cherry-pick"), eventRequest())
+
+		var expected []string
+		if include {
+			expected = []string{"Cherry Pick"}
+		}
+		if got := f.issueColumns(board.project, issue); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Expected cards %v on the closed board with includeClosedProjects %v, got %v", expected, include, got)
+		}
+	}
+}
+
+func TestWebhookAuthFailureLimit(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	issue := f.addIssue("docker/docker", 1)
+	mon := newTestMonitor(t, f, nil)
+	mon.config.AuthLimit = authLimitConfig{MaxFailures: 2, Window: time.Minute}
+	mon.secrets = [][]byte{[]byte("secret")}
+	router := newRouter(mon)
+	deliver := func(secret, source string) int {
+		req := signedWebhook("issues", fmt.Sprintf(labeledPayload, *issue.ID), secret)
+		req.RemoteAddr = source + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		mon.handlers.Wait()
+		return w.Code
+	}
+
+	for _, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if code := deliver("not the secret", "192.0.2.1"); code != expected {
+			t.Fatalf("Expected %d, got %d", expected, code)
+		}
+	}
+	// even signed deliveries are rejected until the window ends
+	if code := deliver("secret", "192.0.2.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the source to stay rejected, got %d", code)
+	}
+	if code := deliver("secret", "192.0.2.2"); code != http.StatusOK {
+		t.Fatalf("Expected other sources to be accepted, got %d", code)
+	}
+	if got := mon.stats.authFailures.load(); got != 2 {
+		t.Fatalf("Expected 2 signature failures, got %d", got)
+	}
+	if mon.authFailures.exceeded("192.0.2.1", 2, time.Minute, time.Now().Add(time.Minute)) {
+		t.Fatal("Expected the source to be accepted again once the window ended")
+	}
+}
+
+func TestExportBoard(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	f.closeProject(board.project)
+	issue := f.addIssue("docker/docker", 1)
+	issue.Title = github.String("Fix the daemon")
+	other := f.addIssue("docker/cli", 2)
+	other.Title = github.String("Fix the CLI")
+	first := f.addCard(board.cherryPick, issue)
+	second := f.addCard(board.cherryPick, other)
+	note := &github.ProjectCard{ID: github.Int(f.id()), Note: github.String("Release notes")}
+	f.cards[*board.triage.ID] = append(f.cards[*board.triage.ID], note)
+	mon := newTestMonitor(t, f, nil)
+
+	var buf strings.Builder
+	if err := mon.exportBoard(context.Background(), "docker/docker", "17.06.1", &buf); err != nil {
+		t.Fatal(err)
+	}
+	var exported exportedBoard
+	if err := json.Unmarshal([]byte(buf.String()), &exported); err != nil {
+		t.Fatal(err)
+	}
+	expected := exportedBoard{
+		Project: "17.06.1",
+		Columns: []exportedColumn{
+			{Name: "Triage", Cards: []exportedCard{{ID: *note.ID, Note: "Release notes"}}},
+			{Name: "Cherry Pick", Cards: []exportedCard{
+				{ID: *first.ID, Repo: "docker/docker", Number: 1, Title: "Fix the daemon"},
+				{ID: *second.ID, Repo: "docker/cli", Number: 2, Title: "Fix the CLI"},
+			}},
+			{Name: "Cherry Picked", Cards: []exportedCard{}},
+		},
+	}
+	if !reflect.DeepEqual(exported, expected) {
+		t.Fatalf("Expected %+v, got %s", expected, buf.String())
+	}
+
+	if err := mon.exportBoard(context.Background(), "docker/docker", "17.07.0", &buf); err == nil || !strings.Contains(err.Error(), "No project named 17.07.0") {
+		t.Fatalf("Expected a missing project to fail the export, got %v", err)
+	}
+}
+
+func TestTriageSuffixes(t *testing.T) {
+	f := newFakeGitHub()
+	labelBoard(f)
+	f.addLabels("docker/docker", "17.06.1/triage", "17.06.1/needs-review", "17.06.1/cherry-pick", "17.07.0/needs-review")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.TriageSuffixes = []string{"triage", "needs-review"}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleEvent(openedEvent("docker/docker", f.addIssue("docker/docker", 1)), nil, eventRequest())
+	mon.handlers.Wait()
+
+	expected := []string{"AddLabelsToIssue docker/docker#1 [17.06.1/triage 17.06.1/needs-review]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected every suffix of the open project to be applied, got %v", got)
+	}
+}
+
+func TestMaxEventAge(t *testing.T) {
+	now := time.Now()
+	cfg := &config{MaxEventAge: time.Hour}
+	recent, old := now.Add(-time.Minute), now.Add(-2*time.Hour)
+	fresh := &github.IssuesEvent{Issue: &github.Issue{UpdatedAt: &recent}}
+	stale := &github.IssuesEvent{Issue: &github.Issue{UpdatedAt: &old}}
+	card := &github.ProjectCardEvent{ProjectCard: &github.ProjectCard{UpdatedAt: &github.Timestamp{Time: old}}}
+	for _, tc := range []struct {
+		event interface{}
+		stale bool
+	}{
+		{fresh, false},
+		{stale, true},
+		{card, true},
+		{&github.IssuesEvent{Issue: &github.Issue{}}, false},
+	} {
+		if _, got := cfg.isStale(tc.event, now); got != tc.stale {
+			t.Errorf("Expected %+v stale to be %v, got %v", tc.event, tc.stale, got)
+		}
+	}
+	if _, got := (&config{}).isStale(stale, now); got {
+		t.Errorf("Expected no event to be stale without maxEventAge")
+	}
+	if age, _ := cfg.isStale(stale, now); age != 2*time.Hour {
+		t.Errorf("Expected the event to be 2h old, got %v", age)
+	}
+}
+
+func TestRequestTeamReview(t *testing.T) {
+	f := newFakeGitHub()
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ReviewTeams = map[string]string{"17.06.1": "release-owners"}
+	mon := newTestMonitor(t, f, cfg)
+
+	pull := f.addIssue("docker/docker", 1)
+	mon.requestTeamReview(labeledEvent("docker/docker", pull, "17.06.1/cherry-pick"), eventRequest())
+	mon.requestTeamReview(labeledEvent("docker/docker", pull, "17.06.1/cherry-picked"), eventRequest())
+	mon.requestTeamReview(labeledEvent("docker/docker", pull, "17.07.0/cherry-pick"), eventRequest())
+
+	expected := []string{"RequestTeamReviewers docker/docker#1 [release-owners]"}
+	if got := f.madeCalls(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected a single review request from the release team, got %v", got)
+	}
+}
+
+func TestCreateIfMissing(t *testing.T) {
+	f := newFakeGitHub()
+	board := labelBoard(f)
+	existing := f.addIssue("docker/docker", 1)
+	f.addCard(board.cherryPick, existing)
+	missing := f.addIssue("docker/docker", 2)
+	cfg, _ := loadConfig("")
+	cfg.Actions = map[string]actionConfig{"cherry-picked": {CreateIfMissing: github.Bool(false)}}
+	mon := newTestMonitor(t, f, cfg)
+
+	mon.handleLabelEvent(labeledEvent("docker/docker", existing, "17.06.1/cherry-picked"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", missing, "17.06.1/cherry-picked"), eventRequest())
+	mon.handleLabelEvent(labeledEvent("docker/docker", missing, "17.06.1/triage"), eventRequest())
+
+	if got := f.issueColumns(board.project, existing); !reflect.DeepEqual(got, []string{"Cherry Picked"}) {
+		t.Fatalf("Expected the existing card in Cherry Picked, got %v", got)
+	}
+	if got := f.issueColumns(board.project, missing); !reflect.DeepEqual(got, []string{"Triage"}) {
+		t.Fatalf("Expected a card only for the action creating missing ones, got %v", got)
+	}
+}
+
+func TestBoardCacheMoveCardCopies(t *testing.T) {
+	cache := newBoardCache(time.Minute)
+	card := &github.ProjectCard{ID: github.Int(1)}
+	cache.setCards(10, []*github.ProjectCard{card})
+	cache.setCards(11, nil)
+	read, _ := cache.columnCards(10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = read[0].GetUpdatedAt()
+	}()
+	cache.moveCard(1, 11, "top")
+	<-done
+
+	if card.UpdatedAt != nil {
+		t.Fatalf("Expected the card handed out to be left alone, got %v", card.UpdatedAt)
+	}
+	moved, _ := cache.columnCards(11)
+	if len(moved) != 1 || moved[0].UpdatedAt == nil {
+		t.Fatalf("Expected the moved card in its new column with UpdatedAt set, got %v", moved)
+	}
+}
+
+func TestTracedTransportPropagatesTrace(t *testing.T) {
+	exported := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		exported <- body
+	}))
+	defer collector.Close()
+	received := make(chan string, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("traceparent")
+	}))
+	defer api.Close()
+	tracer := newTracer(tracingConfig{Endpoint: collector.URL})
+	client := &http.Client{Transport: &tracedTransport{tracer: tracer, base: http.DefaultTransport}}
+
+	ctx, parent := tracer.start(context.Background(), "handle issues")
+	req, err := http.NewRequest("GET", api.URL+"/repos/docker/docker", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.finish()
+	if req.Header.Get("traceparent") != "" {
+		t.Fatalf("Expected the request of the caller to be left alone")
+	}
+	tracer.flush()
+
+	var call otlpSpan
+	for _, s := range collectedSpans(t, <-exported) {
+		if s.Name == "GitHub GET /repos/docker/docker" {
+			call = s
+		}
+	}
+	if expected, got := fmt.Sprintf("00-%s-%s-01", call.TraceID, call.SpanID), <-received; got != expected {
+		t.Fatalf("Expected the traceparent of the API call span %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metricKey joins label values into a map key
+func metricKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders label names and values in the Prometheus text format,
+// for example `{type="issues",action="labeled"}`
+func formatLabels(names []string, key string, extra ...string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, names[i], labelValueEscaper.Replace(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// counterVec is a counter partitioned by labels
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+func (c *counterVec) inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[metricKey(values)]++
+}
+
+func (c *counterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make(map[string]bool)
+	for key := range c.values {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labels, key), c.values[key])
+	}
+}
+
+// gaugeVec is a gauge partitioned by labels
+type gaugeVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newGaugeVec(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (g *gaugeVec) set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[metricKey(values)] = v
+}
+
+func (g *gaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	keys := make(map[string]bool)
+	for key := range g.values {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		fmt.Fprintf(w, "%s%s %g\n", g.name, formatLabels(g.labels, key), g.values[key])
+	}
+}
+
+// histogram is the state of one series of a histogramVec
+type histogram struct {
+	// buckets counts observations per bucket, not cumulative
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// histogramVec is a latency histogram partitioned by labels
+type histogramVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, values: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(d time.Duration, values ...string) {
+	seconds := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := metricKey(values)
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		h.values[key] = series
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			series.buckets[i]++
+			break
+		}
+	}
+	series.sum += seconds
+	series.count++
+}
+
+func (h *histogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make(map[string]bool)
+	for key := range h.values {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		series := h.values[key]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += series.buckets[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, key), series.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key), series.count)
+	}
+}
+
+// metrics are exposed on /metrics in the Prometheus text format, to alert on
+// failures instead of grepping logs
+type metrics struct {
+	// events counts webhooks received by event type and action
+	events *counterVec
+	// decisions counts what the bot did, by action (move, label, triage...)
+	// and result (done, skipped or error)
+	decisions *counterVec
+	// apiRequests counts GitHub API calls by method and status code
+	apiRequests *counterVec
+	// apiErrors counts failed GitHub API calls by method
+	apiErrors       *counterVec
+	handlerDuration *histogramVec
+	apiDuration     *histogramVec
+	// rateRemaining is the remaining GitHub quota by resource (core, search,
+	// graphql), as of the last response of any token
+	rateRemaining *gaugeVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		events:          newCounterVec("releasebot_events_received_total", "Webhook events received.", "type", "action"),
+		decisions:       newCounterVec("releasebot_decisions_total", "Actions taken on issues, like card moves and label applications.", "action", "result"),
+		apiRequests:     newCounterVec("releasebot_github_requests_total", "GitHub API requests.", "method", "status"),
+		apiErrors:       newCounterVec("releasebot_github_errors_total", "GitHub API requests that failed or got an error status.", "method"),
+		handlerDuration: newHistogramVec("releasebot_handler_duration_seconds", "Time spent handling events.", "type"),
+		apiDuration:     newHistogramVec("releasebot_github_request_duration_seconds", "Latency of GitHub API requests.", "method"),
+		rateRemaining:   newGaugeVec("releasebot_github_rate_limit_remaining", "GitHub API calls left before the rate limit resets.", "resource"),
+	}
+}
+
+// observeEvent counts a received webhook
+func (m *metrics) observeEvent(eventType string, payload []byte) {
+	var event struct {
+		Action string `json:"action"`
+	}
+	// events without an action, like push, are counted with an empty one
+	json.Unmarshal(payload, &event)
+	m.events.inc(eventType, event.Action)
+}
+
+// observeDecision counts a recorded decision by the prefix of its outcome
+func (m *metrics) observeDecision(action, outcome string) {
+	result := "done"
+	if strings.HasPrefix(outcome, "error:") {
+		result = "error"
+	} else if strings.HasPrefix(outcome, "skipped:") {
+		result = "skipped"
+	}
+	m.decisions.inc(action, result)
+}
+
+// observeRateLimit records the remaining quota of a GitHub response
+func (m *metrics) observeRateLimit(resp *http.Response) {
+	remaining, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	m.rateRemaining.set(remaining, resource)
+}
+
+// handleMetrics writes the metrics and the event stats in the Prometheus text
+// format
+func (mon *githubMonitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+	stats := mon.stats.snapshot()
+	fmt.Fprintf(buf, "# HELP releasebot_events_handled_total Webhook events by how they were handled.\n# TYPE releasebot_events_handled_total counter\n")
+	for _, outcome := range []string{"processed", "ignored", "dropped_error", "panics"} {
+		fmt.Fprintf(buf, "releasebot_events_handled_total{outcome=%q} %d\n", outcome, stats[outcome])
+	}
+	fmt.Fprintf(buf, "# HELP releasebot_auth_failures_total Webhooks with an invalid signature.\n# TYPE releasebot_auth_failures_total counter\n")
+	fmt.Fprintf(buf, "releasebot_auth_failures_total %d\n", stats["auth_failures"])
+	fmt.Fprintf(buf, "# HELP releasebot_busy_total Webhooks the workers were too busy to take.\n# TYPE releasebot_busy_total counter\n")
+	fmt.Fprintf(buf, "releasebot_busy_total %d\n", stats["busy"])
+	fmt.Fprintf(buf, "# HELP releasebot_retry_queue Failed events waiting to be retried.\n# TYPE releasebot_retry_queue gauge\n")
+	fmt.Fprintf(buf, "releasebot_retry_queue %d\n", stats["retry_queue"])
+	mon.metrics.events.write(buf)
+	mon.metrics.decisions.write(buf)
+	mon.metrics.apiRequests.write(buf)
+	mon.metrics.apiErrors.write(buf)
+	mon.metrics.handlerDuration.write(buf)
+	mon.metrics.apiDuration.write(buf)
+	mon.metrics.rateRemaining.write(buf)
+}
+
+// metricsTransport counts and times GitHub API calls
+type metricsTransport struct {
+	metrics *metrics
+	base    http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.metrics.apiDuration.observe(time.Since(start), req.Method)
+	if err != nil {
+		t.metrics.apiRequests.inc(req.Method, "error")
+		t.metrics.apiErrors.inc(req.Method)
+		return nil, err
+	}
+	t.metrics.apiRequests.inc(req.Method, strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		t.metrics.apiErrors.inc(req.Method)
+	}
+	return resp, nil
+}
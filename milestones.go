@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// milestoneConfig places the cards of milestoned issues on the board of the
+// release named by the milestone
+type milestoneConfig struct {
+	// Enabled handles the `milestoned` and `demilestoned` issue actions
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Column is where cards are placed on the release board, Triage by default
+	Column string `yaml:"column" json:"column"`
+	// RemoveOtherCards deletes the cards of the issue on the other open
+	// boards of the repository, for example a generic Incoming board
+	RemoveOtherCards bool `yaml:"removeOtherCards" json:"removeOtherCards"`
+	// KeepDemilestoned leaves the card of an issue on the release board when
+	// its milestone is removed, instead of deleting it
+	KeepDemilestoned bool `yaml:"keepDemilestoned" json:"keepDemilestoned"`
+}
+
+// demilestonedPayload is the part of a demilestoned payload go-github doesn't
+// decode, the issue no longer has the milestone
+type demilestonedPayload struct {
+	Milestone *github.Milestone `json:"milestone"`
+}
+
+func (c milestoneConfig) column() string {
+	if c.Column == "" {
+		return columnNames["triage"]
+	}
+	return c.Column
+}
+
+// When an issue is milestoned to a release its card goes to the board of that
+// release, found from the milestone title like labels find it from their
+// prefix.
+func (mon *githubMonitor) handleMilestonedEvent(e *github.IssuesEvent, r *http.Request) {
+	if e.Issue.Milestone == nil || e.Issue.Milestone.GetTitle() == "" {
+		mon.stats.ignored.inc()
+		return
+	}
+	milestone := *e.Issue.Milestone.Title
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	projects, err := mon.getProjects(milestone, e)
+	if err != nil {
+		requestLog(r).Infof("Not placing issue #%v for milestone %v, %v", *e.Issue.Number, milestone, err)
+		mon.record(e, "move", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
+		return
+	}
+	placement := labelPlacement{
+		labelSuffix: "milestoned",
+		columnName:  mon.config.Milestones.column(),
+	}
+	targets := make(map[int]bool)
+	for _, project := range projects {
+		targets[*project.ID] = true
+		mon.placeCard(ctx, client, e, project, placement, r)
+	}
+	if !mon.config.Milestones.RemoveOtherCards {
+		return
+	}
+	others, err := mon.listOpenProjects(e)
+	if err != nil {
+		requestLog(r).Errorf("Failed listing projects to remove other cards of issue #%v, %v", *e.Issue.Number, err)
+		return
+	}
+	for _, project := range others {
+		if !targets[*project.ID] {
+			mon.removeCards(ctx, client, e, project, r)
+		}
+	}
+}
+
+// removeCards deletes every card of the issue of an event from a project
+func (mon *githubMonitor) removeCards(ctx context.Context, client *githubClient, e *github.IssuesEvent, project *github.Project, r *http.Request) {
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		return
+	}
+	cards, err := issueCards(ctx, client, project, columns, e)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		return
+	}
+	for _, found := range cards {
+		requestLog(r).Infof("Removing card of issue #%v from project %v", *e.Issue.Number, *project.Name)
+		if _, err := client.Projects.DeleteProjectCard(ctx, *found.card.ID); err != nil {
+			requestLog(r).Errorf("Failed deleting card %v:\n%v", *found.card.ID, err)
+			mon.record(e, "remove card", fmt.Sprintf("error: %v", err))
+			continue
+		}
+		mon.record(e, "remove card", fmt.Sprintf("removed from %v", *project.Name))
+	}
+}
+
+// When an issue is demilestoned its card is removed from the board of the
+// release of the milestone, undoing handleMilestonedEvent.
+func (mon *githubMonitor) handleDemilestonedEvent(e *github.IssuesEvent, payload []byte, r *http.Request) {
+	var extra demilestonedPayload
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		requestLog(r).Errorf("Failed to parse demilestoned issue, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	if extra.Milestone == nil || extra.Milestone.GetTitle() == "" {
+		mon.stats.ignored.inc()
+		return
+	}
+	milestone := *extra.Milestone.Title
+	projects, err := mon.getProjects(milestone, e)
+	if err != nil {
+		requestLog(r).Infof("Not removing issue #%v for milestone %v, %v", *e.Issue.Number, milestone, err)
+		mon.record(e, "remove card", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	for _, project := range projects {
+		mon.removeCards(ctx, client, e, project, r)
+	}
+	mon.stats.processed.inc()
+}
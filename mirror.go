@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// mirrorConfig mirrors labels applied in source repositories to a central
+// tracking repository, as one tracking issue per source issue with a comment
+// per label
+type mirrorConfig struct {
+	// Repo is the tracking repository as `owner/name`, mirroring is disabled
+	// when empty
+	Repo string `yaml:"repo" json:"repo"`
+}
+
+// repo returns the owner and name of the tracking repository
+func (c mirrorConfig) repo() (string, string) {
+	parts := strings.SplitN(c.Repo, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// trackingIssues remembers the tracking issue of source issues, since search
+// results lag behind newly created issues
+type trackingIssues struct {
+	mu      sync.Mutex
+	numbers map[string]int
+	// locks serialize the lookup and creation of the tracking issue of a
+	// source, so concurrent labels don't create it twice. A lock is dropped
+	// once nobody holds or waits for it.
+	locks map[string]*trackingLock
+}
+
+// trackingLock is the lock of a source and the number of labels holding or
+// waiting for it, t.mu guards holders
+type trackingLock struct {
+	sync.Mutex
+	holders int
+}
+
+// lock locks the tracking issue of source and returns its unlock function
+func (t *trackingIssues) lock(source string) func() {
+	t.mu.Lock()
+	if t.locks == nil {
+		t.locks = make(map[string]*trackingLock)
+	}
+	l, ok := t.locks[source]
+	if !ok {
+		l = &trackingLock{}
+		t.locks[source] = l
+	}
+	l.holders++
+	t.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		l.holders--
+		if l.holders == 0 {
+			delete(t.locks, source)
+		}
+	}
+}
+
+func (t *trackingIssues) get(source string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	number, ok := t.numbers[source]
+	return number, ok
+}
+
+func (t *trackingIssues) set(source string, number int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.numbers == nil {
+		t.numbers = make(map[string]int)
+	}
+	t.numbers[source] = number
+}
+
+// handleMirrorLabel comments a label applied to an issue on its tracking issue
+// in the tracking repository, creating the tracking issue the first time. It
+// runs alongside handleLabelEvent, which counts the event in the stats.
+func (mon *githubMonitor) handleMirrorLabel(e *github.IssuesEvent, r *http.Request) {
+	owner, repo := mon.config.Mirror.repo()
+	source := fmt.Sprintf("%s/%s#%d", *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number)
+	if strings.EqualFold(fmt.Sprintf("%s/%s", *e.Repo.Owner.Login, *e.Repo.Name), mon.config.Mirror.Repo) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(owner)
+	unlock := mon.mirrored.lock(source)
+	defer unlock()
+	number, err := mon.trackingIssue(ctx, client, owner, repo, source)
+	if err != nil {
+		requestLog(r).Errorf("Could not find the tracking issue of %s, %v", source, err)
+		mon.record(e, "mirror", fmt.Sprintf("error: %v", err))
+		return
+	}
+	body := fmt.Sprintf("Label `%s` applied to %s", *e.Label.Name, source)
+	if number == 0 {
+		title := fmt.Sprintf("%s: %s", source, e.Issue.GetTitle())
+		issueBody := fmt.Sprintf("Tracking %s\n\n%s", e.Issue.GetHTMLURL(), body)
+		issue, _, err := client.Issues.Create(ctx, owner, repo, &github.IssueRequest{Title: &title, Body: &issueBody})
+		if err != nil {
+			requestLog(r).Errorf("Could not create the tracking issue of %s, %v", source, err)
+			mon.record(e, "mirror", fmt.Sprintf("error: %v", err))
+			return
+		}
+		mon.mirrored.set(source, *issue.Number)
+		requestLog(r).Infof("Created tracking issue %s#%d for %s", mon.config.Mirror.Repo, *issue.Number, source)
+		mon.record(e, "mirror", fmt.Sprintf("created %s#%d", mon.config.Mirror.Repo, *issue.Number))
+		return
+	}
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body}); err != nil {
+		requestLog(r).Errorf("Could not comment on tracking issue %s#%d, %v", mon.config.Mirror.Repo, number, err)
+		mon.record(e, "mirror", fmt.Sprintf("error: %v", err))
+		return
+	}
+	requestLog(r).Infof("Mirrored label '%v' to %s#%d", *e.Label.Name, mon.config.Mirror.Repo, number)
+	mon.record(e, "mirror", fmt.Sprintf("commented on %s#%d", mon.config.Mirror.Repo, number))
+}
+
+// trackingIssue returns the number of the tracking issue of source, 0 when it
+// doesn't exist yet. Tracking issues are titled after their source issue.
+func (mon *githubMonitor) trackingIssue(ctx context.Context, client *githubClient, owner, repo, source string) (int, error) {
+	if number, ok := mon.mirrored.get(source); ok {
+		return number, nil
+	}
+	query := fmt.Sprintf("repo:%s/%s is:issue in:title \"%s:\"", owner, repo, source)
+	result, _, err := client.Search.Issues(ctx, query, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, issue := range result.Issues {
+		if strings.HasPrefix(issue.GetTitle(), source+":") {
+			mon.mirrored.set(source, *issue.Number)
+			return *issue.Number, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+)
+
+// listPageSize is the most items the GitHub API returns per page
+const listPageSize = 100
+
+// paginate calls list with the options of every page, from the first to the
+// last. list returns the response of the page it fetched.
+func paginate(list func(opt github.ListOptions) (*github.Response, error)) error {
+	opt := github.ListOptions{PerPage: listPageSize}
+	for {
+		resp, err := list(opt)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// listLabels returns every label of a repository
+func listLabels(ctx context.Context, client *githubClient, owner, repo string) ([]*github.Label, error) {
+	var labels []*github.Label
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Issues.ListLabels(ctx, owner, repo, &opt)
+		labels = append(labels, page...)
+		return resp, err
+	})
+	return labels, err
+}
+
+// listIssueLabels returns every label of an issue
+func listIssueLabels(ctx context.Context, client *githubClient, owner, repo string, number int) ([]*github.Label, error) {
+	var labels []*github.Label
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Issues.ListLabelsByIssue(ctx, owner, repo, number, &opt)
+		labels = append(labels, page...)
+		return resp, err
+	})
+	return labels, err
+}
+
+// listIssues returns every issue of a repository matching opt
+func listIssues(ctx context.Context, client *githubClient, owner, repo string, opt github.IssueListByRepoOptions) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	err := paginate(func(listOpt github.ListOptions) (*github.Response, error) {
+		opt.ListOptions = listOpt
+		page, resp, err := client.Issues.ListByRepo(ctx, owner, repo, &opt)
+		issues = append(issues, page...)
+		return resp, err
+	})
+	return issues, err
+}
+
+// listRepoProjects returns every project of a repository in state, one of
+// open, closed or all
+func listRepoProjects(ctx context.Context, client *githubClient, owner, repo, state string) ([]*github.Project, error) {
+	var projects []*github.Project
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Repositories.ListProjects(ctx, owner, repo, &github.ProjectListOptions{State: state, ListOptions: opt})
+		projects = append(projects, page...)
+		return resp, err
+	})
+	return projects, err
+}
+
+// listOrgProjects returns every project of an organization in state, one of
+// open, closed or all
+func listOrgProjects(ctx context.Context, client *githubClient, org, state string) ([]*github.Project, error) {
+	var projects []*github.Project
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Orgs.ListProjects(ctx, org, &github.ProjectListOptions{State: state, ListOptions: opt})
+		projects = append(projects, page...)
+		return resp, err
+	})
+	return projects, err
+}
+
+// listColumns returns every column of a project
+func listColumns(ctx context.Context, client *githubClient, projectID int) ([]*github.ProjectColumn, error) {
+	var columns []*github.ProjectColumn
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Projects.ListProjectColumns(ctx, projectID, &opt)
+		columns = append(columns, page...)
+		return resp, err
+	})
+	return columns, err
+}
+
+// listCards returns every card of a column
+func listCards(ctx context.Context, client *githubClient, columnID int) ([]*github.ProjectCard, error) {
+	var cards []*github.ProjectCard
+	err := paginate(func(opt github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Projects.ListProjectCards(ctx, columnID, &opt)
+		cards = append(cards, page...)
+		return resp, err
+	})
+	return cards, err
+}
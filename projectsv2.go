@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// projectsV2Config moves items of Projects (V2), which the classic projects API
+// can't reach, by setting their status field instead of moving cards
+type projectsV2Config struct {
+	// Enabled handles labels with the Projects (V2) of the repository owner
+	// instead of classic projects
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// StatusField is the single select field label actions set, `Status` by
+	// default
+	StatusField string `yaml:"statusField" json:"statusField"`
+}
+
+const defaultStatusField = "Status"
+
+func (c projectsV2Config) statusField() string {
+	if c.StatusField == "" {
+		return defaultStatusField
+	}
+	return c.StatusField
+}
+
+// projectV2 is a project of the Projects (V2) API
+type projectV2 struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Closed bool   `json:"closed"`
+}
+
+// projectV2Field is a single select field of a project and its options
+type projectV2Field struct {
+	ID      string `json:"id"`
+	Options []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"options"`
+}
+
+// optionID returns the ID of the option named name, regardless of case
+func (f *projectV2Field) optionID(name string) (string, bool) {
+	for _, option := range f.Options {
+		if strings.EqualFold(option.Name, name) {
+			return option.ID, true
+		}
+	}
+	return "", false
+}
+
+// graphqlClient makes GitHub GraphQL API calls, Projects (V2) have no REST API
+type graphqlClient struct {
+	client *github.Client
+}
+
+// graphqlResponse is the envelope of GraphQL responses, which report errors
+// with a 200 status
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// query runs a GraphQL query or mutation and decodes its data into v
+func (c *graphqlClient) query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) (*github.Response, error) {
+	body := map[string]interface{}{"query": query, "variables": variables}
+	req, err := c.client.NewRequest("POST", graphqlURL(c.client), body)
+	if err != nil {
+		return nil, err
+	}
+	var result graphqlResponse
+	resp, err := c.client.Do(ctx, req, &result)
+	if err != nil {
+		return resp, err
+	}
+	if len(result.Errors) > 0 {
+		var messages []string
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return resp, fmt.Errorf("GraphQL error: %s", strings.Join(messages, "; "))
+	}
+	return resp, json.Unmarshal(result.Data, v)
+}
+
+const listProjectsV2Query = `
+query($owner: String!, $query: String!, $cursor: String) {
+  repositoryOwner(login: $owner) {
+    ... on Organization { projectsV2(first: 100, after: $cursor, query: $query) { ...projects } }
+    ... on User { projectsV2(first: 100, after: $cursor, query: $query) { ...projects } }
+  }
+}
+fragment projects on ProjectV2Connection {
+  nodes { id title closed }
+  pageInfo { hasNextPage endCursor }
+}`
+
+// ListProjectsV2 returns the projects of owner whose title starts with prefix
+func (c *graphqlClient) ListProjectsV2(ctx context.Context, owner, prefix string) ([]projectV2, *github.Response, error) {
+	variables := map[string]interface{}{"owner": owner, "query": prefix, "cursor": nil}
+	var projects []projectV2
+	for {
+		var data struct {
+			RepositoryOwner *struct {
+				ProjectsV2 struct {
+					Nodes    []projectV2 `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"projectsV2"`
+			} `json:"repositoryOwner"`
+		}
+		resp, err := c.query(ctx, listProjectsV2Query, variables, &data)
+		if err != nil {
+			return nil, resp, err
+		}
+		if data.RepositoryOwner == nil {
+			return nil, resp, fmt.Errorf("Owner %s not found", owner)
+		}
+		// the search query matches anywhere in the title, keep prefixes only
+		for _, project := range data.RepositoryOwner.ProjectsV2.Nodes {
+			if strings.HasPrefix(project.Title, prefix) {
+				projects = append(projects, project)
+			}
+		}
+		pageInfo := data.RepositoryOwner.ProjectsV2.PageInfo
+		if !pageInfo.HasNextPage {
+			return projects, resp, nil
+		}
+		variables["cursor"] = pageInfo.EndCursor
+	}
+}
+
+const issueNodeIDQuery = `
+query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue { id }
+      ... on PullRequest { id }
+    }
+  }
+}`
+
+// IssueNodeID returns the GraphQL ID of an issue or pull request
+func (c *graphqlClient) IssueNodeID(ctx context.Context, owner, repo string, number int) (string, *github.Response, error) {
+	var data struct {
+		Repository struct {
+			IssueOrPullRequest struct {
+				ID string `json:"id"`
+			} `json:"issueOrPullRequest"`
+		} `json:"repository"`
+	}
+	variables := map[string]interface{}{"owner": owner, "name": repo, "number": number}
+	resp, err := c.query(ctx, issueNodeIDQuery, variables, &data)
+	if err != nil {
+		return "", resp, err
+	}
+	return data.Repository.IssueOrPullRequest.ID, resp, nil
+}
+
+const addProjectV2ItemMutation = `
+mutation($project: ID!, $content: ID!) {
+  addProjectV2ItemById(input: {projectId: $project, contentId: $content}) {
+    item { id }
+  }
+}`
+
+// AddProjectV2Item adds an issue to a project and returns the ID of its item.
+// Issues already in the project keep their item.
+func (c *graphqlClient) AddProjectV2Item(ctx context.Context, projectID, contentID string) (string, *github.Response, error) {
+	var data struct {
+		AddProjectV2ItemByID struct {
+			Item struct {
+				ID string `json:"id"`
+			} `json:"item"`
+		} `json:"addProjectV2ItemById"`
+	}
+	variables := map[string]interface{}{"project": projectID, "content": contentID}
+	resp, err := c.query(ctx, addProjectV2ItemMutation, variables, &data)
+	if err != nil {
+		return "", resp, err
+	}
+	return data.AddProjectV2ItemByID.Item.ID, resp, nil
+}
+
+const projectV2FieldQuery = `
+query($project: ID!, $field: String!) {
+  node(id: $project) {
+    ... on ProjectV2 {
+      field(name: $field) {
+        ... on ProjectV2SingleSelectField { id options { id name } }
+      }
+    }
+  }
+}`
+
+// ProjectV2Field returns the single select field of a project named name
+func (c *graphqlClient) ProjectV2Field(ctx context.Context, projectID, name string) (*projectV2Field, *github.Response, error) {
+	var data struct {
+		Node struct {
+			Field *projectV2Field `json:"field"`
+		} `json:"node"`
+	}
+	variables := map[string]interface{}{"project": projectID, "field": name}
+	resp, err := c.query(ctx, projectV2FieldQuery, variables, &data)
+	if err != nil {
+		return nil, resp, err
+	}
+	if data.Node.Field == nil || data.Node.Field.ID == "" {
+		return nil, resp, fmt.Errorf("No single select field %s", name)
+	}
+	return data.Node.Field, resp, nil
+}
+
+const setProjectV2FieldMutation = `
+mutation($project: ID!, $item: ID!, $field: ID!, $option: String!) {
+  updateProjectV2ItemFieldValue(input: {projectId: $project, itemId: $item, fieldId: $field, value: {singleSelectOptionId: $option}}) {
+    projectV2Item { id }
+  }
+}`
+
+// SetProjectV2Field sets a single select field of a project item
+func (c *graphqlClient) SetProjectV2Field(ctx context.Context, projectID, itemID, fieldID, optionID string) (*github.Response, error) {
+	var data json.RawMessage
+	variables := map[string]interface{}{"project": projectID, "item": itemID, "field": fieldID, "option": optionID}
+	return c.query(ctx, setProjectV2FieldMutation, variables, &data)
+}
+
+// handleProjectV2Label sets the status of the issue of a label event to the
+// column of its action in every matching Projects (V2) project
+func (mon *githubMonitor) handleProjectV2Label(ctx context.Context, client *githubClient, e *github.IssuesEvent, projectPrefix, columnName string, r *http.Request) {
+	owner, repo := *e.Repo.Owner.Login, *e.Repo.Name
+	projects, _, err := client.ProjectsV2.ListProjectsV2(ctx, owner, projectPrefix)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	var matched []projectV2
+	for _, project := range projects {
+		if project.Closed && !mon.config.IncludeClosedProjects {
+			continue
+		}
+		matched = append(matched, project)
+		if mon.config.MultiProject == multiProjectFirst {
+			break
+		}
+	}
+	if mon.config.MultiProject == multiProjectLatest && len(matched) > 1 {
+		names := make([]string, len(matched))
+		for i, project := range matched {
+			names[i] = project.Title
+		}
+		latest := latestVersion(names)
+		matched = matched[latest : latest+1]
+	}
+	if len(matched) == 0 {
+		mon.record(e, "move", fmt.Sprintf("skipped: No project found with prefix %s", projectPrefix))
+		mon.stats.ignored.inc()
+		return
+	}
+	contentID, _, err := client.ProjectsV2.IssueNodeID(ctx, owner, repo, *e.Issue.Number)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "move", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	statusField := mon.config.ProjectsV2.statusField()
+	moved := false
+	for _, project := range matched {
+		field, _, err := client.ProjectsV2.ProjectV2Field(ctx, project.ID, statusField)
+		if err != nil {
+			requestLog(r).Errorf("Could not get field %s of project %v, %v", statusField, project.Title, err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		optionID, ok := field.optionID(columnName)
+		if !ok {
+			requestLog(r).Warnf("Project %v has no %s '%v'", project.Title, statusField, columnName)
+			mon.record(e, "move", fmt.Sprintf("skipped: no %s '%v' in %v", statusField, columnName, project.Title))
+			continue
+		}
+		itemID, _, err := client.ProjectsV2.AddProjectV2Item(ctx, project.ID, contentID)
+		if err != nil {
+			requestLog(r).Errorf("%q", err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		if _, err := client.ProjectsV2.SetProjectV2Field(ctx, project.ID, itemID, field.ID, optionID); err != nil {
+			requestLog(r).Errorf("%q", err)
+			mon.record(e, "move", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		requestLog(r).Infof("Set %s of issue #%v to '%v' in project %v", statusField, *e.Issue.Number, columnName, project.Title)
+		mon.record(e, "move", fmt.Sprintf("set %s to %v in %v", statusField, columnName, project.Title))
+		moved = true
+	}
+	if moved {
+		mon.stats.processed.inc()
+	} else {
+		mon.stats.ignored.inc()
+	}
+}
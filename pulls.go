@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// pullRequestPayload is the part of a pull_request payload go-github doesn't
+// decode
+type pullRequestPayload struct {
+	PullRequest struct {
+		Draft  bool           `json:"draft"`
+		Labels []github.Label `json:"labels"`
+	} `json:"pull_request"`
+	// Label is the label of labeled events
+	Label *github.Label `json:"label"`
+}
+
+// issuesEventForPullRequest returns the issues event matching a pull request
+// event, pull requests being issues to the labels and cards APIs
+func issuesEventForPullRequest(e *github.PullRequestEvent, labels []github.Label) *github.IssuesEvent {
+	pr := e.PullRequest
+	return &github.IssuesEvent{
+		Action: e.Action,
+		Issue: &github.Issue{
+			ID:               pr.ID,
+			Number:           pr.Number,
+			State:            pr.State,
+			Title:            pr.Title,
+			Body:             pr.Body,
+			URL:              pr.IssueURL,
+			HTMLURL:          pr.HTMLURL,
+			Labels:           labels,
+			PullRequestLinks: &github.PullRequestLinks{URL: pr.URL, HTMLURL: pr.HTMLURL},
+		},
+		Repo:   e.Repo,
+		Sender: e.Sender,
+	}
+}
+
+// Labels added to pull requests come as pull_request events, they move the
+// cards of pull requests like the labels of issues do.
+func (mon *githubMonitor) handlePullRequestLabeledEvent(e *github.PullRequestEvent, payload []byte, r *http.Request) {
+	var extra pullRequestPayload
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		requestLog(r).Errorf("Failed to parse pull request, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	if extra.Label == nil {
+		requestLog(r).Errorf("Labeled pull request event without a label")
+		mon.stats.droppedError.inc()
+		return
+	}
+	ie := issuesEventForPullRequest(e, extra.PullRequest.Labels)
+	ie.Label = extra.Label
+	if len(mon.config.ReviewTeams) > 0 {
+		mon.dispatch(r, func(r *http.Request) { mon.requestTeamReview(ie, r) })
+	}
+	if mon.config.Backports.Enabled && e.PullRequest.GetMerged() {
+		mon.dispatch(r, func(r *http.Request) { mon.backportLabeled(ie, e.PullRequest, r) })
+	}
+	mon.handleLabelEvent(ie, r)
+}
+
+// Pull requests are triaged like issues when they are opened, or once they
+// are ready for review when they were opened as drafts.
+func (mon *githubMonitor) handlePullRequestOpenedEvent(e *github.PullRequestEvent, payload []byte, r *http.Request) {
+	var extra pullRequestPayload
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		requestLog(r).Errorf("Failed to parse pull request, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	ie := issuesEventForPullRequest(e, extra.PullRequest.Labels)
+	if len(mon.config.InheritLabels) > 0 {
+		if err := mon.inheritLabels(ie, r); err != nil {
+			requestLog(r).Errorf("Failed inheriting labels for pull request #%v, %v", *e.PullRequest.Number, err)
+			mon.record(ie, "inherit", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+	}
+	if mon.config.releaseBranches != nil && *e.Action == "opened" {
+		if err := mon.labelReleaseBranch(ie, e.PullRequest.Base.GetRef(), r); err != nil {
+			requestLog(r).Errorf("Failed labeling pull request #%v for its base branch, %v", *e.PullRequest.Number, err)
+			mon.record(ie, "branch", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+	}
+	if !mon.config.triagesPullRequests() {
+		mon.stats.processed.inc()
+		return
+	}
+	if extra.PullRequest.Draft && mon.config.SkipDraftPullRequests {
+		requestLog(r).Debugf("Not triaging draft pull request #%v", *e.PullRequest.Number)
+		mon.record(ie, "triage", "skipped: draft pull request")
+		mon.stats.ignored.inc()
+		return
+	}
+	mon.handleIssueOpenedEvent(ie, r)
+}
+
+// Pull requests inherit labels again when edited, since their body may now
+// close other issues.
+func (mon *githubMonitor) handlePullRequestEditedEvent(e *github.PullRequestEvent, payload []byte, r *http.Request) {
+	var extra pullRequestPayload
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		requestLog(r).Errorf("Failed to parse pull request, %v", err)
+		mon.stats.droppedError.inc()
+		return
+	}
+	ie := issuesEventForPullRequest(e, extra.PullRequest.Labels)
+	if err := mon.inheritLabels(ie, r); err != nil {
+		requestLog(r).Errorf("Failed inheriting labels for pull request #%v, %v", *e.PullRequest.Number, err)
+		mon.record(ie, "inherit", fmt.Sprintf("error: %v", err))
+		mon.dropError(r)
+		return
+	}
+	mon.stats.processed.inc()
+}
+
+// closingKeywords finds the issues of the same repository a pull request body
+// closes, like `closes #12` or `Fixes #3`
+var closingKeywords = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)\b`)
+
+// linkedIssues returns the numbers of the issues a pull request body closes
+func linkedIssues(body string) []int {
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, match := range closingKeywords.FindAllStringSubmatch(body, -1) {
+		number, err := strconv.Atoi(match[1])
+		if err != nil || seen[number] {
+			continue
+		}
+		seen[number] = true
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// inheritLabels applies the labels listed in `inheritLabels` of the issues a
+// pull request closes to the pull request
+func (mon *githubMonitor) inheritLabels(e *github.IssuesEvent, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	applied := make(map[string]bool)
+	for _, label := range e.Issue.Labels {
+		applied[label.GetName()] = true
+	}
+	var labelsToApply []string
+	for _, number := range linkedIssues(e.Issue.GetBody()) {
+		labels, err := listIssueLabels(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name, number)
+		if err != nil {
+			return err
+		}
+		for _, label := range labels {
+			if applied[*label.Name] || !mon.config.inheritsLabel(*label.Name) {
+				continue
+			}
+			applied[*label.Name] = true
+			labelsToApply = append(labelsToApply, *label.Name)
+		}
+	}
+	if len(labelsToApply) == 0 {
+		return nil
+	}
+	requestLog(r).Infof("Adding inherited labels %v to pull request #%v", labelsToApply, *e.Issue.Number)
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, labelsToApply); err != nil {
+		return err
+	}
+	mon.record(e, "inherit", fmt.Sprintf("added labels %v", labelsToApply))
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRateLimitMaxWait = 15 * time.Minute
+	defaultRateLimitRetries = 3
+	// maxRateLimitJitter spreads the retries of concurrent handlers waiting
+	// for the same reset
+	maxRateLimitJitter = 5 * time.Second
+)
+
+func (c rateLimitConfig) maxWait() time.Duration {
+	if c.MaxWait <= 0 {
+		return defaultRateLimitMaxWait
+	}
+	return c.MaxWait
+}
+
+func (c rateLimitConfig) retries() int {
+	if c.Retries <= 0 {
+		return defaultRateLimitRetries
+	}
+	return c.Retries
+}
+
+// rateLimitWait returns how long GitHub asks to wait before calling again,
+// false when the response isn't a rate limit or abuse detection error
+func rateLimitWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	// abuse detection says how long to back off for
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		seconds, err := strconv.Atoi(retryAfter)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Unix(reset, 0).Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// rateLimitTransport sleeps until the rate limit resets, or for as long as
+// abuse detection asks, then retries calls instead of failing them. Calls
+// whose context ends before are failed with the rate limit response.
+type rateLimitTransport struct {
+	config  rateLimitConfig
+	metrics *metrics
+	base    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if t.metrics != nil {
+			t.metrics.observeRateLimit(resp)
+		}
+		wait, limited := rateLimitWait(resp, time.Now())
+		if !limited || attempt >= t.config.retries() || wait > t.config.maxWait() {
+			return resp, nil
+		}
+		// bodies can only be sent again when they can be read again
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+		wait += time.Duration(rand.Int63n(int64(maxRateLimitJitter)))
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		log.Warnf("GitHub rate limit hit on %s %s, retrying in %v", req.Method, req.URL.Path, wait)
+		_, span := startChild(req.Context(), "GitHub rate limit wait")
+		span.setAttribute("http.method", req.Method)
+		span.setAttribute("http.url", req.URL.String())
+		span.setAttribute("retry.attempt", attempt+1)
+		span.setAttribute("retry.wait", wait)
+		select {
+		case <-time.After(wait):
+			span.finish()
+		case <-req.Context().Done():
+			span.setError(req.Context().Err())
+			span.finish()
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			retry := new(http.Request)
+			*retry = *req
+			retry.Body = body
+			req = retry
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Values of the releases straggler setting
+const (
+	// stragglersMove moves the cards left on a board to its done column
+	stragglersMove = "move"
+	// stragglersComment comments on the issues of the cards left on a board
+	stragglersComment = "comment"
+)
+
+// releasesConfig closes out the board of a release when the release is
+// published on GitHub
+type releasesConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Stragglers is what happens to the cards not in the done column yet,
+	// move (the default) moves them there, comment comments on their issue
+	Stragglers string `yaml:"stragglers" json:"stragglers"`
+	// Column is the done column, closedColumn or Done by default
+	Column string `yaml:"column" json:"column"`
+	// KeepOpen leaves the board open once the cards are handled
+	KeepOpen bool `yaml:"keepOpen" json:"keepOpen"`
+	// Slack posts a summary of the board to Slack
+	Slack bool `yaml:"slack" json:"slack"`
+}
+
+func (c releasesConfig) stragglers() string {
+	if c.Stragglers == "" {
+		return stragglersMove
+	}
+	return c.Stragglers
+}
+
+func (c releasesConfig) validate() error {
+	switch c.Stragglers {
+	case "", stragglersMove, stragglersComment:
+		return nil
+	}
+	return fmt.Errorf("Invalid releases stragglers %q, expected %q or %q", c.Stragglers, stragglersMove, stragglersComment)
+}
+
+// doneColumn is the column the cards of a published release end up in
+func (c *config) doneColumn() string {
+	switch {
+	case c.Releases.Column != "":
+		return c.Releases.Column
+	case c.ClosedColumn != "":
+		return c.ClosedColumn
+	}
+	return "Done"
+}
+
+// projectStatesService opens and closes projects, which the vendored
+// github.ProjectsService can't do
+type projectStatesService interface {
+	CloseProject(ctx context.Context, id int) (*github.Project, *github.Response, error)
+}
+
+// projectsPreview is the media type of the projects API
+const projectsPreview = "application/vnd.github.inertia-preview+json"
+
+type projectStatesClient struct {
+	client *github.Client
+}
+
+func (c *projectStatesClient) CloseProject(ctx context.Context, id int) (*github.Project, *github.Response, error) {
+	body := struct {
+		State string `json:"state"`
+	}{State: "closed"}
+	req, err := c.client.NewRequest("PATCH", fmt.Sprintf("projects/%d", id), &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", projectsPreview)
+	project := new(github.Project)
+	resp, err := c.client.Do(ctx, req, project)
+	if err != nil {
+		return nil, resp, err
+	}
+	return project, resp, nil
+}
+
+// releaseMatches reports whether a project is the board of a release tag,
+// with or without its leading v. The boards of its pre-releases match too,
+// 17.06.1-rc1 is a board of 17.06.1.
+func releaseMatches(project *github.Project, tag, matchBy string) bool {
+	prefix := projectLabelPrefix(project, matchBy)
+	if prefix == "" {
+		return false
+	}
+	for _, version := range []string{tag, strings.TrimPrefix(tag, "v")} {
+		if prefix == version || strings.HasPrefix(prefix, version+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// When a release is published the open boards of its tag are closed out: the
+// cards left out of the done column are moved there, or their issues get a
+// comment, then the board is closed. Pre-releases leave the boards alone,
+// the rc boards of a release close with it.
+func (mon *githubMonitor) handleReleaseEvent(e *github.ReleaseEvent, r *http.Request) {
+	cfg := mon.config.Releases
+	tag := e.Release.GetTagName()
+	event := fmt.Sprintf("release.%s", e.GetAction())
+	if e.Release.GetPrerelease() {
+		requestLog(r).Debugf("Ignoring pre-release %s", tag)
+		mon.stats.ignored.inc()
+		return
+	}
+	projects, err := mon.listOpenProjects(&github.IssuesEvent{Repo: e.Repo})
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.dropError(r)
+		return
+	}
+	var boards []*github.Project
+	for _, project := range projects {
+		if releaseMatches(project, tag, mon.config.MatchBy) {
+			boards = append(boards, project)
+		}
+	}
+	if len(boards) == 0 {
+		requestLog(r).Debugf("No open project for release %s", tag)
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	done := mon.config.doneColumn()
+	for _, project := range boards {
+		handled, err := mon.closeOutBoard(ctx, client, project, tag, done, event, e.Sender.GetLogin(), r)
+		if err != nil {
+			requestLog(r).Errorf("Could not close out project %v, %v", *project.Name, err)
+			mon.dropError(r)
+			return
+		}
+		closed := false
+		if !cfg.KeepOpen {
+			requestLog(r).Infof("Closing project %v for release %s", *project.Name, tag)
+			if _, _, err := client.ProjectStates.CloseProject(ctx, *project.ID); err != nil {
+				requestLog(r).Errorf("Failed closing project %v, %v", *project.Name, err)
+				mon.dropError(r)
+				return
+			}
+			closed = true
+		}
+		if cfg.Slack && mon.config.Slack.enabled() {
+			mon.postReleaseSummary(e, project, handled, done, closed, r)
+		}
+	}
+	requestLog(r).Infof("Closed out %d projects of %s for release %s", len(boards), repoFullName(e.Repo), tag)
+	mon.stats.processed.inc()
+}
+
+// closeOutBoard handles the cards of a board left out of the done column and
+// returns how many there were
+func (mon *githubMonitor) closeOutBoard(ctx context.Context, client *githubClient, project *github.Project, tag, done, event, sender string, r *http.Request) (int, error) {
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		return 0, err
+	}
+	var doneColumn *github.ProjectColumn
+	for _, column := range columns {
+		if column.GetName() == done {
+			doneColumn = column
+		}
+	}
+	moves := mon.config.Releases.stragglers() == stragglersMove
+	handled := 0
+	for _, column := range columns {
+		if column == doneColumn {
+			continue
+		}
+		cards, err := listCards(ctx, client, *column.ID)
+		if err != nil {
+			return handled, err
+		}
+		for _, card := range cards {
+			owner, repo, number, err := parseContentURL(card.GetContentURL())
+			// notes can be moved but not commented on
+			if err != nil && (err != errNoteCard || !moves) {
+				continue
+			}
+			repoName := fmt.Sprintf("%s/%s", owner, repo)
+			handled++
+			if !moves {
+				body := fmt.Sprintf("Release %s was published while this issue was still in *%s* of %s.", tag, column.GetName(), project.GetName())
+				requestLog(r).Infof("Commenting on %s#%d left in '%v' of project %v", repoName, number, column.GetName(), *project.Name)
+				if _, _, err := mon.clients.forOwner(owner).Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+					return handled, err
+				}
+				mon.recordJob(event, sender, repoName, number, "close-out", fmt.Sprintf("commented, left in %v", column.GetName()))
+				continue
+			}
+			if doneColumn == nil {
+				if doneColumn, err = mon.createColumn(ctx, client, project, done, r); err != nil {
+					return handled, err
+				}
+			}
+			requestLog(r).Infof("Moving card %v from '%v' to '%v' in project %v", *card.ID, column.GetName(), done, *project.Name)
+			if err := moveCard(ctx, client, *card.ID, *doneColumn.ID, cardPositionBottom, r); err != nil {
+				return handled, err
+			}
+			if number != 0 {
+				mon.recordJob(event, sender, repoName, number, "close-out", fmt.Sprintf("moved from %v to %v in %v", column.GetName(), done, *project.Name))
+			}
+		}
+	}
+	return handled, nil
+}
+
+// postReleaseSummary posts the close out of a board to Slack, in the
+// background like the other Slack posts
+func (mon *githubMonitor) postReleaseSummary(e *github.ReleaseEvent, project *github.Project, stragglers int, done string, closed bool, r *http.Request) {
+	text := fmt.Sprintf("Release <%s|%s> of %s is out.", e.Release.GetHTMLURL(), e.Release.GetTagName(), repoFullName(e.Repo))
+	switch {
+	case stragglers == 0:
+		text += fmt.Sprintf(" Every card of %s was done.", project.GetName())
+	case mon.config.Releases.stragglers() == stragglersMove:
+		text += fmt.Sprintf(" %d cards of %s moved to *%s*.", stragglers, project.GetName(), done)
+	default:
+		text += fmt.Sprintf(" %d cards of %s were not done.", stragglers, project.GetName())
+	}
+	if closed {
+		text += " The board is closed."
+	}
+	cfg := mon.config.Slack
+	go func() {
+		ctx, cancel := context.WithTimeout(mon.ctx, 30*time.Second)
+		defer cancel()
+		if err := postSlack(ctx, cfg, text); err != nil {
+			requestLog(r).Errorf("Could not post to Slack, %v", err)
+		}
+	}()
+}
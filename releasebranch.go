@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// releaseOfBranch returns the release of a branch matching `releaseBranches`,
+// the first group of the expression or else the branch name
+func (c *config) releaseOfBranch(branch string) (string, bool) {
+	if c.releaseBranches == nil {
+		return "", false
+	}
+	match := c.releaseBranches.FindStringSubmatch(branch)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 && match[1] != "" {
+		return match[1], true
+	}
+	return branch, true
+}
+
+// labelReleaseBranch applies the `{release}/{triageSuffix}` label of the
+// release branch a pull request is opened against, so the pull request lands
+// on the board of the release. Branches that aren't release branches and
+// releases without the label are left alone.
+func (mon *githubMonitor) labelReleaseBranch(e *github.IssuesEvent, base string, r *http.Request) error {
+	release, ok := mon.config.releaseOfBranch(base)
+	if !ok {
+		mon.record(e, "branch", fmt.Sprintf("skipped: %v is not a release branch", base))
+		return nil
+	}
+	label := fmt.Sprintf("%s/%s", release, mon.config.triageSuffix())
+	for _, applied := range e.Issue.Labels {
+		if applied.GetName() == label {
+			mon.record(e, "branch", fmt.Sprintf("skipped: label '%v' already applied", label))
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	labels, err := listLabels(ctx, client, *e.Repo.Owner.Login, *e.Repo.Name)
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, l := range labels {
+		if l.GetName() == label {
+			known = true
+		}
+	}
+	if !known {
+		mon.record(e, "branch", fmt.Sprintf("skipped: no label '%v'", label))
+		return nil
+	}
+	requestLog(r).Infof("Adding label '%v' to pull request #%v against %v", label, *e.Issue.Number, base)
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, []string{label}); err != nil {
+		return err
+	}
+	mon.record(e, "branch", fmt.Sprintf("added label %v", label))
+	return nil
+}
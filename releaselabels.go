@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// releaseLabelColors are the colors of the labels of the default actions,
+// other actions get defaultLabelColor
+var releaseLabelColors = map[string]string{
+	"triage":        "eeeeee",
+	"cherry-pick":   "a98bf3",
+	"cherry-picked": "bfe5bf",
+}
+
+const defaultLabelColor = "ededed"
+
+// createReleaseLabels creates the `{release}/{action}` labels of every action
+// of a repository that don't exist yet, and returns the names of the labels
+// created
+func (mon *githubMonitor) createReleaseLabels(ctx context.Context, owner, repo, release string) ([]string, error) {
+	client := mon.clients.forOwner(owner)
+	existing, err := listLabels(ctx, client, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, label := range existing {
+		exists[label.GetName()] = true
+	}
+	var actions []string
+	for action := range mon.config.columnTemplates(fmt.Sprintf("%s/%s", owner, repo)) {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	var created []string
+	for _, action := range actions {
+		name := fmt.Sprintf("%s/%s", release, action)
+		if exists[name] {
+			log.Debugf("Label %s already exists in %s/%s", name, owner, repo)
+			continue
+		}
+		color, ok := releaseLabelColors[action]
+		if !ok {
+			color = defaultLabelColor
+		}
+		if _, _, err := client.Issues.CreateLabel(ctx, owner, repo, &github.Label{Name: github.String(name), Color: github.String(color)}); err != nil {
+			return created, fmt.Errorf("Could not create label %s: %v", name, err)
+		}
+		log.Infof("Created label %s in %s/%s", name, owner, repo)
+		created = append(created, name)
+	}
+	return created, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// secretSources are the files, or environment variables when empty, secrets
+// are read from
+type secretSources struct {
+	webhookSecretFile string
+	githubTokenFile   string
+}
+
+// webhookSecrets returns the current webhook secrets
+func (mon *githubMonitor) webhookSecrets() [][]byte {
+	mon.secretMu.RLock()
+	defer mon.secretMu.RUnlock()
+	return mon.secrets
+}
+
+// reloadSecrets reads the webhook secrets, GitHub tokens and app private key
+// again so they can be rotated without a restart. Nothing is replaced unless
+// every secret could be read. Events being handled finish with the clients
+// they started with.
+func (mon *githubMonitor) reloadSecrets() error {
+	webhookSecret, err := readSecret(mon.secretSources.webhookSecretFile, webhookSecretEnvVariable)
+	if err != nil {
+		return fmt.Errorf("Could not read webhook secret: %v", err)
+	}
+	githubToken, err := readSecret(mon.secretSources.githubTokenFile, githubTokenEnvVariable)
+	if err != nil {
+		return fmt.Errorf("Could not read GitHub token: %v", err)
+	}
+	ownerTokens, err := mon.config.resolveTokens()
+	if err != nil {
+		return err
+	}
+	app, err := newGithubApp(mon.config.App, mon.githubURLs)
+	if err != nil {
+		return err
+	}
+	mon.secretMu.Lock()
+	mon.secrets = parseWebhookSecrets(webhookSecret)
+	mon.secretMu.Unlock()
+	mon.clients.setTokens(githubToken, ownerTokens, app)
+	return nil
+}
+
+// handleReload reloads the secrets, for key rotation
+func (mon *githubMonitor) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := mon.reloadSecrets(); err != nil {
+		requestLog(r).Errorf("Reload failed, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLog(r).Infof("Reloaded webhook secret and GitHub tokens")
+	w.WriteHeader(http.StatusNoContent)
+}
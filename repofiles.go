@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// repoFilesConfig reads repository settings, like those of `repos`, from a
+// file in each repository so repositories can configure themselves
+type repoFilesConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Path is the file read from the default branch, `.github/release-bot.yml`
+	// by default
+	Path string `yaml:"path" json:"path"`
+	// TTL is how long a file is cached before being fetched again
+	TTL time.Duration `yaml:"ttl" json:"ttl"`
+}
+
+const (
+	defaultRepoFilePath = ".github/release-bot.yml"
+	defaultRepoFileTTL  = 5 * time.Minute
+)
+
+func (c repoFilesConfig) path() string {
+	if c.Path == "" {
+		return defaultRepoFilePath
+	}
+	return c.Path
+}
+
+func (c repoFilesConfig) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return defaultRepoFileTTL
+	}
+	return c.TTL
+}
+
+// repoFile is the cached settings file of a repository
+type repoFile struct {
+	config    repoConfig
+	fetchedAt time.Time
+}
+
+// repoFiles caches the settings files of repositories by lower cased
+// owner/name
+type repoFiles struct {
+	mu    sync.Mutex
+	files map[string]repoFile
+	// refreshing are the repositories whose file is being fetched
+	refreshing map[string]bool
+}
+
+func newRepoFiles() *repoFiles {
+	return &repoFiles{files: make(map[string]repoFile), refreshing: make(map[string]bool)}
+}
+
+// get returns the cached settings of a repository, empty when none was fetched
+func (f *repoFiles) get(repo string) (repoConfig, bool) {
+	if f == nil {
+		return repoConfig{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[strings.ToLower(repo)]
+	return file.config, ok
+}
+
+// startRefresh reports whether the file of a repository has to be fetched,
+// because its cached copy is older than ttl and nobody is fetching it yet
+func (f *repoFiles) startRefresh(repo string, ttl time.Duration, now time.Time) bool {
+	key := strings.ToLower(repo)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[key]
+	if (ok && now.Sub(file.fetchedAt) < ttl) || f.refreshing[key] {
+		return false
+	}
+	f.refreshing[key] = true
+	return true
+}
+
+func (f *repoFiles) finishRefresh(repo string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.refreshing, strings.ToLower(repo))
+}
+
+func (f *repoFiles) set(repo string, config repoConfig, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[strings.ToLower(repo)] = repoFile{config: config, fetchedAt: now}
+}
+
+// eventRepository returns the repository of the events the bot handles
+func eventRepository(event interface{}) *github.Repository {
+	switch e := event.(type) {
+	case *github.IssuesEvent:
+		return e.Repo
+	case *github.PullRequestEvent:
+		return e.Repo
+	case *github.IssueCommentEvent:
+		return e.Repo
+	case *github.ProjectCardEvent:
+		return e.Repo
+	case *github.LabelEvent:
+		return e.Repo
+	case *github.ReleaseEvent:
+		return e.Repo
+	}
+	return nil
+}
+
+// refreshRepoFile fetches the settings file of a repository in the background
+// unless its cached copy is fresh, so webhooks are acked without waiting on
+// GitHub. Events use the cached copy in the meantime, the global settings
+// until the file was fetched once.
+func (mon *githubMonitor) refreshRepoFile(r *http.Request, repo *github.Repository) {
+	name := repoFullName(repo)
+	now := time.Now()
+	if !mon.config.repoFiles.startRefresh(name, mon.config.RepoFiles.ttl(), now) {
+		return
+	}
+	go func() {
+		defer mon.config.repoFiles.finishRefresh(name)
+		mon.fetchRepoFile(r, repo, now)
+	}()
+}
+
+// fetchRepoFile fetches and caches the settings file of a repository.
+// Repositories without the file get empty settings, invalid files keep the
+// settings of the last valid one.
+func (mon *githubMonitor) fetchRepoFile(r *http.Request, repo *github.Repository, now time.Time) {
+	cfg := mon.config.RepoFiles
+	name := repoFullName(repo)
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 10*time.Second)
+	defer cancel()
+	owner := repo.Owner.GetLogin()
+	file, _, _, err := mon.clients.forOwner(owner).Repositories.GetContents(ctx, owner, repo.GetName(), cfg.path(), nil)
+	if isNotFound(err) {
+		mon.config.repoFiles.set(name, repoConfig{}, now)
+		return
+	}
+	if err != nil {
+		requestLog(r).Warnf("Could not fetch %s of %s, %v", cfg.path(), name, err)
+		return
+	}
+	content, err := file.GetContent()
+	if err == nil {
+		var settings repoConfig
+		if err = yaml.UnmarshalStrict([]byte(content), &settings); err == nil {
+			if err = settings.validate(); err == nil {
+				requestLog(r).Debugf("Loaded %s of %s", cfg.path(), name)
+				mon.config.repoFiles.set(name, settings, now)
+				return
+			}
+		}
+	}
+	requestLog(r).Warnf("Ignoring invalid %s of %s, %v", cfg.path(), name, err)
+	previous, _ := mon.config.repoFiles.get(name)
+	mon.config.repoFiles.set(name, previous, now)
+}
+
+func isNotFound(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// validate checks the column templates, card position and triage pattern of
+// repository settings
+func (c repoConfig) validate() error {
+	for action, name := range c.Columns {
+		if _, err := renderColumnName(name, columnNameData{}); err != nil {
+			return fmt.Errorf("Invalid column for %s: %v", action, err)
+		}
+	}
+	if err := validCardPosition(c.CardPosition); err != nil {
+		return err
+	}
+	if err := validColumnPositions(c.ColumnPositions); err != nil {
+		return err
+	}
+	if c.TriageLabelPattern != "" {
+		if _, err := regexp.Compile(c.TriageLabelPattern); err != nil {
+			return fmt.Errorf("Invalid triageLabelPattern: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// retryQueueConfig persists events that failed to a file so they are retried
+// after GitHub outages instead of being lost. Events being handled are kept
+// in the file too, so the ones interrupted by a restart are retried.
+type retryQueueConfig struct {
+	// Path is the file failed events are kept in, the queue is disabled when
+	// empty
+	Path string `yaml:"path" json:"path"`
+	// Interval is how long to wait before the first retry of a failed event,
+	// the wait doubles with every failed attempt
+	Interval time.Duration `yaml:"interval" json:"interval"`
+	// MaxBackoff caps the wait between two attempts
+	MaxBackoff time.Duration `yaml:"maxBackoff" json:"maxBackoff"`
+	// MaxAge is how long after their first failure events are given up on
+	MaxAge time.Duration `yaml:"maxAge" json:"maxAge"`
+}
+
+const (
+	defaultRetryInterval   = 5 * time.Minute
+	defaultRetryMaxBackoff = 2 * time.Hour
+	defaultRetryMaxAge     = 24 * time.Hour
+)
+
+func (c retryQueueConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultRetryInterval
+	}
+	return c.Interval
+}
+
+func (c retryQueueConfig) maxBackoff() time.Duration {
+	if c.MaxBackoff <= 0 {
+		return defaultRetryMaxBackoff
+	}
+	return c.MaxBackoff
+}
+
+// backoff returns how long to wait before retrying an event that failed
+// after attempts retries
+func (c retryQueueConfig) backoff(attempts int) time.Duration {
+	wait := c.interval()
+	for i := 0; i < attempts && wait < c.maxBackoff(); i++ {
+		wait *= 2
+	}
+	if wait > c.maxBackoff() {
+		return c.maxBackoff()
+	}
+	return wait
+}
+
+func (c retryQueueConfig) maxAge() time.Duration {
+	if c.MaxAge <= 0 {
+		return defaultRetryMaxAge
+	}
+	return c.MaxAge
+}
+
+// queuedEvent is a webhook event waiting to be retried
+type queuedEvent struct {
+	Delivery   string          `json:"delivery"`
+	EventType  string          `json:"eventType"`
+	RequestURI string          `json:"requestURI"`
+	Payload    json.RawMessage `json:"payload"`
+	// FailedAt is the time of the first failure of the event
+	FailedAt time.Time `json:"failedAt"`
+	Attempts int       `json:"attempts"`
+	// NextAttempt is when the event is due to be retried
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// retryQueueFile is the content of the queue file
+type retryQueueFile struct {
+	Events []queuedEvent `json:"events"`
+	// InFlight are the events being handled, still there on startup when the
+	// previous run was interrupted
+	InFlight []queuedEvent `json:"inFlight"`
+}
+
+// retryQueue holds failed events, every change is written to its file
+type retryQueue struct {
+	path   string
+	config retryQueueConfig
+	// depth mirrors the number of queued events for /status
+	depth *counter
+
+	mu       sync.Mutex
+	events   []queuedEvent
+	inFlight map[string]queuedEvent
+}
+
+// loadRetryQueue reads the events left in the queue file by a previous run.
+// Events that were being handled when it stopped are due to be retried now,
+// unless they are queued already.
+func loadRetryQueue(cfg retryQueueConfig, depth *counter) (*retryQueue, error) {
+	q := &retryQueue{path: cfg.Path, config: cfg, depth: depth, inFlight: make(map[string]queuedEvent)}
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	var file retryQueueFile
+	// queue files written by older versions only hold the failed events
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &file.Events); err != nil {
+			return nil, err
+		}
+	} else if len(data) > 0 {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, err
+		}
+	}
+	queued := make(map[string]bool)
+	for _, event := range file.Events {
+		if !queued[event.Delivery] {
+			queued[event.Delivery] = true
+			q.events = append(q.events, event)
+		}
+	}
+	for _, event := range file.InFlight {
+		// a retry interrupted by the restart is still queued from its failure
+		if queued[event.Delivery] {
+			continue
+		}
+		queuedLog(event).Info("Delivery was interrupted, queueing it for retry")
+		queued[event.Delivery] = true
+		event.NextAttempt = time.Now()
+		q.events = append(q.events, event)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.save(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// enqueue adds a failed event, unless it is queued already or too old. It is
+// due after a backoff doubling with every attempt.
+func (q *retryQueue) enqueue(event queuedEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Since(event.FailedAt) > q.config.maxAge() {
+		queuedLog(event).Warnf("Giving up on delivery after %d attempts", event.Attempts)
+		return nil
+	}
+	for _, queued := range q.events {
+		if queued.Delivery == event.Delivery {
+			return nil
+		}
+	}
+	event.NextAttempt = time.Now().Add(q.config.backoff(event.Attempts))
+	q.events = append(q.events, event)
+	return q.save()
+}
+
+// take removes the events due by now from the queue to retry them, dropping
+// the ones older than the max age
+func (q *retryQueue) take(now time.Time) ([]queuedEvent, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due, waiting []queuedEvent
+	for _, event := range q.events {
+		if now.Sub(event.FailedAt) > q.config.maxAge() {
+			queuedLog(event).Warnf("Giving up on delivery after %d attempts", event.Attempts)
+			continue
+		}
+		if event.NextAttempt.After(now) {
+			waiting = append(waiting, event)
+			continue
+		}
+		due = append(due, event)
+	}
+	q.events = waiting
+	return due, q.save()
+}
+
+// start records an event as being handled until done is called, so it is
+// retried if the bot stops before
+func (q *retryQueue) start(event queuedEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight[event.Delivery] = event
+	return q.save()
+}
+
+func (q *retryQueue) done(event queuedEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, event.Delivery)
+	return q.save()
+}
+
+// save writes the queue to a temporary file synced to disk and renamed over
+// the queue file, then syncs the directory holding the rename, so a crash never
+// leaves it half written or loses deliveries acknowledged to GitHub. q.mu must
+// be held.
+func (q *retryQueue) save() error {
+	q.depth.set(uint64(len(q.events)))
+	file := retryQueueFile{Events: q.events}
+	for _, event := range q.inFlight {
+		file.InFlight = append(file.InFlight, event)
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(q.path), filepath.Base(q.path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(q.path))
+}
+
+// syncDir flushes the entries of a directory, like a file renamed into it
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// deliveryKey is the request context key of the delivery being handled
+type deliveryKey struct{}
+
+// trackedDelivery is the delivery a handler works on, queued at most once
+// however many errors the handler runs into
+type trackedDelivery struct {
+	once  sync.Once
+	event queuedEvent
+	// handlers counts the handlers dispatched for the delivery still running
+	handlers sync.WaitGroup
+}
+
+func withDelivery(r *http.Request, event queuedEvent) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), deliveryKey{}, &trackedDelivery{event: event}))
+}
+
+func deliveryFromRequest(r *http.Request) (*trackedDelivery, bool) {
+	delivery, ok := r.Context().Value(deliveryKey{}).(*trackedDelivery)
+	return delivery, ok
+}
+
+// handleDurably handles an event, keeping it in the queue file until all of
+// its handlers are done when the retry queue is enabled
+func (mon *githubMonitor) handleDurably(event interface{}, payload []byte, r *http.Request) {
+	delivery, ok := deliveryFromRequest(r)
+	if mon.retries == nil || !ok {
+		mon.handleEvent(event, payload, r)
+		return
+	}
+	if err := mon.retries.start(delivery.event); err != nil {
+		requestLog(r).Errorf("Could not save delivery %s to the retry queue: %v", delivery.event.Delivery, err)
+	}
+	delivery.handlers.Add(1)
+	mon.handleEvent(event, payload, r)
+	delivery.handlers.Done()
+	go func() {
+		delivery.handlers.Wait()
+		if err := mon.retries.done(delivery.event); err != nil {
+			requestLog(r).Errorf("Could not save the retry queue: %v", err)
+		}
+	}()
+}
+
+// deferDelivery handles a delivery the workers are too busy to take, and
+// returns the status to answer it with. The delivery is queued for retry
+// when the retry queue is enabled. Otherwise it is lost, since GitHub
+// doesn't redeliver failed webhooks by itself, and its ID is forgotten so a
+// redelivery by hand is handled.
+func (mon *githubMonitor) deferDelivery(delivery queuedEvent, r *http.Request) int {
+	if mon.retries != nil {
+		err := mon.retries.enqueue(delivery)
+		if err == nil {
+			requestLog(r).Warnf("Workers are busy, queued delivery %s for retry", delivery.Delivery)
+			return http.StatusAccepted
+		}
+		requestLog(r).Errorf("Could not queue delivery %s for retry: %v", delivery.Delivery, err)
+	}
+	requestLog(r).Errorf("Dropping delivery %s, the workers are busy, the event is lost unless it is redelivered", delivery.Delivery)
+	mon.deliveries.forget(delivery.Delivery)
+	mon.stats.droppedError.inc()
+	return http.StatusServiceUnavailable
+}
+
+// dropError counts an event dropped because of an error and queues it to be
+// retried when the retry queue is enabled
+func (mon *githubMonitor) dropError(r *http.Request) {
+	mon.stats.droppedError.inc()
+	delivery, ok := deliveryFromRequest(r)
+	if !ok {
+		return
+	}
+	// without the retry queue, a redelivery is the only way to try again
+	if mon.retries == nil {
+		mon.deliveries.forget(delivery.event.Delivery)
+		return
+	}
+	delivery.once.Do(func() {
+		if err := mon.retries.enqueue(delivery.event); err != nil {
+			requestLog(r).Errorf("Could not queue delivery %s for retry: %v", delivery.event.Delivery, err)
+		}
+	})
+}
+
+// retryEvery retries the events due at every interval, events failing again
+// are queued again by their handler
+func (mon *githubMonitor) retryEvery(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		mon.retryDue(now)
+	}
+}
+
+// retryDue handles the events due by now again
+func (mon *githubMonitor) retryDue(now time.Time) {
+	events, err := mon.retries.take(now)
+	if err != nil {
+		log.Errorf("Could not save the retry queue: %v", err)
+	}
+	for _, queued := range events {
+		queued.Attempts++
+		event, err := github.ParseWebHook(queued.EventType, queued.Payload)
+		if err != nil {
+			queuedLog(queued).Errorf("Dropping queued delivery, %v", err)
+			continue
+		}
+		r, err := http.NewRequest("POST", queued.RequestURI, bytes.NewReader(queued.Payload))
+		if err != nil {
+			queuedLog(queued).Errorf("Dropping queued delivery, %v", err)
+			continue
+		}
+		r.RequestURI = queued.RequestURI
+		r.Header.Set("X-GitHub-Event", queued.EventType)
+		r.Header.Set("X-GitHub-Delivery", queued.Delivery)
+		requestLog(r).Infof("Retrying delivery %s, attempt %d", queued.Delivery, queued.Attempts)
+		mon.handleDurably(event, queued.Payload, withDelivery(r, queued))
+	}
+}
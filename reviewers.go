@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// teamReviewsPreview is the media type team review requests need
+const teamReviewsPreview = "application/vnd.github.thor-preview+json"
+
+// reviewRequestsClient requests reviews from teams, which go-github doesn't
+// support yet
+type reviewRequestsClient struct {
+	client *github.Client
+}
+
+// requestedReviewers is the body of the requested_reviewers endpoint
+type requestedReviewers struct {
+	Users []*github.User `json:"users"`
+	Teams []*github.Team `json:"teams"`
+}
+
+// ListRequestedTeams returns the slugs of the teams a pull request awaits a
+// review from
+func (c *reviewRequestsClient) ListRequestedTeams(ctx context.Context, owner, repo string, number int) ([]string, *github.Response, error) {
+	u := fmt.Sprintf("repos/%s/%s/pulls/%d/requested_reviewers", owner, repo, number)
+	req, err := c.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", teamReviewsPreview)
+	var reviewers requestedReviewers
+	resp, err := c.client.Do(ctx, req, &reviewers)
+	if err != nil {
+		return nil, resp, err
+	}
+	var teams []string
+	for _, team := range reviewers.Teams {
+		teams = append(teams, team.GetSlug())
+	}
+	return teams, resp, nil
+}
+
+// RequestTeamReviewers requests a review of a pull request from teams
+func (c *reviewRequestsClient) RequestTeamReviewers(ctx context.Context, owner, repo string, number int, teams []string) (*github.Response, error) {
+	u := fmt.Sprintf("repos/%s/%s/pulls/%d/requested_reviewers", owner, repo, number)
+	body := struct {
+		TeamReviewers []string `json:"team_reviewers"`
+	}{TeamReviewers: teams}
+	req, err := c.client.NewRequest("POST", u, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", teamReviewsPreview)
+	return c.client.Do(ctx, req, nil)
+}
+
+// When a pull request gets a `{release}/{action}` label, the owners team of
+// that release configured in `reviewTeams` is asked to review it. This runs
+// alongside handleLabelEvent, which counts the event in the stats.
+func (mon *githubMonitor) requestTeamReview(e *github.IssuesEvent, r *http.Request) {
+	projectPrefix, _, err := splitLabel(e.Label.GetName())
+	if err != nil {
+		return
+	}
+	team := mon.config.reviewTeam(projectPrefix)
+	if team == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	requested, _, err := client.Reviews.ListRequestedTeams(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number)
+	if err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "review", fmt.Sprintf("error: %v", err))
+		return
+	}
+	for _, slug := range requested {
+		if strings.EqualFold(slug, team) {
+			requestLog(r).Debugf("Review already requested from %v on pull request #%v", team, *e.Issue.Number)
+			mon.record(e, "review", fmt.Sprintf("skipped: already requested from %v", team))
+			return
+		}
+	}
+	requestLog(r).Infof("Requesting review from %v on pull request #%v", team, *e.Issue.Number)
+	if _, err := client.Reviews.RequestTeamReviewers(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, []string{team}); err != nil {
+		requestLog(r).Errorf("%q", err)
+		mon.record(e, "review", fmt.Sprintf("error: %v", err))
+		return
+	}
+	mon.record(e, "review", fmt.Sprintf("requested from %v", team))
+}
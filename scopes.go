@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scopeGroups lists the OAuth scopes the bot needs, any scope of a group
+// grants what the bot needs from it
+var scopeGroups = []struct {
+	name   string
+	scopes []string
+}{
+	{name: "repository", scopes: []string{"repo"}},
+	{name: "project", scopes: []string{"project", "read:project", "write:org", "read:org"}},
+}
+
+// parseScopes splits an X-OAuth-Scopes header, for example `repo, read:org`
+func parseScopes(header string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(header, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// missingScopes returns the name of the scope groups none of scopes grants
+func missingScopes(scopes []string) []string {
+	granted := make(map[string]bool)
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+	var missing []string
+	for _, group := range scopeGroups {
+		found := false
+		for _, scope := range group.scopes {
+			if granted[scope] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, group.name)
+		}
+	}
+	return missing
+}
+
+// checkTokenScopes warns at startup about tokens lacking the scopes the bot
+// needs, which otherwise only show up as 403s when handling events.
+// Fine-grained tokens don't expose their permissions and are skipped.
+func (mon *githubMonitor) checkTokenScopes() {
+	mon.clients.mu.Lock()
+	token := mon.clients.token
+	app := mon.clients.app
+	var owners []string
+	for owner := range mon.clients.tokens {
+		owners = append(owners, owner)
+	}
+	mon.clients.mu.Unlock()
+	if app == nil {
+		mon.checkClientScopes("default token", mon.clients.newClient(staticToken(token)))
+	}
+	for _, owner := range owners {
+		mon.checkClientScopes("token for "+owner, mon.clients.forOwner(owner))
+	}
+}
+
+func (mon *githubMonitor) checkClientScopes(name string, client *githubClient) {
+	ctx, cancel := context.WithTimeout(mon.ctx, 30*time.Second)
+	defer cancel()
+	_, resp, err := client.Users.Get(ctx, "")
+	if err != nil {
+		log.Warnf("Could not check the scopes of the %s: %v", name, err)
+		return
+	}
+	header, ok := resp.Header["X-Oauth-Scopes"]
+	if !ok {
+		log.Debugf("Not checking the scopes of the %s, it doesn't expose them", name)
+		return
+	}
+	scopes := parseScopes(strings.Join(header, ","))
+	if missing := missingScopes(scopes); len(missing) > 0 {
+		log.Warnf(
+			"The %s may be missing %s scopes, it has %q",
+			name,
+			strings.Join(missing, " and "),
+			scopes,
+		)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// projectVersionPattern finds the version in a project name, like 17.06.1 in
+// `17.06.1-rc2` or v1.2 in `Release v1.2`, with its pre-release suffix
+var projectVersionPattern = regexp.MustCompile(`v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?`)
+
+// projectVersion is the semantic version in the name of a project
+type projectVersion struct {
+	ok         bool
+	numbers    [3]int
+	prerelease string
+}
+
+func parseProjectVersion(name string) projectVersion {
+	match := projectVersionPattern.FindStringSubmatch(name)
+	if match == nil {
+		return projectVersion{}
+	}
+	version := projectVersion{ok: true, prerelease: match[4]}
+	for i := range version.numbers {
+		version.numbers[i], _ = strconv.Atoi(match[i+1])
+	}
+	return version
+}
+
+// compare returns -1, 0 or 1 when v is older, the same or newer than other.
+// Names without a version are older than any version, and releases newer
+// than their pre-releases, compared in natural order so rc10 follows rc9.
+func (v projectVersion) compare(other projectVersion) int {
+	switch {
+	case !v.ok && !other.ok:
+		return 0
+	case !other.ok:
+		return 1
+	case !v.ok:
+		return -1
+	}
+	for i := range v.numbers {
+		if v.numbers[i] != other.numbers[i] {
+			return compareInts(v.numbers[i], other.numbers[i])
+		}
+	}
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	}
+	return compareNatural(v.prerelease, other.prerelease)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// naturalChunks splits a string in runs of digits and of other characters
+var naturalChunks = regexp.MustCompile(`\d+|\D+`)
+
+// compareNatural compares strings chunk by chunk, numerically for runs of
+// digits
+func compareNatural(a, b string) int {
+	chunksA, chunksB := naturalChunks.FindAllString(a, -1), naturalChunks.FindAllString(b, -1)
+	for i := 0; i < len(chunksA) && i < len(chunksB); i++ {
+		numberA, errA := strconv.Atoi(chunksA[i])
+		numberB, errB := strconv.Atoi(chunksB[i])
+		if errA == nil && errB == nil {
+			if numberA != numberB {
+				return compareInts(numberA, numberB)
+			}
+			continue
+		}
+		if c := strings.Compare(chunksA[i], chunksB[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(chunksA), len(chunksB))
+}
+
+// latestVersion returns the index of the newest of names, the first of them
+// when several are as new
+func latestVersion(names []string) int {
+	latest, latestVersion := -1, projectVersion{}
+	for i, name := range names {
+		version := parseProjectVersion(name)
+		if latest < 0 || version.compare(latestVersion) > 0 {
+			latest, latestVersion = i, version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveUntilSignal runs servers until SIGTERM or SIGINT, then stops accepting
+// webhooks and waits up to timeout for the events being handled so rolling
+// restarts don't lose them. Events still running after the timeout are
+// retried on the next start when the retry queue is enabled. Servers with a
+// TLS config serve HTTPS.
+func (mon *githubMonitor) serveUntilSignal(timeout time.Duration, servers ...*http.Server) {
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if server.TLSConfig != nil {
+				errs <- server.ListenAndServeTLS("", "")
+				return
+			}
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case sig := <-signals:
+		log.Infof("Received %v, shutting down", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warnf("Could not close every connection of %s, %v", server.Addr, err)
+		}
+	}
+	drained := make(chan struct{})
+	go func() {
+		mon.handlers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Info("Finished handling every event")
+	case <-ctx.Done():
+		log.Warnf("Stopping with events still being handled after %v", timeout)
+	}
+	mon.tracer.flush()
+	if err := mon.boards.save(mon.config.BoardCache.Path); err != nil {
+		log.Warnf("Could not save the board cache, %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseWebhookSecrets splits a webhook secret setting into its secrets.
+// Several secrets separated by commas or newlines are accepted at once, so
+// the secret of a webhook can be rotated without dropping deliveries.
+func parseWebhookSecrets(value string) [][]byte {
+	var secrets [][]byte
+	for _, secret := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+	return secrets
+}
+
+// validatePayload reads the payload of a webhook and checks its signature
+// against every secret, using X-Hub-Signature-256 when GitHub sent it and
+// the sha1 X-Hub-Signature otherwise
+func validatePayload(r *http.Request, secrets [][]byte) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	signature := r.Header.Get("X-Hub-Signature-256")
+	if signature == "" {
+		signature = r.Header.Get("X-Hub-Signature")
+	}
+	if signature == "" {
+		return nil, errors.New("Missing signature")
+	}
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid signature %q", signature)
+	}
+	var hashFunc func() hash.Hash
+	switch parts[0] {
+	case "sha256":
+		hashFunc = sha256.New
+	case "sha1":
+		hashFunc = sha1.New
+	default:
+		return nil, fmt.Errorf("Unknown signature hash %q", parts[0])
+	}
+	messageMAC, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature %q: %v", signature, err)
+	}
+	valid := false
+	for _, secret := range secrets {
+		mac := hmac.New(hashFunc, secret)
+		mac.Write(body)
+		if hmac.Equal(messageMAC, mac.Sum(nil)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, errors.New("Payload signature check failed")
+	}
+	// form encoded deliveries are signed as a whole, the payload is a field
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(form.Get("payload")), nil
+	}
+	return body, nil
+}
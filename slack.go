@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// slackConfig posts to Slack when cards land in some columns, to let the
+// release channel know about cherry picks
+type slackConfig struct {
+	// WebhookURL is an incoming webhook posting to the release channel
+	WebhookURL string `yaml:"webhookURL" json:"webhookURL"`
+	// Token is a bot token posting to Channel, used when WebhookURL is empty
+	Token   string `yaml:"token" json:"token"`
+	Channel string `yaml:"channel" json:"channel"`
+	// Columns lists the columns notified about, Cherry Pick and Cherry Picked
+	// by default
+	Columns []string `yaml:"columns" json:"columns"`
+}
+
+// slackPostMessageURL is the Slack API method posting with a bot token
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+func (c slackConfig) enabled() bool {
+	return c.WebhookURL != "" || (c.Token != "" && c.Channel != "")
+}
+
+// notifies reports whether cards landing in a column are posted to Slack
+func (c slackConfig) notifies(columnName string) bool {
+	columns := c.Columns
+	if len(columns) == 0 {
+		columns = []string{columnNames["cherry-pick"], columnNames["cherry-picked"]}
+	}
+	for _, column := range columns {
+		if strings.EqualFold(column, columnName) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifySlack posts that the card of an issue was placed in a column, in the
+// background so Slack being slow never holds up the board
+func (mon *githubMonitor) notifySlack(e *github.IssuesEvent, project *github.Project, columnName string, r *http.Request) {
+	cfg := mon.config.Slack
+	if !cfg.enabled() || !cfg.notifies(columnName) {
+		return
+	}
+	text := fmt.Sprintf(
+		"<%s|%s#%d %s> moved to *%s* in %s",
+		e.Issue.GetHTMLURL(),
+		repoFullName(e.Repo),
+		e.Issue.GetNumber(),
+		e.Issue.GetTitle(),
+		columnName,
+		project.GetName(),
+	)
+	go func() {
+		ctx, cancel := context.WithTimeout(mon.ctx, 30*time.Second)
+		defer cancel()
+		if err := postSlack(ctx, cfg, text); err != nil {
+			requestLog(r).Errorf("Could not post to Slack, %v", err)
+			mon.record(e, "slack", fmt.Sprintf("error: %v", err))
+			return
+		}
+		mon.record(e, "slack", fmt.Sprintf("posted %s", columnName))
+	}()
+}
+
+// postSlack posts text with the incoming webhook, or the bot token
+func postSlack(ctx context.Context, cfg slackConfig, text string) error {
+	message := map[string]string{"text": text}
+	url := cfg.WebhookURL
+	if url == "" {
+		message["channel"] = cfg.Channel
+		url = slackPostMessageURL
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if cfg.WebhookURL == "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Slack responded %s", resp.Status)
+	}
+	if cfg.WebhookURL != "" {
+		return nil
+	}
+	// the Web API reports errors with a 200
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("Slack error: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Values of the staleCards notify setting
+const (
+	staleNotifyComment = "comment"
+	staleNotifySlack   = "slack"
+	staleNotifyBoth    = "both"
+)
+
+// staleCardsConfig reminds the release captain of cards sitting too long in
+// the columns waiting on them
+type staleCardsConfig struct {
+	// Schedule is the cron expression of the checks, as minute, hour, day of
+	// month, month and day of week in the time zone of the server. Checks
+	// are disabled when empty.
+	Schedule string `yaml:"schedule" json:"schedule"`
+	// Repos lists the repositories, as `owner/name`, whose boards are checked
+	Repos []string `yaml:"repos" json:"repos"`
+	// Actions are the label actions of the columns checked, triage and
+	// cherry-pick by default
+	Actions []string `yaml:"actions" json:"actions"`
+	// MaxAge is how long a card can sit in a column since it was last moved,
+	// a week by default
+	MaxAge time.Duration `yaml:"maxAge" json:"maxAge"`
+	// Notify is comment to comment on the issues, slack to post a list to
+	// Slack, or both. comment by default.
+	Notify string `yaml:"notify" json:"notify"`
+	// Captains maps release prefixes to their release captain, `*` is the
+	// captain of releases without one
+	Captains map[string]captainConfig `yaml:"captains" json:"captains"`
+}
+
+// captainConfig is who to mention on GitHub and Slack
+type captainConfig struct {
+	// GitHub is the login of the captain
+	GitHub string `yaml:"github" json:"github"`
+	// Slack is the member ID of the captain, like U024BE7LH
+	Slack string `yaml:"slack" json:"slack"`
+}
+
+func (c staleCardsConfig) actions() []string {
+	if len(c.Actions) == 0 {
+		return []string{"triage", "cherry-pick"}
+	}
+	return c.Actions
+}
+
+func (c staleCardsConfig) maxAge() time.Duration {
+	if c.MaxAge <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return c.MaxAge
+}
+
+func (c staleCardsConfig) notifies(channel string) bool {
+	notify := c.Notify
+	if notify == "" {
+		notify = staleNotifyComment
+	}
+	return notify == channel || notify == staleNotifyBoth
+}
+
+// captain returns the release captain of a release prefix
+func (c staleCardsConfig) captain(prefix string) captainConfig {
+	if captain, ok := c.Captains[prefix]; ok {
+		return captain
+	}
+	return c.Captains["*"]
+}
+
+func (c staleCardsConfig) validate() error {
+	if c.Schedule == "" {
+		return nil
+	}
+	if _, err := parseCronSchedule(c.Schedule); err != nil {
+		return err
+	}
+	switch c.Notify {
+	case "", staleNotifyComment, staleNotifySlack, staleNotifyBoth:
+	default:
+		return fmt.Errorf("Invalid staleCards notify %q, expected %q, %q or %q", c.Notify, staleNotifyComment, staleNotifySlack, staleNotifyBoth)
+	}
+	for _, repo := range c.Repos {
+		if parts := strings.SplitN(repo, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("Invalid staleCards repo %q, expected owner/name", repo)
+		}
+	}
+	return nil
+}
+
+// staleCard is a card sitting too long in a column
+type staleCard struct {
+	// owner and repo are those of the issue, which can be in another
+	// repository than the board
+	owner  string
+	repo   string
+	issue  *github.Issue
+	column string
+	age    time.Duration
+}
+
+// checkStaleCardsOn runs checkStaleCards on schedule, forever
+func (mon *githubMonitor) checkStaleCardsOn(schedule *cronSchedule) {
+	for {
+		next := schedule.next(time.Now())
+		if next.IsZero() {
+			log.Warnf("The staleCards schedule never runs")
+			return
+		}
+		time.Sleep(time.Until(next))
+		mon.checkStaleCards()
+	}
+}
+
+// checkStaleCards reminds the release captains of the stale cards of every
+// repository of `staleCards`
+func (mon *githubMonitor) checkStaleCards() {
+	for _, repo := range mon.config.StaleCards.Repos {
+		parts := strings.SplitN(repo, "/", 2)
+		if err := mon.checkRepoStaleCards(parts[0], parts[1]); err != nil {
+			log.Errorf("Could not check the stale cards of %s, %v", repo, err)
+		}
+	}
+}
+
+// checkRepoStaleCards finds the issues whose card sits in a checked column of
+// an open board of a repository for longer than `maxAge`, and nags the
+// release captain of the board about them
+func (mon *githubMonitor) checkRepoStaleCards(owner, name string) error {
+	cfg := mon.config.StaleCards
+	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(owner)
+	repo := &github.Repository{
+		Owner: &github.User{Login: github.String(owner)},
+		Name:  github.String(name),
+	}
+	projects, err := mon.listOpenProjects(&github.IssuesEvent{Repo: repo})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, project := range projects {
+		prefix := projectLabelPrefix(project, mon.config.MatchBy)
+		if prefix == "" {
+			continue
+		}
+		checked := make(map[string]bool)
+		for _, action := range cfg.actions() {
+			column, _, err := mon.config.columnName(repoFullName(repo), prefix, action)
+			if err != nil {
+				return err
+			}
+			checked[strings.ToLower(column)] = true
+		}
+		columns, err := listColumns(ctx, client, *project.ID)
+		if err != nil {
+			return err
+		}
+		var stale []staleCard
+		for _, column := range columns {
+			if !checked[strings.ToLower(column.GetName())] {
+				continue
+			}
+			cards, err := listCards(ctx, client, *column.ID)
+			if err != nil {
+				return err
+			}
+			for _, card := range cards {
+				if card.UpdatedAt == nil || now.Sub(card.UpdatedAt.Time) <= cfg.maxAge() {
+					continue
+				}
+				issue, err := mon.issueFromCard(ctx, card)
+				if err == errNoteCard {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if issue.GetState() == "closed" {
+					continue
+				}
+				cardOwner, cardRepo, _, _ := parseContentURL(card.GetContentURL())
+				stale = append(stale, staleCard{
+					owner:  cardOwner,
+					repo:   cardRepo,
+					issue:  issue,
+					column: column.GetName(),
+					age:    now.Sub(card.UpdatedAt.Time),
+				})
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		log.Infof("Found %d stale cards in project %v of %s/%s", len(stale), *project.Name, owner, name)
+		captain := cfg.captain(prefix)
+		if cfg.notifies(staleNotifyComment) {
+			mon.commentStaleCards(ctx, project, captain, stale)
+		}
+		if cfg.notifies(staleNotifySlack) && mon.config.Slack.enabled() {
+			mon.postStaleCards(ctx, project, captain, stale)
+		}
+	}
+	return nil
+}
+
+// staleDays formats the age of a card in days
+func staleDays(age time.Duration) string {
+	days := int(age.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// commentStaleCards comments on every stale issue, mentioning the captain
+func (mon *githubMonitor) commentStaleCards(ctx context.Context, project *github.Project, captain captainConfig, stale []staleCard) {
+	for _, card := range stale {
+		repoName, number := fmt.Sprintf("%s/%s", card.owner, card.repo), card.issue.GetNumber()
+		body := fmt.Sprintf("This issue has been in *%s* of %s for %s.", card.column, project.GetName(), staleDays(card.age))
+		if captain.GitHub != "" {
+			body = fmt.Sprintf("@%s %s", captain.GitHub, body)
+		}
+		_, _, err := mon.clients.forOwner(card.owner).Issues.CreateComment(ctx, card.owner, card.repo, number, &github.IssueComment{Body: github.String(body)})
+		if err != nil {
+			log.Errorf("Could not comment on stale issue %s#%d, %v", repoName, number, err)
+			mon.recordJob("stale", "", repoName, number, "nag", fmt.Sprintf("error: %v", err))
+			continue
+		}
+		mon.recordJob("stale", "", repoName, number, "nag", fmt.Sprintf("commented, %s in %s", staleDays(card.age), card.column))
+	}
+}
+
+// postStaleCards posts the list of stale issues of a board to Slack,
+// mentioning the captain
+func (mon *githubMonitor) postStaleCards(ctx context.Context, project *github.Project, captain captainConfig, stale []staleCard) {
+	lines := []string{fmt.Sprintf("%d stale cards in %s:", len(stale), project.GetName())}
+	if captain.Slack != "" {
+		lines[0] = fmt.Sprintf("<@%s> %s", captain.Slack, lines[0])
+	}
+	for _, card := range stale {
+		lines = append(lines, fmt.Sprintf(
+			"• <%s|#%d %s> in *%s* for %s",
+			card.issue.GetHTMLURL(),
+			card.issue.GetNumber(),
+			card.issue.GetTitle(),
+			card.column,
+			staleDays(card.age),
+		))
+	}
+	if err := postSlack(ctx, mon.config.Slack, strings.Join(lines, "\n")); err != nil {
+		log.Errorf("Could not post the stale cards of %s to Slack, %v", project.GetName(), err)
+	}
+}
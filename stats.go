@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// counter is a uint64 that is safe for concurrent use
+type counter uint64
+
+func (c *counter) inc() {
+	atomic.AddUint64((*uint64)(c), 1)
+}
+
+// set stores v, for counters used as gauges
+func (c *counter) set(v uint64) {
+	atomic.StoreUint64((*uint64)(c), v)
+}
+
+func (c *counter) load() uint64 {
+	return atomic.LoadUint64((*uint64)(c))
+}
+
+// eventStats counts how webhook events were handled. It must stay the first
+// field of githubMonitor so the counters are 64-bit aligned on 32-bit platforms.
+type eventStats struct {
+	// processed counts events the bot acted on
+	processed counter
+	// ignored counts events the bot intentionally did nothing for
+	ignored counter
+	// droppedError counts events dropped because of an error
+	droppedError counter
+	// panics counts handler panics
+	panics counter
+	// authFailures counts webhooks with an invalid signature
+	authFailures counter
+	// busy counts webhooks the workers were too busy to take
+	busy counter
+	// retryQueue is the number of failed events waiting to be retried
+	retryQueue counter
+}
+
+func (s *eventStats) snapshot() map[string]uint64 {
+	return map[string]uint64{
+		"processed":     s.processed.load(),
+		"ignored":       s.ignored.load(),
+		"dropped_error": s.droppedError.load(),
+		"panics":        s.panics.load(),
+		"auth_failures": s.authFailures.load(),
+		"busy":          s.busy.load(),
+		"retry_queue":   s.retryQueue.load(),
+	}
+}
+
+func (s *eventStats) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.snapshot()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// logEvery logs the counters at every interval
+func (s *eventStats) logEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		fields := log.Fields{}
+		for name, value := range s.snapshot() {
+			fields[name] = value
+		}
+		log.WithFields(fields).Info("Event stats")
+	}
+}
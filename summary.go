@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// summaryConfig enables a single comment per issue listing the actions the bot
+// took on it, instead of maintainers having to piece them together
+type summaryConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Window is how long to wait for more actions on an issue before
+	// commenting, for example `30s`
+	Window time.Duration `yaml:"window" json:"window"`
+	// Reaction reacts to the issue with this reaction, like `eyes`, instead
+	// of commenting
+	Reaction string `yaml:"reaction" json:"reaction"`
+	// Template is the body of the comment, rendered with the repository as
+	// .Repo, the issue number as .Issue and the list of actions as .Actions
+	Template string `yaml:"template" json:"template"`
+}
+
+// defaultSummaryTemplate lists the actions taken
+const defaultSummaryTemplate = "release-bot took these actions:\n{{range .Actions}}\n- {{.}}{{end}}"
+
+// summaryReactions are the reactions GitHub supports
+var summaryReactions = []string{"+1", "-1", "laugh", "confused", "heart", "hooray", "rocket", "eyes"}
+
+// validate checks the reaction and the template
+func (c summaryConfig) validate() error {
+	if c.Reaction != "" {
+		known := false
+		for _, reaction := range summaryReactions {
+			if c.Reaction == reaction {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("Invalid summary reaction %q, expected one of %v", c.Reaction, summaryReactions)
+		}
+	}
+	if _, err := c.template(); err != nil {
+		return fmt.Errorf("Invalid summary template: %v", err)
+	}
+	return nil
+}
+
+func (c summaryConfig) template() (*template.Template, error) {
+	text := c.Template
+	if text == "" {
+		text = defaultSummaryTemplate
+	}
+	return template.New("summary").Parse(text)
+}
+
+// summaryData is what the summary template is rendered with
+type summaryData struct {
+	Repo    string
+	Issue   int
+	Actions []string
+}
+
+// summarizes reports whether the actions taken on the issues of a repository
+// are summarized
+func (c *config) summarizes(repo string) bool {
+	if enabled := c.repo(repo).SummaryComment; enabled != nil {
+		return *enabled
+	}
+	return c.SummaryComment.Enabled
+}
+
+// defaultSummaryWindow is used when summary comments are enabled without a
+// window
+const defaultSummaryWindow = 30 * time.Second
+
+func (c summaryConfig) window() time.Duration {
+	if c.Window <= 0 {
+		return defaultSummaryWindow
+	}
+	return c.Window
+}
+
+// pendingSummary holds the actions taken on an issue that were not commented
+// yet
+type pendingSummary struct {
+	actions []string
+	timer   *time.Timer
+	flushed bool
+}
+
+// actionSummaries debounces the actions taken per issue, post is called once
+// no action was added to an issue for the window
+type actionSummaries struct {
+	window time.Duration
+	post   func(repo string, issue int, actions []string)
+
+	mu      sync.Mutex
+	pending map[string]*pendingSummary
+}
+
+func newActionSummaries(window time.Duration, post func(repo string, issue int, actions []string)) *actionSummaries {
+	return &actionSummaries{
+		window:  window,
+		post:    post,
+		pending: make(map[string]*pendingSummary),
+	}
+}
+
+// add records an action taken on an issue and restarts its window
+func (s *actionSummaries) add(repo string, issue int, action string) {
+	key := fmt.Sprintf("%s#%d", repo, issue)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[key]
+	if !ok {
+		p = &pendingSummary{}
+		s.pending[key] = p
+		p.timer = time.AfterFunc(s.window, func() { s.flush(key, p, repo, issue) })
+	} else {
+		p.timer.Reset(s.window)
+	}
+	p.actions = append(p.actions, action)
+}
+
+func (s *actionSummaries) flush(key string, p *pendingSummary, repo string, issue int) {
+	s.mu.Lock()
+	if p.flushed {
+		s.mu.Unlock()
+		return
+	}
+	p.flushed = true
+	if s.pending[key] == p {
+		delete(s.pending, key)
+	}
+	actions := p.actions
+	s.mu.Unlock()
+	s.post(repo, issue, actions)
+}
+
+// summarize adds a decision to the summary comment of its issue, only actions
+// that changed something are listed
+func (mon *githubMonitor) summarize(repo string, issue int, action, outcome string) {
+	if mon.summaries == nil || !mon.config.summarizes(repo) {
+		return
+	}
+	for _, prefix := range []string{"skipped:", "error:", "ignored:"} {
+		if strings.HasPrefix(outcome, prefix) {
+			return
+		}
+	}
+	mon.summaries.add(repo, issue, fmt.Sprintf("%s: %s", action, outcome))
+}
+
+// postSummary comments the actions taken on an issue, or reacts to it
+func (mon *githubMonitor) postSummary(repo string, issue int, actions []string) {
+	ctx, cancel := context.WithTimeout(mon.ctx, 5*time.Minute)
+	defer cancel()
+	parts := strings.SplitN(repo, "/", 2)
+	client := mon.clients.forOwner(parts[0])
+	if reaction := mon.config.SummaryComment.Reaction; reaction != "" {
+		if _, _, err := client.Reactions.CreateIssueReaction(ctx, parts[0], parts[1], issue, reaction); err != nil {
+			log.Errorf("Could not react to %s#%d: %v", repo, issue, err)
+		}
+		return
+	}
+	tmpl, err := mon.config.SummaryComment.template()
+	if err != nil {
+		log.Errorf("Could not render the summary of %s#%d: %v", repo, issue, err)
+		return
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, summaryData{Repo: repo, Issue: issue, Actions: actions}); err != nil {
+		log.Errorf("Could not render the summary of %s#%d: %v", repo, issue, err)
+		return
+	}
+	body := rendered.String()
+	_, _, err = client.Issues.CreateComment(
+		ctx,
+		parts[0],
+		parts[1],
+		issue,
+		&github.IssueComment{Body: &body},
+	)
+	if err != nil {
+		log.Errorf("Could not comment the summary of %s#%d: %v", repo, issue, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// resyncIssue re-runs card placement for every `{release}/{action}` label of
+// an issue as if the labels had just been applied. With triage, issues
+// without any release label are triaged like newly opened issues when
+// triage is on for the repository.
+func (mon *githubMonitor) resyncIssue(issue *github.Issue, repo *github.Repository, triage bool, r *http.Request) {
+	var releaseLabels []github.Label
+	for _, label := range issue.Labels {
+		if _, _, err := splitLabel(label.GetName()); err == nil {
+			releaseLabels = append(releaseLabels, label)
+		}
+	}
+	if len(releaseLabels) == 0 {
+		if !triage || !mon.config.autoTriage(repoFullName(repo)) || (issue.PullRequestLinks != nil && !mon.config.triagesPullRequests()) {
+			return
+		}
+		mon.handleIssueOpenedEvent(&github.IssuesEvent{
+			Action: github.String("opened"),
+			Issue:  issue,
+			Repo:   repo,
+		}, r)
+		return
+	}
+	for i := range releaseLabels {
+		mon.handleLabelEvent(&github.IssuesEvent{
+			Action: github.String("labeled"),
+			Issue:  issue,
+			Label:  &releaseLabels[i],
+			Repo:   repo,
+		}, r)
+	}
+}
+
+// syncRepository resyncs every open issue of a repository, as owner/name, to
+// backfill the events missed while the bot was down
+func (mon *githubMonitor) syncRepository(ctx context.Context, repository string, triage bool) error {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid repository %q, expected owner/name", repository)
+	}
+	owner, name := parts[0], parts[1]
+	client := mon.clients.forOwner(owner)
+	repo := &github.Repository{
+		Owner: &github.User{Login: github.String(owner)},
+		Name:  github.String(name),
+	}
+	r, err := http.NewRequest("POST", "/sync/"+repository, nil)
+	if err != nil {
+		return err
+	}
+	r.RequestURI = "/sync/" + repository
+	issues, err := listIssues(ctx, client, owner, name, github.IssueListByRepoOptions{State: "open"})
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		requestLog(r).Infof("Syncing issue #%v", issue.GetNumber())
+		mon.resyncIssue(issue, repo, triage, r)
+	}
+	return nil
+}
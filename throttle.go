@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// recentMoves remembers the last move of every card for a while, so a card
+// bouncing between the bot and other automations is only moved once per window
+type recentMoves struct {
+	mu    sync.Mutex
+	moves map[int]recentMove
+}
+
+type recentMove struct {
+	columnID int
+	at       time.Time
+}
+
+// allow reports whether a card may be moved to a column, which it may unless
+// it was moved to the same column within window. Allowed moves are remembered.
+func (m *recentMoves) allow(cardID, columnID int, window time.Duration, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.moves == nil {
+		m.moves = make(map[int]recentMove)
+	}
+	for id, move := range m.moves {
+		if now.Sub(move.at) >= window {
+			delete(m.moves, id)
+		}
+	}
+	if move, ok := m.moves[cardID]; ok && move.columnID == columnID {
+		return false
+	}
+	m.moves[cardID] = recentMove{columnID: columnID, at: now}
+	return true
+}
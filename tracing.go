@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tracingConfig exports a span per webhook, handler and GitHub API call to an
+// OpenTelemetry collector, to see where the time handling an event goes
+type tracingConfig struct {
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector, for example
+	// `http://localhost:4318/v1/traces`. Tracing is disabled when empty.
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// ServiceName is reported as `service.name`, release-bot by default
+	ServiceName string `yaml:"serviceName" json:"serviceName"`
+	// Headers are sent with every export, for collectors or hosted backends
+	// requiring an API key
+	Headers map[string]string `yaml:"headers" json:"headers"`
+}
+
+// Standard OpenTelemetry environment variables, used for the settings the
+// config leaves empty
+const (
+	otlpTracesEndpointEnvVariable = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	otlpEndpointEnvVariable       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpHeadersEnvVariable        = "OTEL_EXPORTER_OTLP_HEADERS"
+	otelServiceNameEnvVariable    = "OTEL_SERVICE_NAME"
+)
+
+// withEnv fills in the settings the config leaves empty from the standard
+// OpenTelemetry environment variables. OTEL_EXPORTER_OTLP_ENDPOINT is the base
+// URL of the collector, traces are sent to its /v1/traces path.
+func (c tracingConfig) withEnv() tracingConfig {
+	if c.Endpoint == "" {
+		c.Endpoint = os.Getenv(otlpTracesEndpointEnvVariable)
+	}
+	if c.Endpoint == "" {
+		if base := os.Getenv(otlpEndpointEnvVariable); base != "" {
+			c.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = os.Getenv(otelServiceNameEnvVariable)
+	}
+	if headers := os.Getenv(otlpHeadersEnvVariable); headers != "" {
+		merged := make(map[string]string)
+		for _, header := range strings.Split(headers, ",") {
+			parts := strings.SplitN(header, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			merged[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		for key, value := range c.Headers {
+			merged[key] = value
+		}
+		c.Headers = merged
+	}
+	return c
+}
+
+const (
+	defaultServiceName = "release-bot"
+	// maxPendingSpans bounds the spans kept while the collector is unreachable
+	maxPendingSpans = 2048
+	// tracingFlushInterval is how often finished spans are exported
+	tracingFlushInterval = 5 * time.Second
+)
+
+// span is a timed operation of a trace. A nil span, used when tracing is
+// disabled, ignores every call.
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = fmt.Sprint(value)
+}
+
+func (s *span) setError(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// finish ends the span and hands it to the tracer for export
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.add(s)
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// startChild begins an internal span, child of the span of ctx, for code
+// without access to the tracer. It returns a nil span when ctx isn't traced.
+func startChild(ctx context.Context, name string) (context.Context, *span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.start(ctx, name)
+}
+
+// tracer creates spans and exports them in batches. A nil tracer, used when
+// tracing is disabled, creates nil spans.
+type tracer struct {
+	endpoint string
+	service  string
+	headers  map[string]string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []*span
+}
+
+func newTracer(cfg tracingConfig) *tracer {
+	cfg = cfg.withEnv()
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = defaultServiceName
+	}
+	return &tracer{
+		endpoint: cfg.Endpoint,
+		service:  service,
+		headers:  cfg.Headers,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// start begins an internal span, child of the span of ctx if any, and
+// returns a context carrying it
+func (t *tracer) start(ctx context.Context, name string) (context.Context, *span) {
+	return t.startKind(ctx, name, otlpKindInternal)
+}
+
+// startKind begins a span of an OTLP kind
+func (t *tracer) startKind(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *tracer) add(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= maxPendingSpans {
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+// flushEvery exports the finished spans at every interval
+func (t *tracer) flushEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		t.flush()
+	}
+}
+
+// flush exports the finished spans
+func (t *tracer) flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		log.Warnf("Could not export %d spans: %v", len(spans), err)
+	}
+}
+
+// otlpAttribute and the types below are the parts of the OTLP/HTTP JSON
+// encoding the bot uses
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpKindClient   = 3
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+func newOTLPAttribute(key, value string) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	attribute.Value.StringValue = value
+	return attribute
+}
+
+func (t *tracer) export(spans []*span) error {
+	var encoded []otlpSpan
+	for _, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != ([8]byte{}) {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for key, value := range s.attributes {
+			o.Attributes = append(o.Attributes, newOTLPAttribute(key, value))
+		}
+		o.Status.Code = otlpStatusOK
+		if s.err != nil {
+			o.Status.Code = otlpStatusError
+			o.Status.Message = s.err.Error()
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, o)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{newOTLPAttribute("service.name", t.service)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": defaultServiceName},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// traceparent returns the W3C Trace Context header of the span, flagged as
+// sampled since every span is exported
+func (s *span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// traceparentHeader propagates the trace of outgoing calls
+const traceparentHeader = "traceparent"
+
+// tracedTransport wraps every GitHub API call in a span, child of the span of
+// the handler making it, and sends the span along in a traceparent header
+type tracedTransport struct {
+	tracer *tracer
+	base   http.RoundTripper
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, s := t.tracer.startKind(req.Context(), fmt.Sprintf("GitHub %s %s", req.Method, req.URL.Path), otlpKindClient)
+	defer s.finish()
+	s.setAttribute("http.method", req.Method)
+	s.setAttribute("http.url", req.URL.String())
+	if s != nil {
+		// a RoundTripper must not modify the request it is given
+		req = req.Clone(req.Context())
+		req.Header.Set(traceparentHeader, s.traceparent())
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		s.setError(err)
+		return nil, err
+	}
+	s.setAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		s.setError(fmt.Errorf("GitHub responded %s", resp.Status))
+	}
+	return resp, nil
+}
+
+// eventContext returns the context handlers make API calls with, carrying the
+// span of the request so API calls show up in its trace
+func (mon *githubMonitor) eventContext(r *http.Request) context.Context {
+	if s := spanFromContext(r.Context()); s != nil {
+		return context.WithValue(mon.ctx, spanKey{}, s)
+	}
+	return mon.ctx
+}
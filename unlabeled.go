@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Values of the unlabeled setting
+const (
+	// unlabeledTriage moves cards back to the triage column
+	unlabeledTriage = "triage"
+	// unlabeledRemove deletes cards from the board
+	unlabeledRemove = "remove"
+)
+
+// findCard returns the card of the issue of an event in a project and its
+// column, nil when the issue has no card, along with the columns of the
+// project
+func findCard(ctx context.Context, client *githubClient, project *github.Project, e *github.IssuesEvent) (*github.ProjectCard, *github.ProjectColumn, []*github.ProjectColumn, error) {
+	columns, err := listColumns(ctx, client, *project.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cards, err := issueCards(ctx, client, project, columns, e)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(cards) == 0 {
+		return nil, nil, columns, nil
+	}
+	return cards[0].card, cards[0].column, columns, nil
+}
+
+// When a `{release}/{action}` label is removed, the card the label placed is
+// moved back to triage or removed from the board, depending on `unlabeled`.
+// Cards moved elsewhere since are left alone.
+func (mon *githubMonitor) handleUnlabelEvent(e *github.IssuesEvent, r *http.Request) {
+	projectPrefix, labelSuffix, err := splitLabel(*e.Label.Name)
+	if err != nil {
+		mon.record(e, "unlabel", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
+		return
+	}
+	if mon.config.isTriageSuffix(labelSuffix) && mon.config.Unlabeled == unlabeledTriage {
+		mon.record(e, "unlabel", "skipped: triage label removed")
+		mon.stats.ignored.inc()
+		return
+	}
+	repo := repoFullName(e.Repo)
+	columnName, known, err := mon.config.columnName(repo, projectPrefix, labelSuffix)
+	if err != nil {
+		requestLog(r).Errorf("Could not render the column of label '%v', %v", *e.Label.Name, err)
+		mon.record(e, "unlabel", fmt.Sprintf("error: %v", err))
+		mon.stats.droppedError.inc()
+		return
+	}
+	if !known {
+		columnName = labelSuffix
+	}
+	triageColumn, _, err := mon.config.columnName(repo, projectPrefix, "triage")
+	if err != nil {
+		requestLog(r).Errorf("Could not render the triage column, %v", err)
+		mon.record(e, "unlabel", fmt.Sprintf("error: %v", err))
+		mon.stats.droppedError.inc()
+		return
+	}
+	projects, err := mon.getProjects(projectPrefix, e)
+	if err != nil {
+		mon.record(e, "unlabel", fmt.Sprintf("skipped: %v", err))
+		mon.stats.ignored.inc()
+		return
+	}
+	ctx, cancel := context.WithTimeout(mon.eventContext(r), 5*time.Minute)
+	defer cancel()
+	client := mon.clients.forOwner(*e.Repo.Owner.Login)
+	reversed := false
+	for _, project := range projects {
+		card, column, columns, err := findCard(ctx, client, project, e)
+		if err != nil {
+			requestLog(r).Errorf("%q", err)
+			mon.record(e, "unlabel", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		if card == nil || *column.Name != columnName {
+			mon.record(e, "unlabel", fmt.Sprintf("skipped: no card in '%v' in %v", columnName, *project.Name))
+			continue
+		}
+		if mon.config.Unlabeled == unlabeledRemove {
+			requestLog(r).Infof("Removing card of issue #%v from project %v", *e.Issue.Number, *project.Name)
+			if _, err := client.Projects.DeleteProjectCard(ctx, *card.ID); err != nil {
+				requestLog(r).Errorf("Failed deleting card %v:\n%v", *card.ID, err)
+				mon.record(e, "unlabel", fmt.Sprintf("error: %v", err))
+				mon.dropError(r)
+				return
+			}
+			mon.record(e, "unlabel", fmt.Sprintf("removed from %v", *project.Name))
+			reversed = true
+			continue
+		}
+		var triageColumnID int
+		for _, c := range columns {
+			if *c.Name == triageColumn {
+				triageColumnID = *c.ID
+			}
+		}
+		if triageColumnID == 0 {
+			mon.record(e, "unlabel", fmt.Sprintf("skipped: no column '%v' in %v", triageColumn, *project.Name))
+			continue
+		}
+		requestLog(r).Infof("Moving issue #%v back to '%v' in project %v", *e.Issue.Number, triageColumn, *project.Name)
+		if err := moveCard(ctx, client, *card.ID, triageColumnID, mon.config.cardPosition(repo, triageColumn), r); err != nil {
+			requestLog(r).Errorf("Failed moving card %v:\n%v", *card.ID, err)
+			mon.record(e, "unlabel", fmt.Sprintf("error: %v", err))
+			mon.dropError(r)
+			return
+		}
+		mon.record(e, "unlabel", fmt.Sprintf("moved from %v to %v in %v", columnName, triageColumn, *project.Name))
+		reversed = true
+	}
+	if reversed {
+		mon.stats.processed.inc()
+	} else {
+		mon.stats.ignored.inc()
+	}
+}
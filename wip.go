@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// wipLimitConfig is the work in progress limit of a column
+type wipLimitConfig struct {
+	Limit int `yaml:"wipLimit" json:"wipLimit"`
+	// Block refuses moves over the limit instead of warning on the issue
+	Block bool `yaml:"block" json:"block"`
+}
+
+// countCards returns the number of cards in a column, across every page
+func countCards(ctx context.Context, client *githubClient, columnID int) (int, error) {
+	cards, err := listCards(ctx, client, columnID)
+	if err != nil {
+		return 0, err
+	}
+	return len(cards), nil
+}
+
+// warnWIPLimit comments on an issue whose card is placed in a column over its
+// WIP limit
+func (mon *githubMonitor) warnWIPLimit(ctx context.Context, client *githubClient, e *github.IssuesEvent, project *github.Project, columnName string, limit int, r *http.Request) {
+	body := fmt.Sprintf(
+		"The '%s' column of project %s is over its WIP limit of %d with this issue.",
+		columnName,
+		*project.Name,
+		limit,
+	)
+	if _, _, err := client.Issues.CreateComment(ctx, *e.Repo.Owner.Login, *e.Repo.Name, *e.Issue.Number, &github.IssueComment{Body: &body}); err != nil {
+		requestLog(r).Errorf("Failed commenting WIP limit warning on issue #%v, %v", *e.Issue.Number, err)
+		mon.record(e, "wip warning", fmt.Sprintf("error: %v", err))
+		return
+	}
+	mon.record(e, "wip warning", fmt.Sprintf("'%v' over WIP limit of %v", columnName, limit))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// defaultWorkers is how many workers handle events by default
+	defaultWorkers = 16
+	// workerQueueDepth is how many events wait for each worker by default
+	workerQueueDepth = 64
+)
+
+// workers returns how many workers handle events
+func (c *config) workers() int {
+	if c.Workers <= 0 {
+		return defaultWorkers
+	}
+	return c.Workers
+}
+
+// queueDepth returns how many events wait for each worker
+func (c *config) queueDepth() int {
+	if c.QueueDepth <= 0 {
+		return workerQueueDepth
+	}
+	return c.QueueDepth
+}
+
+// issueWorkers handles events on a fixed set of workers, the events of an
+// issue always going to the same worker so they are handled one at a time
+// and in the order they came in, while other issues proceed on other workers.
+// Events not about an issue run on their own but no more than one per worker
+// at once. Queueing never blocks, webhooks are turned away before their
+// queue grows past its depth.
+type issueWorkers struct {
+	queues []*workerQueue
+	depth  int
+	// slots bounds how many events without an issue run at once
+	slots chan struct{}
+	// pending counts the events without an issue running or waiting
+	pending int32
+}
+
+func newIssueWorkers(workers, depth int) *issueWorkers {
+	w := &issueWorkers{
+		queues: make([]*workerQueue, workers),
+		depth:  depth,
+		slots:  make(chan struct{}, workers),
+	}
+	for i := range w.queues {
+		w.queues[i] = newWorkerQueue()
+		go w.queues[i].work()
+	}
+	return w
+}
+
+// queue returns the queue of the worker handling the events of key
+func (w *issueWorkers) queue(key string) *workerQueue {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return w.queues[hash.Sum32()%uint32(len(w.queues))]
+}
+
+// run runs a job for key, after the jobs queued before it for the same key,
+// or on its own once a slot is free when key is empty
+func (w *issueWorkers) run(key string, job func()) {
+	if key != "" {
+		w.queue(key).push(job)
+		return
+	}
+	atomic.AddInt32(&w.pending, 1)
+	go func() {
+		defer atomic.AddInt32(&w.pending, -1)
+		w.slots <- struct{}{}
+		defer func() { <-w.slots }()
+		job()
+	}()
+}
+
+// full reports whether the events of key have a full queue, so new
+// deliveries are turned away instead of piling up. An event can queue
+// several handlers, so a queue can go a little past its depth.
+func (w *issueWorkers) full(key string) bool {
+	if key == "" {
+		return int(atomic.LoadInt32(&w.pending)) >= cap(w.slots)+w.depth
+	}
+	return w.queue(key).len() >= w.depth
+}
+
+// workerQueue is the queue of jobs of a worker, which pushing to never blocks
+type workerQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	jobs []func()
+}
+
+func newWorkerQueue() *workerQueue {
+	q := &workerQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *workerQueue) push(job func()) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *workerQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// work runs the jobs of the queue in order, forever
+func (q *workerQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.jobs) == 0 {
+			q.cond.Wait()
+		}
+		job := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+		job()
+	}
+}
+
+// issueKey returns the repository and number of the issue or pull request an
+// event is about, as `owner/name#number`, or an empty string for events not
+// about a single issue
+func issueKey(event interface{}) string {
+	var repo *github.Repository
+	var number int
+	switch e := event.(type) {
+	case *github.IssuesEvent:
+		repo, number = e.Repo, e.Issue.GetNumber()
+	case *github.PullRequestEvent:
+		repo, number = e.Repo, e.PullRequest.GetNumber()
+	case *github.IssueCommentEvent:
+		repo, number = e.Repo, e.Issue.GetNumber()
+	case *github.ProjectCardEvent:
+		owner, name, cardNumber, err := parseContentURL(e.ProjectCard.GetContentURL())
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(fmt.Sprintf("%s/%s#%d", owner, name, cardNumber))
+	}
+	if repo == nil || number == 0 {
+		return ""
+	}
+	return strings.ToLower(fmt.Sprintf("%s#%d", repoFullName(repo), number))
+}